@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Open the database a question is asked against and the schema shown to the model: any SQLite
+// file, with the schema read from it, or else a dataset pack
+func openAskDb(dbFile string, packsDir string, packName string) (*sql.DB, string, error) {
+	if dbFile != "" {
+		db, err := openReadOnlyDb(dbFile)
+		if err != nil {
+			return nil, "", err
+		}
+		schema, err := readSqliteSchema(db)
+		if err != nil {
+			db.Close()
+			return nil, "", fmt.Errorf("%s: %v", dbFile, err)
+		}
+		return db, schemaForPrompt(schema), nil
+	}
+	packs, err := findDatasetPacks(packsDir, packName)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(packs) != 1 {
+		return nil, "", fmt.Errorf("questions are asked against one pack, not %d", len(packs))
+	}
+	schema, err := packs[0].PromptSchema()
+	if err != nil {
+		return nil, "", err
+	}
+	db, err := packs[0].OpenDb()
+	return db, schema, err
+}
+
+// Flags shared by the commands that ask ad hoc questions
+type askOptions struct {
+	baseURL          *string
+	maxTokens        *int
+	seed             *int
+	model            *string
+	packsDir         *string
+	packName         *string
+	dbFile           *string
+	dialect          *string
+	translateDialect *bool
+	queryTimeout     *time.Duration
+	maxRows          *int
+	stream           *bool
+	earlyStop        *bool
+	schemaLinking    *string
+	valueHints       *bool
+	glossary         *bool
+}
+
+func addAskFlags(flags *flag.FlagSet) *askOptions {
+	return &askOptions{
+		baseURL:          flags.String("base-url", "", "Base URL for the API server"),
+		maxTokens:        flags.Int("max-tokens", 200, "Maximum number of tokens in the summary"),
+		seed:             flags.Int("seed", NoSeed, "Seed for deterministic (in theory) results (optional)"),
+		model:            flags.String("model", DefaultEvaluator, "Model to generate the SQL as 'name : model'"),
+		packsDir:         flags.String("packs-dir", DefaultPacksDir, "Directory containing dataset packs"),
+		packName:         flags.String("pack", DefaultPack, "Dataset pack to ask questions of"),
+		dbFile:           flags.String("db", "", "SQLite database to ask questions of instead of a pack"),
+		dialect:          flags.String("dialect", DefaultDialect, "SQL dialect the model is asked to write: sqlite, postgresql or mysql"),
+		translateDialect: flags.Bool("translate-dialect", true, "Rewrite constructs from other dialects into SQLite before running the SQL"),
+		queryTimeout:     flags.Duration("query-timeout", DefaultQueryTimeout, "Longest a query can run before it's interrupted, the only limit on the work it does (0 for no limit)"),
+		maxRows:          flags.Int("max-rows", DefaultMaxResultRows, "Most rows of a result that are shown, which doesn't limit the work the query does (0 for no limit)"),
+		stream:           flags.Bool("stream", true, "Show the SQL as it's generated"),
+		earlyStop:        flags.Bool("early-stop", true, "Stop generating once the SQL statement is complete"),
+		schemaLinking:    flags.String("schema-linking", DefaultSchemaLinking, "How each question's tables are picked from schemas of more than 4: off, lexical or model"),
+		valueHints:       flags.Bool("value-hints", true, "Tell the model about values in the database the question refers to"),
+		glossary:         flags.Bool("glossary", true, "Give the model the pack's definitions of business terms the question uses"),
+	}
+}
+
+// Whether the flags' values are ones open can use, checked before anything's opened
+func (options *askOptions) valid() bool {
+	return validDialect(*options.dialect) && validSchemaLinking(*options.schemaLinking) && validModelName(*options.model)
+}
+
+func (options *askOptions) limits() QueryLimits {
+	return QueryLimits{Timeout: *options.queryTimeout, MaxRows: *options.maxRows}
+}
+
+func (options *askOptions) streaming() Streaming {
+	streaming := Streaming{EarlyStop: *options.earlyStop}
+	if *options.stream {
+		streaming.Progress = os.Stdout
+	}
+	return streaming
+}
+
+// Everything asking a question needs, with a copy of the database the SQL can do what it likes
+// to. Close the database when done.
+func (options *askOptions) open() *Asker {
+	source, schema, err := openAskDb(*options.dbFile, *options.packsDir, *options.packName)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer source.Close()
+	db, err := snapshotDb(source)
+	if err != nil {
+		log.Fatalf("Failed to snapshot database: %v", err)
+	}
+	if err := applySqliteLimits(db); err != nil {
+		log.Fatalf("Failed to limit database: %v", err)
+	}
+	var tables []SchemaTable
+	if *options.schemaLinking != SchemaLinkingOff || *options.valueHints {
+		if tables, err = loadSchemaTables(db); err != nil {
+			log.Fatalf("Failed to read schema for linking and value hints: %v", err)
+		}
+	}
+	linker := newSchemaLinker(tables, schema, *options.schemaLinking)
+	var values *ValueIndex
+	if *options.valueHints {
+		values = buildValueIndex(tables, schema)
+	}
+	glossary, err := options.loadGlossary()
+	if err != nil {
+		log.Fatalf("Failed to load glossary: %v", err)
+	}
+	llmClient := lookupLLMClient(*options.model, initialiseLLMClients(*options.baseURL))
+	return &Asker{
+		Db:               db,
+		Model:            llmClient.Instance,
+		Schema:           schema,
+		Dialect:          *options.dialect,
+		MaxTokens:        options.maxTokens,
+		Seed:             *options.seed,
+		Limits:           options.limits(),
+		TranslateDialect: *options.translateDialect,
+		Streaming:        options.streaming(),
+		ContextWindow:    llmClient.InputContextWindowSize,
+		Linker:           linker,
+		Values:           values,
+		Glossary:         glossary,
+	}
+}
+
+// The pack's glossary, if questions are asked of a pack that has one and it's wanted
+func (options *askOptions) loadGlossary() (*Glossary, error) {
+	if *options.dbFile != "" || !*options.glossary {
+		return nil, nil
+	}
+	packs, err := findDatasetPacks(*options.packsDir, *options.packName)
+	if err != nil || len(packs) != 1 {
+		return nil, err
+	}
+	return packs[0].LoadGlossary()
+}
+
+// The same, but with SQL unable to change the data, for servers where one request's SQL
+// shouldn't change what the next sees
+func (options *askOptions) openReadOnly() *Asker {
+	asker := options.open()
+	if err := restrictToReads(asker.Db); err != nil {
+		log.Fatalf("Failed to make database read only: %v", err)
+	}
+	return asker
+}
+
+var ErrNoValidSql = errors.New("failed to generate SQL that runs")
+
+// Asks a model questions about one database: the ask, repl and serve commands' common ground
+type Asker struct {
+	Db               *sql.DB
+	Model            llms.Model
+	Schema           string // as shown to the model
+	Dialect          string
+	MaxTokens        *int
+	Seed             int
+	Limits           QueryLimits
+	TranslateDialect bool
+	Streaming        Streaming
+	ContextWindow    int           // tokens the model takes, for trimming the prompt to fit (0 for no limit)
+	Linker           *SchemaLinker // picks the tables each question needs (nil for the whole schema)
+	Values           *ValueIndex   // for hints about the values a question refers to (nil for none)
+	Glossary         *Glossary     // business terms the question might use (nil for none)
+}
+
+// SQL generated for a question
+type GeneratedSql struct {
+	SQL           string   `json:"sql"`                    // as the model wrote it
+	ExecutedSQL   string   `json:"executed_sql,omitempty"` // SQL translated for SQLite, if it needed to be
+	Translated    []string `json:"translated,omitempty"`
+	DialectIssues []string `json:"dialect_issues,omitempty"`
+	// how long the model took to write it and the tokens it used
+	Stats *GenerationStats `json:"-"`
+}
+
+// The SQL to run on SQLite
+func (generated *GeneratedSql) Runnable() string {
+	if generated.ExecutedSQL != "" {
+		return generated.ExecutedSQL
+	}
+	return generated.SQL
+}
+
+// How a question was answered, after any retries
+type AskAnswer struct {
+	GeneratedSql
+	Attempts int        `json:"attempts"`
+	Outcome  string     `json:"outcome,omitempty"`
+	Result   string     `json:"-"`              // as a JSON result set, when the SQL was run
+	Plan     *QueryPlan `json:"plan,omitempty"` // when the SQL was only checked
+}
+
+func (asker *Asker) Prompt(question string, examples string) SqlPrompt {
+	return SqlPrompt{Instructions: SqlGeneratorApiSystemPrompt + dialectPrompt(asker.Dialect), Schema: asker.Schema, Examples: examples, Question: question}
+}
+
+// Generate SQL for a question, examples being added to the prompt (e.g. earlier questions it
+// follows up on) and failedAttempts telling the model what not to do again
+func (asker *Asker) Generate(ctx context.Context, question string, examples string, failedAttempts []FailedSqlQueryAttempt) (*GeneratedSql, error) {
+	prompt := asker.Prompt(question, examples)
+	var tables []string
+	if asker.Linker != nil {
+		link, err := asker.Linker.Link(ctx, asker.Model, question, *asker.MaxTokens, asker.Seed)
+		if err != nil {
+			return nil, err
+		}
+		prompt.Schema, tables = link.Schema, link.Tables
+	}
+	prompt.Hints = valueHintsPrompt(asker.Values.Hints(question, tables))
+	prompt.Glossary = glossaryPrompt(asker.Glossary.Matching(question))
+	predictedSqlQuery, stats, err := predictSqlQueryFromNaturalLanguageQuery(ctx, asker.Model, asker.MaxTokens, asker.ContextWindow, prompt, asker.Seed, failedAttempts, asker.Streaming)
+	if err != nil {
+		return nil, err
+	}
+	generated := &GeneratedSql{SQL: stripNewlines(predictedSqlQuery), Stats: stats}
+	generated.DialectIssues = dialectIssueConstructs(findDialectIssues(generated.SQL, asker.Dialect))
+	if asker.TranslateDialect {
+		if translatedSql, translated := translateToSqlite(generated.SQL); len(translated) > 0 {
+			generated.ExecutedSQL, generated.Translated = translatedSql, translated
+		}
+	}
+	return generated, nil
+}
+
+// Generate SQL for a question and run it, generating it again with the errors like the benchmark
+// does until it works. If execute is false the SQL is only checked with EXPLAIN QUERY PLAN, so
+// SQLite has to be able to compile it but it isn't run.
+func (asker *Asker) Answer(ctx context.Context, question string, execute bool) (*AskAnswer, error) {
+	var failedAttempts []FailedSqlQueryAttempt
+	for len(failedAttempts) <= MaxSqlGenerationFaultRetries {
+		generated, err := asker.Generate(ctx, question, "", failedAttempts)
+		if err != nil {
+			return nil, err
+		}
+		answer := &AskAnswer{GeneratedSql: *generated, Attempts: len(failedAttempts) + 1}
+		if execute {
+			answer.Result, answer.Outcome, err = runLimitedQueryContext(ctx, asker.Db, generated.Runnable(), asker.Limits)
+		} else {
+			answer.Plan, err = explainQueryPlan(asker.Db, generated.Runnable(), asker.Limits)
+		}
+		if err == nil {
+			return answer, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("! Error executing query (%v) generating a new query", err)
+		failedAttempts = append(failedAttempts, FailedSqlQueryAttempt{SqlQuery: generated.Runnable(), ErrorMessage: stripNewlines(err.Error())})
+	}
+	last := failedAttempts[len(failedAttempts)-1]
+	return nil, fmt.Errorf("%w after %d attempts, the last '%s' failing with: %s", ErrNoValidSql, len(failedAttempts), last.SqlQuery, last.ErrorMessage)
+}
+
+// ask: generate SQL for one question, retrying with the errors like the benchmark does, and
+// print the SQL and its result
+func runAsk(args []string) int {
+	flags := flag.NewFlagSet("ask", flag.ExitOnError)
+	options := addAskFlags(flags)
+	format := flags.String("format", ResultFormatMarkdown, "How to print the result: markdown, csv or json")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: ask [flags] <question>\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	question := strings.TrimSpace(strings.Join(flags.Args(), " "))
+	if question == "" || !options.valid() || !validResultFormat(*format) {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	asker := options.open()
+	defer asker.Db.Close()
+	answer, err := asker.Answer(context.Background(), question, true)
+	if errors.Is(err, ErrNoValidSql) {
+		fmt.Fprintf(os.Stderr, "%s%v%s\n", boldRed, err, reset)
+		return ExitFailure
+	}
+	if err != nil {
+		log.Fatalf("Failed to generate SQL: %v", err)
+	}
+	fmt.Printf("SQL: %s\n\n", answer.Runnable())
+	result, err := parseResultSet(answer.Result)
+	if err != nil {
+		log.Fatalf("Failed to read result: %v", err)
+	}
+	if err := result.Write(os.Stdout, *format); err != nil {
+		log.Fatalf("Failed to write result: %v", err)
+	}
+	if answer.Outcome == QueryOutcomeTruncated {
+		fmt.Fprintf(os.Stderr, "Result truncated to %d rows\n", asker.Limits.MaxRows)
+	}
+	return ExitOk
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Settings shared by every pack and model in a benchmark run
+type BenchmarkConfig struct {
+	MaxTokens      *int
+	Seed           int
+	Evaluator      *LLMClient
+	AskParaphrases bool
+	Snapshot       string // SnapshotPerModel or SnapshotPerRun
+	Limits         QueryLimits
+	Dialect        string // the SQL dialect the models are asked to write
+	// rewrite what SQLite has its own way of doing from other dialects before running it
+	TranslateDialect bool
+	Streaming        Streaming
+	SchemaLinking    string // how each question's tables are picked from the schema, see SchemaLinkingLexical
+	ValueHints       bool   // tell the model about values in the database the question refers to
+	Glossary         string // whether the pack's glossary is used, see GlossaryCompare
+}
+
+// Run every model over every ground truth question in a dataset pack
+func runPackBenchmark(pack *DatasetPack, llmClients []*LLMClient, config BenchmarkConfig) (*PackRunRecord, error) {
+	fmt.Printf("\n\n#######################################\n")
+	fmt.Printf("Dataset pack: %s\n", pack.Name)
+
+	// ensure our db exists and has the content we want to test against
+	packDb, err := pack.OpenDb()
+	if err != nil {
+		return nil, err
+	}
+	defer packDb.Close()
+	checksum, err := dbSha256(packDb)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Database %s sha256 %s\n", pack.Path(pack.Database), checksum)
+
+	// generated SQL never runs against the pack's database itself, only copies of it
+	var runDb *sql.DB
+	if config.Snapshot == SnapshotPerRun {
+		if runDb, err = snapshotDb(packDb); err != nil {
+			return nil, err
+		}
+		defer runDb.Close()
+		if err := applySqliteLimits(runDb); err != nil {
+			return nil, err
+		}
+	}
+
+	schema, err := pack.PromptSchema()
+	if err != nil {
+		return nil, err
+	}
+	var tables []SchemaTable
+	if config.SchemaLinking != SchemaLinkingOff || config.ValueHints {
+		if tables, err = loadSchemaTables(packDb); err != nil {
+			return nil, err
+		}
+	}
+	linker := newSchemaLinker(tables, schema, config.SchemaLinking)
+	var values *ValueIndex
+	if config.ValueHints {
+		values = buildValueIndex(tables, schema)
+	}
+	var glossary *Glossary
+	if config.Glossary != GlossaryOff {
+		if glossary, err = pack.LoadGlossary(); err != nil {
+			return nil, err
+		}
+	}
+	groundTruth, err := pack.LoadGroundTruth()
+	if err != nil {
+		return nil, err
+	}
+	if config.AskParaphrases {
+		groundTruth = expandParaphrases(groundTruth)
+	}
+	fmt.Printf("Loaded %d ground truth items\n", len(groundTruth))
+
+	packRecord := &PackRunRecord{Pack: pack.Name, Metric: pack.Metric, DatabaseSha256: checksum}
+	// comparing runs every model without the glossary and then with it
+	withGlossary := []bool{glossary != nil}
+	if config.Glossary == GlossaryCompare && glossary != nil {
+		withGlossary = []bool{false, true}
+	}
+	for _, llmClient := range llmClients {
+		for _, useGlossary := range withGlossary {
+			modelRecord := &ModelRunRecord{Name: llmClient.Name, Model: llmClient.Model, Price: llmClient.Price, EvaluatorPrice: config.Evaluator.Price, Glossary: useGlossary}
+			fmt.Printf("\n\n=======================================\n")
+			fmt.Printf("Using model: %s\n", modelRecord.Label())
+
+			db := runDb
+			if db == nil {
+				if db, err = snapshotDb(packDb); err != nil {
+					return nil, err
+				}
+				if err := applySqliteLimits(db); err != nil {
+					return nil, err
+				}
+			}
+			prompt := SqlPrompt{Instructions: SqlGeneratorApiSystemPrompt + dialectPrompt(config.Dialect), Schema: schema}
+			var modelGlossary *Glossary
+			if useGlossary {
+				modelGlossary = glossary
+			}
+			// checked before every model so a run snapshot shows if an earlier model changed the data
+			if modelRecord.DatabaseSha256, err = dbSha256(db); err != nil {
+				return nil, err
+			}
+			for _, item := range groundTruth {
+				fmt.Printf("\n==== %s: %s\n", llmClient.Name, llmClient.Model)
+				modelRecord.Questions = append(modelRecord.Questions, answerGroundTruthItem(db, prompt, linker, values, modelGlossary, llmClient, item, pack.Metric, config))
+			}
+			if db != runDb {
+				db.Close()
+			}
+			fmt.Printf("\n%s: %d/%d correct\n", modelRecord.Label(), modelRecord.CorrectCount(), len(modelRecord.Questions))
+			packRecord.Models = append(packRecord.Models, modelRecord)
+		}
+	}
+	return packRecord, nil
+}
+
+// Generate SQL for one question, retrying with the errors of previous attempts until it
+// executes, then compare it with the ground truth using the pack's metric.
+func answerGroundTruthItem(db *sql.DB, prompt SqlPrompt, linker *SchemaLinker, values *ValueIndex, glossary *Glossary, llmClient *LLMClient, item GroundTruthItem, metric string, config BenchmarkConfig) *QuestionRecord {
+	record := &QuestionRecord{ID: item.ID, Question: item.Query, GoldSQL: item.SQL, Tags: item.Tags, Difficulty: item.Difficulty}
+	var failedAttempts []FailedSqlQueryAttempt
+	var predictedSqlQuery string
+	var err error
+
+	// any external knowledge the question needs is given to the model along with it
+	prompt.Question = item.Query
+	if item.Evidence != "" {
+		prompt.Question += "\nExternal knowledge: " + item.Evidence
+	}
+
+	// only the tables the question needs, with how many of those the gold SQL uses were found
+	link, err := linker.Link(context.Background(), llmClient.Instance, prompt.Question, *config.MaxTokens, config.Seed)
+	if link != nil && link.Stats != nil {
+		record.addUsage(link.Stats.Usage, llmClient.Price)
+	}
+	if err != nil {
+		log.Printf("Error linking schema for query '%s': %v\n", item.Query, err)
+		record.Error = err.Error()
+		return record
+	}
+	prompt.Schema = link.Schema
+	if len(link.Tables) > 0 {
+		record.LinkedTables = link.Tables
+		record.GoldTables = bestGoldTables(append([]string{item.SQL}, item.AlternativeSQL...), linker.Tables, link.Tables)
+	}
+	record.ValueHints = values.Hints(prompt.Question, link.Tables)
+	prompt.Hints = valueHintsPrompt(record.ValueHints)
+	terms := glossary.Matching(prompt.Question)
+	record.GlossaryTerms = glossaryTermNames(terms)
+	prompt.Glossary = glossaryPrompt(terms)
+
+	successfulSqlQuery := false
+
+	for len(failedAttempts) <= MaxSqlGenerationFaultRetries && !successfulSqlQuery {
+		// predict the SQL query from the natural language query
+		// print out the natural query
+		fmt.Printf("Query: %s\n", prompt.Question)
+		record.Attempts++
+		var stats *GenerationStats
+		predictedSqlQuery, stats, err = predictSqlQueryFromNaturalLanguageQuery(context.Background(), llmClient.Instance, config.MaxTokens, llmClient.InputContextWindowSize, prompt, config.Seed, failedAttempts, config.Streaming)
+		record.addGenerationStats(stats, llmClient.Price)
+		if err != nil {
+			log.Printf("Error predicting SQL for query '%s': %v\n", item.Query, err)
+			record.Error = err.Error()
+			break
+		}
+		// SQL statements are often multi-line but work on a single line so for readability we compress it to a single line
+		predictedSqlQuery = stripNewlines(predictedSqlQuery)
+		record.PredictedSQL = predictedSqlQuery
+
+		// check the model wrote the dialect it was asked for, then make it something SQLite can run
+		dialectIssues := findDialectIssues(predictedSqlQuery, config.Dialect)
+		for _, issue := range dialectIssues {
+			fmt.Printf("- Dialect issue: %s\n", issue.Message)
+		}
+		record.DialectIssues = uniqueSorted(append(record.DialectIssues, dialectIssueConstructs(dialectIssues)...))
+		executedSqlQuery := predictedSqlQuery
+		record.ExecutedSQL, record.Translated = "", nil
+		if config.TranslateDialect {
+			var translated []string
+			if executedSqlQuery, translated = translateToSqlite(predictedSqlQuery); len(translated) > 0 {
+				fmt.Printf("- Translated %s for SQLite: '%s'\n", strings.Join(translated, ", "), executedSqlQuery)
+				record.ExecutedSQL = executedSqlQuery
+				record.Translated = translated
+			}
+		}
+
+		// Execute the SQL query, within limits as it could be anything
+		jsonRows, outcome, err := runLimitedQuery(db, executedSqlQuery, config.Limits)
+		record.Outcome = outcome
+
+		// SQL query failed (or took too long) so let's regenerate the query
+		// taking into account this and previous errors
+		// by including them in the message sent to the LLM, and try again.
+		if err != nil {
+			log.Printf("! Error executing query '%s' (%s) generating a new query", predictedSqlQuery, err.Error())
+			record.Error = stripNewlines(err.Error())
+			errorMessage := stripNewlines(err.Error())
+			// point the model at anything from the wrong dialect, which is the likely cause
+			for _, issue := range dialectIssues {
+				errorMessage += "; " + issue.Message
+			}
+			failedAttempts = append(failedAttempts, FailedSqlQueryAttempt{
+				// Compress the sql query to a single line
+				SqlQuery:     predictedSqlQuery,
+				ErrorMessage: errorMessage,
+			})
+
+			// generating the query was successful, so let's compare against ground truth
+		} else {
+			successfulSqlQuery = true
+			record.Executed = true
+			record.Error = ""
+			fmt.Printf("- Ground Truth Query: '%s'\n", item.SQL)
+			fmt.Printf("- Generated Query:    '%s'\n", predictedSqlQuery)
+
+			sqlQueryComparison, comparisonStats, err := compareSqlQueriesWithSystemPrompt(context.Background(), SqlComparisonApiSystemPrompt, item.SQL, executedSqlQuery, config.Evaluator, config.MaxTokens, config.Seed, config.Streaming)
+			record.addEvaluatorUsage(comparisonStats, config.Evaluator.Price)
+			if err != nil {
+				log.Printf("Error comparing SQL queries: %v", err)
+			}
+			fmt.Printf("- SQL Query Comparison result: %s\n", sqlQueryComparison)
+			record.Comparison = sqlQueryComparison
+			record.Result = jsonRows
+
+			fmt.Printf("- Ground Truth Result:%s\n", item.Result)
+			fmt.Printf("- SQL Result:         %s\n", jsonRows)
+			if outcome == QueryOutcomeTruncated {
+				fmt.Printf("- %sResult truncated%s to %d rows / %d bytes\n", boldRed, reset, config.Limits.MaxRows, config.Limits.MaxBytes)
+			}
+
+			// correct or not, see how efficiently it would run compared with the gold query
+			if record.PredictedPlan, err = explainQueryPlan(db, executedSqlQuery, config.Limits); err != nil {
+				log.Printf("Error explaining query '%s': %v", executedSqlQuery, err)
+			}
+			if record.GoldPlan, err = explainQueryPlan(db, item.SQL, config.Limits); err != nil {
+				log.Printf("Error explaining gold query '%s': %v", item.SQL, err)
+			}
+			if record.PredictedPlan != nil && record.GoldPlan != nil {
+				fmt.Printf("- Query plan %s (gold %s)\n", record.PredictedPlan.Summary(), record.GoldPlan.Summary())
+			}
+
+			match := scorePredictionWithMetric(db, metric, item, executedSqlQuery, jsonRows, config.Limits)
+			record.Correct = match.Correct
+			record.MatchedVariant = match.Variant
+			if match.Correct {
+				fmt.Printf("- And they are the %ssame%s (matched %s)\n\n", boldGreen, reset, match.Variant)
+			} else {
+				fmt.Printf("- And they are %sdifferent%s\n\n", boldRed, reset)
+			}
+		}
+	}
+
+	if !successfulSqlQuery {
+		log.Printf("Failed to execute a valid query after %d attempts for query '%s'.", MaxSqlGenerationFaultRetries+1, item.Query)
+	}
+	return record
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Benchmark formats dataset import understands
+const (
+	SpiderFormat = "spider"
+	BirdFormat   = "bird"
+)
+
+// An entry in Spider's dev.json/train_spider.json
+type SpiderQuestion struct {
+	DbId     string `json:"db_id"`
+	Question string `json:"question"`
+	Query    string `json:"query"`
+}
+
+// An entry in BIRD's dev.json, which adds "evidence": the external knowledge needed to answer
+type BirdQuestion struct {
+	QuestionId int    `json:"question_id"`
+	DbId       string `json:"db_id"`
+	Question   string `json:"question"`
+	Evidence   string `json:"evidence"`
+	SQL        string `json:"SQL"`
+	Difficulty string `json:"difficulty"`
+}
+
+// An entry in Spider's tables.json (BIRD's dev_tables.json has the same shape)
+type SpiderTableSchema struct {
+	DbId                string          `json:"db_id"`
+	TableNamesOriginal  []string        `json:"table_names_original"`
+	ColumnNamesOriginal [][]interface{} `json:"column_names_original"` // [table index, column name], -1 for *
+	ColumnTypes         []string        `json:"column_types"`
+	PrimaryKeys         []interface{}   `json:"primary_keys"` // column indexes, or lists of them for composite keys
+	ForeignKeys         [][]int         `json:"foreign_keys"` // [column index, referenced column index]
+}
+
+// BIRD labels difficulty differently to us
+var birdDifficulties = map[string]string{
+	"simple":      DifficultyEasy,
+	"moderate":    DifficultyMedium,
+	"challenging": DifficultyHard,
+}
+
+var spiderColumnTypes = map[string]string{
+	"text":    "TEXT",
+	"number":  "NUMERIC",
+	"time":    "TEXT",
+	"boolean": "BOOLEAN",
+}
+
+// Render a tables.json entry as CREATE TABLE statements, which is how the model sees the schema
+func spiderSchemaToDdl(schema SpiderTableSchema) string {
+	type column struct {
+		table int
+		name  string
+		kind  string
+	}
+	var columns []column
+	for i, columnName := range schema.ColumnNamesOriginal {
+		if len(columnName) != 2 {
+			continue
+		}
+		tableIndex, _ := columnName[0].(float64)
+		name, _ := columnName[1].(string)
+		kind := "TEXT"
+		if i < len(schema.ColumnTypes) {
+			if mapped, ok := spiderColumnTypes[schema.ColumnTypes[i]]; ok {
+				kind = mapped
+			}
+		}
+		columns = append(columns, column{table: int(tableIndex), name: name, kind: kind})
+	}
+	columnAt := func(index int) (column, bool) {
+		if index < 0 || index >= len(columns) {
+			return column{}, false
+		}
+		return columns[index], true
+	}
+
+	primaryKeys := make(map[int][]string)
+	for _, key := range schema.PrimaryKeys {
+		var indexes []int
+		switch k := key.(type) {
+		case float64:
+			indexes = []int{int(k)}
+		case []interface{}:
+			for _, index := range k {
+				if f, ok := index.(float64); ok {
+					indexes = append(indexes, int(f))
+				}
+			}
+		}
+		for _, index := range indexes {
+			if c, ok := columnAt(index); ok {
+				primaryKeys[c.table] = append(primaryKeys[c.table], fmt.Sprintf("%q", c.name))
+			}
+		}
+	}
+
+	var ddl strings.Builder
+	for tableIndex, tableName := range schema.TableNamesOriginal {
+		var definitions []string
+		for _, c := range columns {
+			if c.table == tableIndex {
+				definitions = append(definitions, fmt.Sprintf("    %q %s", c.name, c.kind))
+			}
+		}
+		if keys := primaryKeys[tableIndex]; len(keys) > 0 {
+			definitions = append(definitions, fmt.Sprintf("    PRIMARY KEY(%s)", strings.Join(keys, ", ")))
+		}
+		for _, foreignKey := range schema.ForeignKeys {
+			if len(foreignKey) != 2 {
+				continue
+			}
+			from, fromOk := columnAt(foreignKey[0])
+			to, toOk := columnAt(foreignKey[1])
+			if fromOk && toOk && from.table == tableIndex && to.table < len(schema.TableNamesOriginal) {
+				definitions = append(definitions, fmt.Sprintf("    FOREIGN KEY(%q) REFERENCES %q(%q)", from.name, schema.TableNamesOriginal[to.table], to.name))
+			}
+		}
+		fmt.Fprintf(&ddl, "CREATE TABLE %q (\n%s\n);\n\n", tableName, strings.Join(definitions, ",\n"))
+	}
+	return strings.TrimSpace(ddl.String()) + "\n"
+}
+
+// When there's no tables.json the DDL stored in the database itself will do
+func dumpSqliteSchema(dbFile string) (string, error) {
+	db, err := openReadOnlyDb(dbFile)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	return readSqliteSchema(db)
+}
+
+func readSqliteSchema(db *sql.DB) (string, error) {
+	rows, err := db.Query(`SELECT sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' ORDER BY CASE type WHEN 'table' THEN 0 ELSE 1 END, rowid`)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var statements []string
+	for rows.Next() {
+		var statement string
+		if err := rows.Scan(&statement); err != nil {
+			return "", err
+		}
+		statements = append(statements, statement+";")
+	}
+	return strings.Join(statements, "\n\n") + "\n", rows.Err()
+}
+
+var (
+	joinKeyword      = regexp.MustCompile(`(?i)\bJOIN\b`)
+	subqueryKeyword  = regexp.MustCompile(`(?i)\(\s*SELECT\b`)
+	aggregateKeyword = regexp.MustCompile(`(?i)\b(COUNT|SUM|AVG|MIN|MAX)\s*\(|\bGROUP\s+BY\b`)
+	negationKeyword  = regexp.MustCompile(`(?i)\bNOT\s+(IN|EXISTS|LIKE)\b|\bEXCEPT\b|!=|<>`)
+	orderingKeyword  = regexp.MustCompile(`(?i)\bORDER\s+BY\b`)
+	setOpKeyword     = regexp.MustCompile(`(?i)\b(UNION|INTERSECT|EXCEPT)\b`)
+)
+
+// Imported questions don't come with our tags so work out the obvious ones from the gold SQL
+func deriveSqlTags(sqlQuery string) []string {
+	var tags []string
+	for _, tag := range []struct {
+		name    string
+		pattern *regexp.Regexp
+	}{
+		{"aggregation", aggregateKeyword},
+		{"join", joinKeyword},
+		{"subquery", subqueryKeyword},
+		{"negation", negationKeyword},
+		{"ordering", orderingKeyword},
+		{"set-operation", setOpKeyword},
+	} {
+		if tag.pattern.MatchString(sqlQuery) {
+			tags = append(tags, tag.name)
+		}
+	}
+	return tags
+}
+
+// Write ground truth as YAML with SQL in literal blocks so it's readable and diffable
+func saveGroundTruthYaml(filename string, groundTruth []GroundTruthItem) error {
+	var document yaml.Node
+	if err := document.Encode(groundTruth); err != nil {
+		return err
+	}
+	for _, itemNode := range document.Content {
+		for j := 0; j+1 < len(itemNode.Content); j += 2 {
+			switch itemNode.Content[j].Value {
+			case "sql":
+				itemNode.Content[j+1].Style = yaml.LiteralStyle
+			case "result":
+				itemNode.Content[j+1].Style = yaml.SingleQuotedStyle
+			}
+		}
+	}
+	var content bytes.Buffer
+	encoder := yaml.NewEncoder(&content)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return err
+	}
+	encoder.Close()
+	return os.WriteFile(filename, content.Bytes(), 0644)
+}
+
+// Everything needed to write one imported database out as a dataset pack
+type importedPack struct {
+	DbId        string
+	Schema      *SpiderTableSchema
+	GroundTruth []GroundTruthItem
+}
+
+func readJsonFile(filename string, v interface{}) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	return nil
+}
+
+// Group a benchmark's questions by database, as each database becomes its own pack
+func loadBenchmarkQuestions(format string, questionsFile string) (map[string]*importedPack, error) {
+	packs := make(map[string]*importedPack)
+	packFor := func(dbId string) *importedPack {
+		if packs[dbId] == nil {
+			packs[dbId] = &importedPack{DbId: dbId}
+		}
+		return packs[dbId]
+	}
+
+	switch format {
+	case SpiderFormat:
+		var questions []SpiderQuestion
+		if err := readJsonFile(questionsFile, &questions); err != nil {
+			return nil, err
+		}
+		for i, question := range questions {
+			pack := packFor(question.DbId)
+			pack.GroundTruth = append(pack.GroundTruth, GroundTruthItem{
+				ID:    fmt.Sprintf("%s-%d", question.DbId, i),
+				Query: question.Question,
+				SQL:   strings.TrimSpace(question.Query),
+				Tags:  deriveSqlTags(question.Query),
+			})
+		}
+	case BirdFormat:
+		var questions []BirdQuestion
+		if err := readJsonFile(questionsFile, &questions); err != nil {
+			return nil, err
+		}
+		for _, question := range questions {
+			pack := packFor(question.DbId)
+			pack.GroundTruth = append(pack.GroundTruth, GroundTruthItem{
+				ID:         fmt.Sprintf("q%d", question.QuestionId),
+				Query:      question.Question,
+				Evidence:   question.Evidence,
+				SQL:        strings.TrimSpace(question.SQL),
+				Tags:       deriveSqlTags(question.SQL),
+				Difficulty: birdDifficulties[question.Difficulty],
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unknown benchmark format '%s', expected %s or %s", format, SpiderFormat, BirdFormat)
+	}
+	return packs, nil
+}
+
+// Spider and BIRD both lay databases out as <db dir>/<db_id>/<db_id>.sqlite
+func benchmarkDatabasePath(dbDir, dbId string) string {
+	return filepath.Join(dbDir, dbId, dbId+".sqlite")
+}
+
+// Copy a file by way of a temporary file, so there's never half a copy under the new name
+func copyFile(from string, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	temporary, err := os.CreateTemp(filepath.Dir(to), filepath.Base(to)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+	if _, err := io.Copy(temporary, source); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err := temporary.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), to)
+}
+
+// Write one imported database out as a pack. The pack gets its own copy of the database, so it
+// still works if the benchmark moves and nothing done with the pack can touch the benchmark's.
+func writeImportedPack(packDir string, format string, imported *importedPack, dbFile string) error {
+	if err := os.MkdirAll(packDir, 0755); err != nil {
+		return err
+	}
+
+	var schema string
+	var err error
+	if imported.Schema != nil {
+		schema = spiderSchemaToDdl(*imported.Schema)
+	} else if schema, err = dumpSqliteSchema(dbFile); err != nil {
+		return fmt.Errorf("%s: %v", dbFile, err)
+	}
+	if err := os.WriteFile(filepath.Join(packDir, "schema.sql"), []byte(schema), 0644); err != nil {
+		return err
+	}
+	if err := saveGroundTruthYaml(filepath.Join(packDir, "ground-truth.yaml"), imported.GroundTruth); err != nil {
+		return err
+	}
+
+	database := filepath.Base(dbFile)
+	if err := copyFile(dbFile, filepath.Join(packDir, database)); err != nil {
+		return err
+	}
+
+	metric := MetricSpiderExecutionAccuracy
+	if format == BirdFormat {
+		metric = MetricBirdExecutionAccuracy
+	}
+	pack := DatasetPack{
+		Name:        filepath.Base(packDir),
+		Description: fmt.Sprintf("%s database %s imported from the %s benchmark.", format, imported.DbId, format),
+		Database:    database,
+		Schema:      "schema.sql",
+		GroundTruth: "ground-truth.yaml",
+		Metric:      metric,
+	}
+	content, err := yaml.Marshal(&pack)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(packDir, PackMetadataFile), content, 0644)
+}
+
+// dataset import: turn a local copy of Spider or BIRD into one dataset pack per database
+func runImportBenchmark(args []string) int {
+	flags := flag.NewFlagSet("dataset import", flag.ExitOnError)
+	format := flags.String("format", SpiderFormat, "Benchmark format: spider or bird")
+	questionsFile := flags.String("questions", "", "Questions file, e.g. spider/dev.json or bird/dev/dev.json")
+	tablesFile := flags.String("tables", "", "Schema file, e.g. spider/tables.json or bird/dev/dev_tables.json (optional: defaults to the DDL in each database)")
+	dbDir := flags.String("db-dir", "", "Directory containing <db_id>/<db_id>.sqlite databases")
+	packsDir := flags.String("packs-dir", DefaultPacksDir, "Directory to write the imported packs to")
+	dbIds := flags.String("db", "", "Comma separated databases to import (default all)")
+	limit := flags.Int("limit", 0, "Maximum number of questions to import per database (default all)")
+	flags.Parse(args)
+
+	if *questionsFile == "" || *dbDir == "" {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	imported, err := loadBenchmarkQuestions(*format, *questionsFile)
+	if err != nil {
+		log.Fatalf("Failed to load benchmark questions: %v", err)
+	}
+	if *tablesFile != "" {
+		var schemas []SpiderTableSchema
+		if err := readJsonFile(*tablesFile, &schemas); err != nil {
+			log.Fatalf("Failed to load benchmark schemas: %v", err)
+		}
+		for i := range schemas {
+			if pack, ok := imported[schemas[i].DbId]; ok {
+				pack.Schema = &schemas[i]
+			}
+		}
+	}
+
+	wanted := make(map[string]bool)
+	for _, dbId := range strings.Split(*dbIds, ",") {
+		if dbId = strings.TrimSpace(dbId); dbId != "" {
+			wanted[dbId] = true
+		}
+	}
+
+	var names []string
+	for dbId := range imported {
+		names = append(names, dbId)
+	}
+	sort.Strings(names)
+
+	count := 0
+	for _, dbId := range names {
+		if len(wanted) > 0 && !wanted[dbId] {
+			continue
+		}
+		pack := imported[dbId]
+		if *limit > 0 && len(pack.GroundTruth) > *limit {
+			pack.GroundTruth = pack.GroundTruth[:*limit]
+		}
+		dbFile := benchmarkDatabasePath(*dbDir, dbId)
+		if _, err := os.Stat(dbFile); err != nil {
+			log.Printf("Skipping %s: %v", dbId, err)
+			continue
+		}
+		packDir := filepath.Join(*packsDir, *format+"-"+slugify(dbId))
+		if err := writeImportedPack(packDir, *format, pack, dbFile); err != nil {
+			log.Fatalf("Failed to write pack for %s: %v", dbId, err)
+		}
+		fmt.Printf("Imported %d questions for %s into %s\n", len(pack.GroundTruth), dbId, packDir)
+		count++
+	}
+	fmt.Printf("Imported %d databases; evaluate them with: run -pack all -packs-dir %s\n", count, *packsDir)
+	return ExitOk
+}
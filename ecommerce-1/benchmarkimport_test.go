@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const spiderTablesJson = `[{
+	"db_id": "concert_singer",
+	"table_names_original": ["singer", "concert"],
+	"column_names_original": [[-1, "*"], [0, "Singer_ID"], [0, "Name"], [0, "Age"], [1, "concert_ID"], [1, "Singer_ID"]],
+	"column_types": ["text", "number", "text", "number", "number", "number"],
+	"primary_keys": [1, 4],
+	"foreign_keys": [[5, 1]]
+}]`
+
+func TestSpiderSchemaToDdl(t *testing.T) {
+	var schemas []SpiderTableSchema
+	assert.NoError(t, writeAndReadJson(t, spiderTablesJson, &schemas))
+	ddl := spiderSchemaToDdl(schemas[0])
+	assert.Contains(t, ddl, "CREATE TABLE \"singer\" (\n    \"Singer_ID\" NUMERIC,\n    \"Name\" TEXT,\n    \"Age\" NUMERIC,\n    PRIMARY KEY(\"Singer_ID\")\n);")
+	assert.Contains(t, ddl, "FOREIGN KEY(\"Singer_ID\") REFERENCES \"singer\"(\"Singer_ID\")")
+
+	// the DDL has to be valid SQLite as it's the schema the model writes SQL against
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(ddl)
+	assert.NoError(t, err)
+}
+
+func TestDeriveSqlTags(t *testing.T) {
+	assert.Equal(t, []string{"aggregation", "join"}, deriveSqlTags("SELECT count(*) FROM a JOIN b ON a.id = b.a_id"))
+	assert.Equal(t, []string{"subquery", "negation"}, deriveSqlTags("SELECT name FROM a WHERE id NOT IN (SELECT a_id FROM b)"))
+	assert.Empty(t, deriveSqlTags("SELECT name FROM a"))
+}
+
+func TestImportBirdPack(t *testing.T) {
+	dir := t.TempDir()
+	dbDir := filepath.Join(dir, "dev_databases")
+	dbFile := benchmarkDatabasePath(dbDir, "california_schools")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(dbFile), 0755))
+	db, err := sql.Open("sqlite3", dbFile)
+	assert.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE schools (CDSCode TEXT PRIMARY KEY, County TEXT, Enrollment INTEGER); INSERT INTO schools VALUES ('1', 'Alameda', 100), ('2', 'Fresno', 250);`)
+	assert.NoError(t, err)
+	db.Close()
+
+	questionsFile := filepath.Join(dir, "dev.json")
+	assert.NoError(t, os.WriteFile(questionsFile, []byte(`[{"question_id": 7, "db_id": "california_schools", "question": "Which county has the largest school?", "evidence": "largest refers to MAX(Enrollment)", "SQL": "SELECT County FROM schools ORDER BY Enrollment DESC LIMIT 1", "difficulty": "moderate"}]`), 0644))
+
+	imported, err := loadBenchmarkQuestions(BirdFormat, questionsFile)
+	assert.NoError(t, err)
+	assert.Len(t, imported, 1)
+	item := imported["california_schools"].GroundTruth[0]
+	assert.Equal(t, "q7", item.ID)
+	assert.Equal(t, "largest refers to MAX(Enrollment)", item.Evidence)
+	assert.Equal(t, DifficultyMedium, item.Difficulty)
+
+	packDir := filepath.Join(dir, "packs", "bird-california-schools")
+	assert.NoError(t, writeImportedPack(packDir, BirdFormat, imported["california_schools"], dbFile))
+
+	pack, err := loadDatasetPack(packDir)
+	assert.NoError(t, err)
+	assert.Equal(t, MetricBirdExecutionAccuracy, pack.Metric)
+	schema, err := pack.SchemaSql()
+	assert.NoError(t, err)
+	assert.Contains(t, schema, "CREATE TABLE schools")
+	groundTruth, err := pack.LoadGroundTruth()
+	assert.NoError(t, err)
+	assert.Equal(t, []GroundTruthItem{item}, groundTruth)
+
+	// the pack has its own copy of the benchmark's database, which it only reads
+	assert.Equal(t, filepath.Join(packDir, "california_schools.sqlite"), pack.Path(pack.Database))
+	assert.True(t, pack.ExternalDb())
+	assert.NoError(t, os.RemoveAll(dbDir))
+	db, err = pack.OpenDb()
+	assert.NoError(t, err)
+	defer db.Close()
+	correct, err := executionAccuracyMatch(db, pack.Metric, item.SQL, "SELECT County FROM schools WHERE Enrollment = (SELECT MAX(Enrollment) FROM schools)", QueryLimits{})
+	assert.NoError(t, err)
+	assert.True(t, correct)
+
+	_, err = loadBenchmarkQuestions("wikisql", questionsFile)
+	assert.Error(t, err)
+}
+
+func writeAndReadJson(t *testing.T, content string, v interface{}) error {
+	filename := filepath.Join(t.TempDir(), "file.json")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		return err
+	}
+	return readJsonFile(filename, v)
+}
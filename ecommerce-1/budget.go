@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Estimates are rough, so only this much of a context window is filled, leaving the rest for
+// the estimates being wrong
+const PromptBudgetFill = 0.9
+
+// A part of a prompt, which can be trimmed to fit a model's context window
+type promptPart struct {
+	Name     string // says what was trimmed, e.g. "schema"
+	Text     string
+	Priority int // the part with the lowest is trimmed first
+	// what to replace the part with when it's trimmed, e.g. the schema without its indexes, or
+	// nil to drop it
+	Shorter  *promptPart
+	Required bool // never dropped, though it can still be replaced by something shorter
+}
+
+func (part *promptPart) trimmable() bool {
+	return part.Shorter != nil || !part.Required
+}
+
+// Fit the parts of a prompt into a context window, leaving room for the completion, by trimming
+// the least important first: replacing them with something shorter if they have it, otherwise
+// dropping them. The parts stay in the order given. What was trimmed is returned to be logged,
+// and fits is false if the parts are still too big once everything that can be trimmed has
+// been, in which case the prompt's sent as it is and the provider can truncate or refuse it.
+// A contextWindow of 0 is unlimited.
+func fitPrompt(parts []promptPart, contextWindow int, completionTokens int) (prompt string, trimmed []string, fits bool) {
+	budget := int(float64(contextWindow)*PromptBudgetFill) - completionTokens
+	kept := make([]*promptPart, len(parts))
+	total := 0
+	for i := range parts {
+		kept[i] = &parts[i]
+		total += estimateTokens(parts[i].Text)
+	}
+	for contextWindow > 0 && total > budget {
+		trim := -1
+		for i, part := range kept {
+			if part != nil && part.trimmable() && (trim == -1 || part.Priority < kept[trim].Priority) {
+				trim = i
+			}
+		}
+		if trim == -1 {
+			break
+		}
+		part := kept[trim]
+		total -= estimateTokens(part.Text)
+		if part.Shorter != nil {
+			total += estimateTokens(part.Shorter.Text)
+			trimmed = append(trimmed, fmt.Sprintf("%s replaced by %s", part.Name, part.Shorter.Name))
+		} else {
+			trimmed = append(trimmed, "dropped "+part.Name)
+		}
+		kept[trim] = part.Shorter
+	}
+
+	var joined strings.Builder
+	for _, part := range kept {
+		if part != nil {
+			joined.WriteString(part.Text)
+		}
+	}
+	return joined.String(), trimmed, contextWindow <= 0 || total <= budget
+}
+
+// The parts of the generator's prompt and how they're trimmed. Older failed attempts go first
+// and then the schema's indexes and comments, which the model can do without, before any
+// examples, the columns' constraints, hints, the last failed attempt, the glossary and finally
+// the columns' types.
+// The instructions and question are never trimmed.
+func (prompt *SqlPrompt) parts(failedAttempts []FailedSqlQueryAttempt) []promptPart {
+	withoutIndexes := schemaWithoutIndexes(prompt.Schema)
+	schema := promptPart{Name: "schema", Text: prompt.Schema, Priority: 20, Required: true,
+		Shorter: &promptPart{Name: "schema without indexes or comments", Text: withoutIndexes, Priority: 40, Required: true,
+			Shorter: &promptPart{Name: "schema of columns and keys", Text: compactSchema(withoutIndexes, true), Priority: 60, Required: true,
+				Shorter: &promptPart{Name: "schema of column names", Text: compactSchema(withoutIndexes, false), Required: true}}}}
+
+	// each trim drops the oldest attempt, so the model always knows what went wrong last
+	var attempts *promptPart
+	for i := range failedAttempts {
+		name := fmt.Sprintf("%d failed attempts", len(failedAttempts)-i)
+		if i == len(failedAttempts)-1 {
+			name = "last failed attempt"
+		}
+		priority := 10
+		if i == len(failedAttempts)-1 {
+			priority = 50
+		}
+		part := &promptPart{Name: name, Text: failedAttemptsPrompt(failedAttempts[i:]), Priority: priority}
+		if attempts == nil {
+			attempts = part
+		} else {
+			shorter := attempts
+			for shorter.Shorter != nil {
+				shorter = shorter.Shorter
+			}
+			shorter.Shorter = part
+		}
+	}
+
+	parts := []promptPart{{Name: "instructions", Text: prompt.Instructions, Required: true}, schema}
+	if prompt.Hints != "" {
+		parts = append(parts, promptPart{Name: "hints", Text: prompt.Hints, Priority: 45})
+	}
+	if prompt.Glossary != "" {
+		parts = append(parts, promptPart{Name: "glossary", Text: prompt.Glossary, Priority: 55})
+	}
+	if prompt.Examples != "" {
+		parts = append(parts, promptPart{Name: "examples", Text: prompt.Examples, Priority: 30})
+	}
+	if attempts != nil {
+		parts = append(parts, *attempts)
+	}
+	return append(parts, promptPart{Name: "question", Text: "\n" + prompt.Question, Required: true})
+}
+
+func failedAttemptsPrompt(failedAttempts []FailedSqlQueryAttempt) string {
+	prompt := "\nTake into account the following past failed attempts at generating a new SQL query that avoids the same errors:\n"
+	for _, attempt := range failedAttempts {
+		prompt += fmt.Sprintf("- Generated failed sql query: '%s';\nError message explaining why it failed:\n'%s'\n", standardizeSpaces(attempt.SqlQuery), strings.ReplaceAll(attempt.ErrorMessage, "\n", " "))
+	}
+	return prompt
+}
+
+// Whether a statement starts with the words given, e.g. CREATE TABLE
+func sqlStatementStartsWith(tokens []sqlToken, words ...string) bool {
+	i := nextSqlToken(tokens, -1)
+	for _, word := range words {
+		if i >= len(tokens) || !tokens[i].is(word) {
+			return false
+		}
+		i = nextSqlToken(tokens, i)
+	}
+	return true
+}
+
+func isSqlComment(token sqlToken) bool {
+	return token.Kind == sqlSpace && (strings.HasPrefix(token.Text, "--") || strings.HasPrefix(token.Text, "/*"))
+}
+
+// A schema without its indexes, triggers and comments, none of which help write a query
+func schemaWithoutIndexes(schema string) string {
+	var statements []string
+	for _, statement := range splitSqlStatements(schema) {
+		tokens := tokeniseSql(statement.Sql)
+		if sqlStatementStartsWith(tokens, "CREATE", "INDEX") || sqlStatementStartsWith(tokens, "CREATE", "UNIQUE", "INDEX") || sqlStatementStartsWith(tokens, "CREATE", "TRIGGER") {
+			continue
+		}
+		var uncommented []sqlToken
+		for _, token := range tokens {
+			if !isSqlComment(token) {
+				uncommented = append(uncommented, token)
+			}
+		}
+		var lines []string
+		for _, line := range strings.Split(joinSqlTokens(uncommented), "\n") {
+			if strings.TrimSpace(line) != "" {
+				lines = append(lines, strings.TrimRight(line, " \t"))
+			}
+		}
+		if len(lines) > 0 {
+			statements = append(statements, strings.Join(lines, "\n"))
+		}
+	}
+	return strings.Join(statements, "\n") + "\n"
+}
+
+// Words that end a column's type and start its constraints
+var sqlColumnConstraints = []string{"CONSTRAINT", "PRIMARY", "NOT", "NULL", "UNIQUE", "CHECK", "DEFAULT", "COLLATE", "REFERENCES", "GENERATED", "AS"}
+
+func isSqlColumnConstraint(token sqlToken) bool {
+	for _, word := range sqlColumnConstraints {
+		if token.is(word) {
+			return true
+		}
+	}
+	return false
+}
+
+// The tokens that aren't whitespace or comments, as single spaced SQL
+func compactSqlTokens(tokens []sqlToken) string {
+	var words []string
+	for _, token := range tokens {
+		if token.Kind != sqlSpace {
+			words = append(words, token.Text)
+		}
+	}
+	compact := strings.Join(words, " ")
+	for _, tight := range [][2]string{{" ( ", "("}, {" (", "("}, {" )", ")"}, {" ,", ","}, {" .", "."}, {". ", "."}} {
+		compact = strings.ReplaceAll(compact, tight[0], tight[1])
+	}
+	return compact
+}
+
+// A table's columns on one line, with their types, primary and foreign keys if withTypes, else
+// just their names, e.g. Orders(id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES Customers(id)).
+// ok is false if the statement isn't a CREATE TABLE with columns.
+func compactCreateTable(statement string, withTypes bool) (compact string, ok bool) {
+	tokens := tokeniseSql(statement)
+	if !sqlStatementStartsWith(tokens, "CREATE", "TABLE") && !sqlStatementStartsWith(tokens, "CREATE", "TEMP", "TABLE") && !sqlStatementStartsWith(tokens, "CREATE", "TEMPORARY", "TABLE") {
+		return "", false
+	}
+	open := -1
+	for i, token := range tokens {
+		if token.Kind == sqlPunct && token.Text == "(" {
+			open = i
+			break
+		}
+		if token.is("AS") {
+			return "", false // CREATE TABLE ... AS SELECT has no columns to list
+		}
+	}
+	if open == -1 {
+		return "", false
+	}
+	close := closingSqlBracket(tokens, open)
+	if close == -1 {
+		return "", false
+	}
+	// the name's the last word before the bracket, after CREATE TABLE IF NOT EXISTS and the like
+	name := tokens[previousSqlToken(tokens, open)].Text
+	if dot := previousSqlToken(tokens, previousSqlToken(tokens, open)); dot >= 0 && tokens[dot].Text == "." {
+		name = tokens[previousSqlToken(tokens, dot)].Text + "." + name
+	}
+
+	var columns []string
+	for _, definition := range sqlCallArguments(tokens, open, close) {
+		var words []sqlToken
+		for _, token := range definition {
+			if token.Kind != sqlSpace {
+				words = append(words, token)
+			}
+		}
+		if len(words) == 0 {
+			continue
+		}
+		// table constraints: the keys are worth keeping, CHECK and UNIQUE aren't
+		if isSqlColumnConstraint(words[0]) || words[0].is("FOREIGN") {
+			if withTypes && (words[0].is("PRIMARY") || words[0].is("FOREIGN")) {
+				columns = append(columns, compactSqlTokens(words))
+			}
+			continue
+		}
+		column := words[0].Text
+		if !withTypes {
+			columns = append(columns, column)
+			continue
+		}
+		typeEnd := 1
+		for typeEnd < len(words) && !isSqlColumnConstraint(words[typeEnd]) {
+			typeEnd++
+		}
+		if typeEnd > 1 {
+			column += " " + compactSqlTokens(words[1:typeEnd])
+		}
+		for i := typeEnd; i < len(words); i++ {
+			switch {
+			case words[i].is("PRIMARY"):
+				column += " PRIMARY KEY"
+			case words[i].is("REFERENCES"):
+				// REFERENCES table, with its columns if they're given
+				end := i + 2
+				if end < len(words) && words[end].Text == "(" {
+					for end < len(words) && words[end].Text != ")" {
+						end++
+					}
+					end++
+				}
+				column += " " + compactSqlTokens(words[i:min(end, len(words))])
+			}
+		}
+		columns = append(columns, column)
+	}
+	return name + "(" + strings.Join(columns, ", ") + ")", true
+}
+
+// A schema as one line per table, see compactCreateTable. Anything other than tables, like
+// views, is kept as it is.
+func compactSchema(schema string, withTypes bool) string {
+	var lines []string
+	for _, statement := range splitSqlStatements(schema) {
+		if compact, ok := compactCreateTable(statement.Sql, withTypes); ok {
+			lines = append(lines, compact)
+		} else {
+			lines = append(lines, statement.Sql)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
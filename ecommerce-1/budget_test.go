@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const budgetTestSchema = `-- customers and what they ordered
+CREATE TABLE IF NOT EXISTS Customers (
+    id INTEGER PRIMARY KEY, -- the customer number
+    name VARCHAR(100) NOT NULL
+);
+CREATE TABLE Orders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_id INTEGER NOT NULL REFERENCES Customers(id),
+    status TEXT CHECK (status IN ('pending', 'shipped')) DEFAULT 'pending',
+    UNIQUE (customer_id, id)
+);
+CREATE INDEX idx_orders_customer ON Orders(customer_id);
+`
+
+func TestSchemaSummaries(t *testing.T) {
+	withoutIndexes := schemaWithoutIndexes(budgetTestSchema)
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS Customers (
+    id INTEGER PRIMARY KEY,
+    name VARCHAR(100) NOT NULL
+);
+CREATE TABLE Orders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_id INTEGER NOT NULL REFERENCES Customers(id),
+    status TEXT CHECK (status IN ('pending', 'shipped')) DEFAULT 'pending',
+    UNIQUE (customer_id, id)
+);
+`, withoutIndexes)
+	assert.Equal(t, `Customers(id INTEGER PRIMARY KEY, name VARCHAR(100))
+Orders(id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES Customers(id), status TEXT)
+`, compactSchema(withoutIndexes, true))
+	assert.Equal(t, "Customers(id, name)\nOrders(id, customer_id, status)\n", compactSchema(withoutIndexes, false))
+
+	// table keys are kept with the types, and anything that isn't a table is left alone
+	compact, ok := compactCreateTable(`CREATE TABLE "Order Items" (order_id INT, product_id INT, PRIMARY KEY (order_id, product_id), FOREIGN KEY (order_id) REFERENCES Orders (id))`, true)
+	assert.True(t, ok)
+	assert.Equal(t, `"Order Items"(order_id INT, product_id INT, PRIMARY KEY(order_id, product_id), FOREIGN KEY(order_id) REFERENCES Orders(id))`, compact)
+	_, ok = compactCreateTable("CREATE TABLE Copy AS SELECT * FROM Orders", true)
+	assert.False(t, ok)
+	assert.Equal(t, "CREATE VIEW Shipped AS SELECT * FROM Orders WHERE status = 'shipped';\n", compactSchema("CREATE VIEW Shipped AS SELECT * FROM Orders WHERE status = 'shipped';", true))
+}
+
+func TestFitPrompt(t *testing.T) {
+	parts := func() []promptPart {
+		return []promptPart{
+			{Name: "instructions", Text: "Write SQL. ", Required: true},
+			{Name: "long", Text: strings.Repeat("word ", 50), Priority: 20, Shorter: &promptPart{Name: "short", Text: "word word ", Priority: 40}},
+			{Name: "examples", Text: strings.Repeat("example ", 20), Priority: 30},
+			{Name: "question", Text: "How many?", Required: true},
+		}
+	}
+	// 3 + 50 + 20 + 3 tokens
+	prompt, trimmed, fits := fitPrompt(parts(), 0, 100)
+	assert.True(t, fits)
+	assert.Empty(t, trimmed)
+	assert.Equal(t, 76, estimateTokens(prompt))
+	_, trimmed, fits = fitPrompt(parts(), 200, 100)
+	assert.True(t, fits)
+	assert.Empty(t, trimmed)
+
+	// the lowest priority goes first, then what it was replaced with can go in turn
+	prompt, trimmed, fits = fitPrompt(parts(), 150, 100)
+	assert.True(t, fits)
+	assert.Equal(t, []string{"long replaced by short"}, trimmed)
+	assert.Equal(t, "Write SQL. word word "+strings.Repeat("example ", 20)+"How many?", prompt)
+	prompt, trimmed, fits = fitPrompt(parts(), 120, 100)
+	assert.True(t, fits)
+	assert.Equal(t, []string{"long replaced by short", "dropped examples"}, trimmed)
+	assert.Equal(t, "Write SQL. word word How many?", prompt)
+
+	// what's required is kept even when it doesn't fit
+	prompt, trimmed, fits = fitPrompt(parts(), 105, 100)
+	assert.False(t, fits)
+	assert.Equal(t, []string{"long replaced by short", "dropped examples", "dropped short"}, trimmed)
+	assert.Equal(t, "Write SQL. How many?", prompt)
+}
+
+func TestSqlPromptParts(t *testing.T) {
+	prompt := SqlPrompt{Instructions: "Write SQLite.\n", Schema: budgetTestSchema, Hints: "\nValues: Orders.status is one of 'pending', 'shipped'\n",
+		Examples: "\nEarlier: how many customers?\n", Question: "How many orders?"}
+	failedAttempts := []FailedSqlQueryAttempt{
+		{SqlQuery: "SELECT COUNT(*) FROM Order", ErrorMessage: "no such table: Order"},
+		{SqlQuery: "SELECT COUNT(*) FROM orders o JOIN", ErrorMessage: "incomplete input"},
+	}
+	full, trimmed, fits := fitPrompt(prompt.parts(failedAttempts), 0, 200)
+	assert.True(t, fits)
+	assert.Empty(t, trimmed)
+	// the same prompt the generator's always been given
+	assert.Equal(t, "Write SQLite.\n"+budgetTestSchema+"\nValues: Orders.status is one of 'pending', 'shipped'\n"+"\nEarlier: how many customers?\n"+
+		"\nTake into account the following past failed attempts at generating a new SQL query that avoids the same errors:\n"+
+		"- Generated failed sql query: 'SELECT COUNT(*) FROM Order';\nError message explaining why it failed:\n'no such table: Order'\n"+
+		"- Generated failed sql query: 'SELECT COUNT(*) FROM orders o JOIN';\nError message explaining why it failed:\n'incomplete input'\n"+
+		"\nHow many orders?", full)
+
+	// trimmed in order until only what's required is left
+	_, trimmed, fits = fitPrompt(prompt.parts(failedAttempts), 1000, 990)
+	assert.False(t, fits)
+	assert.Equal(t, []string{
+		"2 failed attempts replaced by last failed attempt",
+		"schema replaced by schema without indexes or comments",
+		"dropped examples",
+		"schema without indexes or comments replaced by schema of columns and keys",
+		"dropped hints",
+		"dropped last failed attempt",
+		"schema of columns and keys replaced by schema of column names",
+	}, trimmed)
+}
+
+func TestPredictTrimsPromptToContextWindow(t *testing.T) {
+	model := &scriptedModel{responses: []string{"SELECT COUNT(*) FROM Orders"}}
+	maxTokens := 100
+	prompt := SqlPrompt{Instructions: "Write SQLite.\n", Schema: budgetTestSchema, Question: "How many orders?"}
+	sqlQuery, _, err := predictSqlQueryFromNaturalLanguageQuery(context.Background(), model, &maxTokens, 200, prompt, NoSeed, nil, Streaming{})
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT COUNT(*) FROM Orders", sqlQuery)
+	assert.Equal(t, []string{"Write SQLite.\nCustomers(id INTEGER PRIMARY KEY, name VARCHAR(100))\nOrders(id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES Customers(id), status TEXT)\n\nHow many orders?"}, model.prompts)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Exit codes every command uses
+const (
+	ExitOk      = 0
+	ExitFailure = 1 // the command ran but what it checked failed, or it hit an error (log.Fatalf exits with 1 too)
+	ExitUsage   = 2 // bad arguments, the same code flag uses
+)
+
+type cliCommand struct {
+	Name    string
+	Summary string
+	Run     func(args []string) int
+	Hidden  bool // kept so old scripts work, but not listed
+}
+
+var cliCommands []cliCommand
+
+// Set up in init as help refers back to the list
+func init() {
+	cliCommands = []cliCommand{
+		{Name: "run", Summary: "run the benchmark: every model over the ground truth of one or more dataset packs", Run: runBenchmark},
+		{Name: "ask", Summary: "ask one question against a pack's or any SQLite database and print the SQL and its result", Run: runAsk},
+		{Name: "repl", Summary: "ask questions interactively, refining them with follow-ups, and export them as ground truth", Run: runRepl},
+		{Name: "serve", Summary: "serve generation, querying and comparison as an HTTP API (see openapi.yaml)", Run: runServe},
+		{Name: "mcp", Summary: "serve the database and generator as Model Context Protocol tools over stdio", Run: runMcp},
+		{Name: "judge", Summary: "compare two SQL queries with the evaluator; exits 1 if they don't match", Run: runJudge},
+		{Name: "judge-eval", Summary: "calibrate the evaluator against a labelled dataset of SQL pairs", Run: runJudgeEval},
+		{Name: "report", Summary: "render saved benchmark runs, by default the latest", Run: runReport},
+		{Name: "dataset", Summary: "check, convert and build dataset packs", Run: runDataset},
+		{Name: "help", Summary: "show this help", Run: runHelp},
+		// the names these used to have
+		{Name: "regenerate-results", Run: runRegenerateResults, Hidden: true},
+		{Name: "import-benchmark", Run: runImportBenchmark, Hidden: true},
+		{Name: "generate-data", Run: runGenerateData, Hidden: true},
+	}
+}
+
+var datasetCommands = []cliCommand{
+	{Name: "validate", Summary: "check packs load, their databases build and their stored results are current", Run: runDatasetValidate},
+	{Name: "convert", Summary: "convert ground truth between formats (.md, .csv, .jsonl in; .yaml, .jsonl out)", Run: runDatasetConvert},
+	{Name: "regenerate", Summary: "re-run the gold SQL to refresh the stored results", Run: runRegenerateResults},
+	{Name: "import", Summary: "turn a local copy of Spider or BIRD into dataset packs", Run: runImportBenchmark},
+	{Name: "generate", Summary: "print the sample data a seed spec generates", Run: runGenerateData},
+}
+
+func findCliCommand(commands []cliCommand, name string) *cliCommand {
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func printCliUsage(w io.Writer, prefix string, commands []cliCommand) {
+	fmt.Fprintf(w, "Usage: %s <command> [arguments]\n\nCommands:\n", prefix)
+	for _, command := range commands {
+		if !command.Hidden {
+			fmt.Fprintf(w, "  %-12s %s\n", command.Name, command.Summary)
+		}
+	}
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for a command's flags.\n", prefix)
+}
+
+// Dispatch to a command. With no command, or flags straight away as before there were
+// commands, the benchmark runs.
+func runCli(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runBenchmark(args)
+	}
+	command := findCliCommand(cliCommands, args[0])
+	if command == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command '%s'\n\n", args[0])
+		printCliUsage(os.Stderr, filepath.Base(os.Args[0]), cliCommands)
+		return ExitUsage
+	}
+	return command.Run(args[1:])
+}
+
+func runHelp(args []string) int {
+	printCliUsage(os.Stdout, filepath.Base(os.Args[0]), cliCommands)
+	return ExitOk
+}
+
+func runDataset(args []string) int {
+	if len(args) == 0 {
+		printCliUsage(os.Stderr, filepath.Base(os.Args[0])+" dataset", datasetCommands)
+		return ExitUsage
+	}
+	command := findCliCommand(datasetCommands, args[0])
+	if command == nil {
+		fmt.Fprintf(os.Stderr, "Unknown dataset command '%s'\n\n", args[0])
+		printCliUsage(os.Stderr, filepath.Base(os.Args[0])+" dataset", datasetCommands)
+		return ExitUsage
+	}
+	return command.Run(args[1:])
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunCliDispatch(t *testing.T) {
+	assert.Equal(t, ExitUsage, runCli([]string{"nope"}))
+	assert.Equal(t, ExitUsage, runCli([]string{"dataset"}))
+	assert.Equal(t, ExitUsage, runCli([]string{"dataset", "nope"}))
+	assert.Equal(t, ExitOk, runCli([]string{"help"}))
+	// missing arguments are usage errors rather than failures
+	assert.Equal(t, ExitUsage, runCli([]string{"judge", "SELECT 1"}))
+	assert.Equal(t, ExitUsage, runCli([]string{"ask"}))
+	assert.Equal(t, ExitUsage, runCli([]string{"dataset", "convert", "-in", "ground-truth.md", "-out", "ground-truth.txt"}))
+	assert.Equal(t, ExitUsage, runCli([]string{"report", "-format", "pdf"}))
+	// as are flag values that aren't allowed, before anything's opened
+	assert.Equal(t, ExitUsage, runCli([]string{"run", "-dialect", "oracle"}))
+	assert.Equal(t, ExitUsage, runCli([]string{"run", "-snapshot", "never"}))
+	assert.Equal(t, ExitUsage, runCli([]string{"ask", "-schema-linking", "guess", "How many customers are there?"}))
+	assert.Equal(t, ExitUsage, runCli([]string{"ask", "-model", "llama3", "How many customers are there?"}))
+	assert.Equal(t, ExitUsage, runCli([]string{"serve", "-evaluator", "llama3"}))
+	assert.Equal(t, ExitUsage, runCli([]string{"judge-eval", "-evaluator", "llama3"}))
+}
+
+func TestRunDatasetConvertAndValidate(t *testing.T) {
+	dir := t.TempDir()
+	converted := filepath.Join(dir, "ground-truth.yaml")
+	assert.Equal(t, ExitOk, runCli([]string{"dataset", "convert", "-in", filepath.Join(DefaultPacksDir, DefaultPack, "ground-truth.md"), "-out", converted}))
+	groundTruth, err := loadGroundTruth(converted)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, groundTruth)
+
+	invalid := filepath.Join(dir, "invalid.jsonl")
+	assert.NoError(t, os.WriteFile(invalid, []byte(`{"id": "no-sql", "question": "How many customers are there?"}`+"\n"), 0644))
+	assert.Equal(t, ExitOk, runCli([]string{"dataset", "validate", converted}))
+	assert.Equal(t, ExitFailure, runCli([]string{"dataset", "validate", converted, invalid}))
+	assert.Equal(t, ExitOk, runCli([]string{"dataset", "validate", "-pack", DefaultPack}))
+}
+
+func TestPrintRunReport(t *testing.T) {
+	started := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	record := &RunRecord{
+		StartedAt: started, FinishedAt: started.Add(90 * time.Second), Seed: 42, Evaluator: "Ollama/OpenAI : llama3", Dialect: DialectSQLite, SchemaLinking: SchemaLinkingLexical,
+		Packs: []*PackRunRecord{{Pack: "ecommerce", Models: []*ModelRunRecord{{
+			Name: "Ollama/OpenAI", Model: "llama3", Price: &ModelPrice{InputPerMillion: 1, OutputPerMillion: 2}, EvaluatorPrice: &ModelPrice{InputPerMillion: 0.5, OutputPerMillion: 1},
+			Questions: []*QuestionRecord{
+				{ID: "customer-count", Executed: true, Correct: true, Outcome: QueryOutcomeOk, PromptTokens: 900, CompletionTokens: 20, Cost: 0.00094,
+					EvaluatorPromptTokens: 600, EvaluatorCompletionTokens: 2, EvaluatorCost: 0.000302,
+					Tags: []string{"aggregation"}, Difficulty: DifficultyEasy},
+				{ID: "most-profitable-product", Executed: true, Outcome: QueryOutcomeOk, DialectIssues: []string{"ilike"}, PromptTokens: 1000, CompletionTokens: 40, TokensEstimated: true, Cost: 0.00108,
+					LinkedTables: []string{"Products", "Order_Products"}, GoldTables: []string{"Order_Products", "Orders", "Products"},
+					Tags: []string{"aggregation", "join"}, Difficulty: DifficultyHard},
+				{ID: "shipped-orders", Outcome: QueryOutcomeTimeout, Tags: []string{"filter"}},
+			},
+		}}}},
+	}
+	resultsDir := t.TempDir()
+	filename, err := saveRunRecord(resultsDir, record)
+	assert.NoError(t, err)
+	latest, err := latestRunRecordFile(resultsDir)
+	assert.NoError(t, err)
+	assert.Equal(t, filename, latest)
+	loaded, err := loadRunRecord(latest)
+	assert.NoError(t, err)
+
+	var report bytes.Buffer
+	assert.NoError(t, printRunReport(&report, loaded, ReportFormatMarkdown, true))
+	assert.Equal(t, `# Run 2024-06-01 10:00:00 (1m30s), seed 42, evaluator Ollama/OpenAI : llama3, dialect sqlite, schema linking lexical
+
+## Pack: ecommerce
+
+| Model | Correct | Accuracy | Timed out | Truncated | Plan cost (gold) | Tokens | Cost (per correct) | Evaluator tokens (cost) | Schema recall | Dialect issues |
+| --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- |
+| Ollama/OpenAI : llama3 | 1/3 | 33% | 1 | 0 | - | ~2.0k | $0.00202 ($0.00202) | 602 ($0.00030) | 67% | ilike 1 |
+
+| Model | By difficulty | By tag |
+| --- | --- | --- |
+| Ollama/OpenAI : llama3 | easy 1/1, hard 0/1 | aggregation 1/2, filter 0/1, join 0/1 |
+
+| Question | llama3 |
+| --- | --- |
+| customer-count | correct |
+| most-profitable-product | wrong |
+| shipped-orders | timeout |
+`, report.String())
+
+	report.Reset()
+	assert.NoError(t, printRunReport(&report, loaded, ReportFormatText, false))
+	assert.Contains(t, report.String(), "1/3 correct (1 timed out, 0 truncated), schema linking recall 67% over 1")
+	assert.Contains(t, report.String(), "~2.0k tokens (1.9k prompt), $0.00202, $0.00202 per correct answer")
+	assert.Contains(t, report.String(), "evaluator 602 tokens, $0.00030\n")
+	assert.Contains(t, report.String(), "by difficulty: easy 1/1, hard 0/1\n")
+	assert.Contains(t, report.String(), "by tag: aggregation 1/2, filter 0/1, join 0/1\n")
+	assert.Error(t, printRunReport(&report, loaded, "pdf", false))
+
+	_, err = latestRunRecordFile(t.TempDir())
+	assert.Error(t, err)
+}
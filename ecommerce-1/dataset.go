@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// Check a pack end to end: its ground truth loads, its database builds and matches the schema,
+// and every gold query runs and still gives the stored result. Returns the problems found.
+func validateDatasetPack(pack *DatasetPack) []string {
+	groundTruth, err := pack.LoadGroundTruth()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	db, err := pack.OpenDb()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	defer db.Close()
+
+	var problems []string
+	if _, err := pack.LoadGlossary(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, check := range checkGroundTruthResults(db, groundTruth) {
+		switch {
+		case check.Err != nil:
+			problems = append(problems, fmt.Sprintf("%s: gold SQL fails: %v", check.ID, check.Err))
+		case check.Stored == "":
+			problems = append(problems, fmt.Sprintf("%s: no stored result", check.ID))
+		case check.Changed():
+			problems = append(problems, fmt.Sprintf("%s: stored result is stale", check.ID))
+		}
+	}
+	return problems
+}
+
+// dataset validate: check packs, or ground truth files on their own, exiting non-zero if anything's wrong
+func runDatasetValidate(args []string) int {
+	flags := flag.NewFlagSet("dataset validate", flag.ExitOnError)
+	packsDir := flags.String("packs-dir", DefaultPacksDir, "Directory containing dataset packs")
+	packNames := flags.String("pack", "all", "Comma separated dataset packs to validate, or 'all'")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: dataset validate [flags] [ground truth files]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	exitCode := ExitOk
+	report := func(name string, problems []string) {
+		if len(problems) == 0 {
+			fmt.Printf("%sOK%s     %s\n", boldGreen, reset, name)
+			return
+		}
+		exitCode = ExitFailure
+		fmt.Printf("%sINVALID%s %s\n- %s\n", boldRed, reset, name, strings.Join(problems, "\n- "))
+	}
+
+	// files are checked on their own, without a database
+	if flags.NArg() > 0 {
+		for _, filename := range flags.Args() {
+			var problems []string
+			if _, err := loadGroundTruth(filename); err != nil {
+				problems = append(problems, err.Error())
+			}
+			report(filename, problems)
+		}
+		return exitCode
+	}
+
+	packs, err := findDatasetPacks(*packsDir, *packNames)
+	if err != nil {
+		log.Fatalf("Failed to find dataset packs: %v", err)
+	}
+	for _, pack := range packs {
+		report(pack.Name, validateDatasetPack(pack))
+	}
+	return exitCode
+}
+
+// dataset convert: rewrite ground truth in another format, e.g. an old ground-truth.md as YAML
+func runDatasetConvert(args []string) int {
+	flags := flag.NewFlagSet("dataset convert", flag.ExitOnError)
+	inFile := flags.String("in", "", "Ground truth to convert: .yaml, .jsonl, .md or .csv")
+	outFile := flags.String("out", "", "File to write: .yaml or .jsonl")
+	flags.Parse(args)
+
+	outFormat := strings.ToLower(filepath.Ext(*outFile))
+	if *inFile == "" || (outFormat != ".yaml" && outFormat != ".yml" && outFormat != ".jsonl") {
+		flags.Usage()
+		return ExitUsage
+	}
+	groundTruth, err := loadGroundTruth(*inFile)
+	if err != nil {
+		log.Fatalf("Failed to load ground truth: %v", err)
+	}
+	if err := saveGroundTruth(*outFile, groundTruth); err != nil {
+		log.Fatalf("Failed to write %s: %v", *outFile, err)
+	}
+	fmt.Printf("Converted %d items from %s to %s\n", len(groundTruth), *inFile, *outFile)
+	return ExitOk
+}
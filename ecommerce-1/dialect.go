@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// SQL dialects the generator can be asked to write. Packs are SQLite databases, so whatever the
+// dialect, what the model writes is translated to SQLite (see translateToSqlite) before it runs.
+const (
+	DialectSQLite     = "sqlite"
+	DialectPostgreSQL = "postgresql"
+	DialectMySQL      = "mysql"
+	DefaultDialect    = DialectSQLite
+)
+
+var dialectNames = map[string]string{
+	DialectSQLite:     "SQLite",
+	DialectPostgreSQL: "PostgreSQL",
+	DialectMySQL:      "MySQL",
+}
+
+func validDialect(dialect string) bool {
+	_, ok := dialectNames[dialect]
+	return ok
+}
+
+// What the generator is told about the dialect, mostly the things models get wrong
+var dialectInstructions = map[string]string{
+	DialectSQLite: "Use LIKE rather than ILIKE (LIKE is already case insensitive), CAST(x AS type) rather than x::type, " +
+		"strftime() and date() for dates rather than EXTRACT, DATE_TRUNC, NOW() or INTERVAL, and GROUP_CONCAT rather than STRING_AGG.",
+	DialectPostgreSQL: "Use EXTRACT and DATE_TRUNC for dates rather than strftime(), COALESCE rather than IFNULL, " +
+		"CASE rather than IIF, STRING_AGG rather than GROUP_CONCAT and LIMIT n OFFSET m rather than LIMIT m, n.",
+	DialectMySQL: "Quote identifiers with backticks rather than double quotes, use CONCAT() rather than || to join strings, " +
+		"and DATE_FORMAT() or EXTRACT for dates rather than strftime().",
+}
+
+// Added to the generator's system prompt, before the schema
+func dialectPrompt(dialect string) string {
+	return fmt.Sprintf("Write SQL in the %s dialect. %s\n", dialectNames[dialect], dialectInstructions[dialect])
+}
+
+// A construct that only some dialects have, found by looking at tokens rather than parsing,
+// which is plenty for spotting a model writing the wrong dialect
+type dialectRule struct {
+	Construct   string   // short name used in reports, e.g. "ilike"
+	Description string   // e.g. "ILIKE"
+	ValidIn     []string // the dialects that accept it
+	match       func(tokens []sqlToken, i int) bool
+}
+
+func wordRule(word string) func(tokens []sqlToken, i int) bool {
+	return func(tokens []sqlToken, i int) bool { return tokens[i].is(word) }
+}
+
+func callRule(name string) func(tokens []sqlToken, i int) bool {
+	return func(tokens []sqlToken, i int) bool { return isSqlCall(tokens, i, name) }
+}
+
+func punctRule(punct string) func(tokens []sqlToken, i int) bool {
+	return func(tokens []sqlToken, i int) bool { return tokens[i].Kind == sqlPunct && tokens[i].Text == punct }
+}
+
+func quoteRule(quote byte) func(tokens []sqlToken, i int) bool {
+	return func(tokens []sqlToken, i int) bool {
+		return tokens[i].Kind == sqlQuotedIdentifier && tokens[i].Text[0] == quote
+	}
+}
+
+var dialectRules = []dialectRule{
+	{"ilike", "ILIKE", []string{DialectPostgreSQL}, wordRule("ILIKE")},
+	{"cast-operator", "the :: cast operator", []string{DialectPostgreSQL}, punctRule("::")},
+	{"extract", "EXTRACT(field FROM date)", []string{DialectPostgreSQL, DialectMySQL}, callRule("EXTRACT")},
+	{"now", "NOW()", []string{DialectPostgreSQL, DialectMySQL}, callRule("NOW")},
+	{"date-trunc", "DATE_TRUNC()", []string{DialectPostgreSQL}, callRule("DATE_TRUNC")},
+	{"date-format", "DATE_FORMAT()", []string{DialectMySQL}, callRule("DATE_FORMAT")},
+	{"interval", "INTERVAL arithmetic", []string{DialectPostgreSQL, DialectMySQL}, func(tokens []sqlToken, i int) bool {
+		next := nextSqlToken(tokens, i)
+		return tokens[i].is("INTERVAL") && next < len(tokens) && (tokens[next].Kind == sqlString || tokens[next].Kind == sqlNumber)
+	}},
+	{"if", "IF()", []string{DialectMySQL}, callRule("IF")},
+	{"iif", "IIF()", []string{DialectSQLite}, callRule("IIF")},
+	{"ifnull", "IFNULL()", []string{DialectSQLite, DialectMySQL}, callRule("IFNULL")},
+	{"strftime", "strftime()", []string{DialectSQLite}, callRule("STRFTIME")},
+	{"julianday", "julianday()", []string{DialectSQLite}, callRule("JULIANDAY")},
+	{"group-concat", "GROUP_CONCAT()", []string{DialectSQLite, DialectMySQL}, callRule("GROUP_CONCAT")},
+	{"string-agg", "STRING_AGG()", []string{DialectPostgreSQL}, callRule("STRING_AGG")},
+	{"concat-operator", "|| to join strings", []string{DialectSQLite, DialectPostgreSQL}, punctRule("||")},
+	{"backtick-identifier", "`quoted` identifiers", []string{DialectSQLite, DialectMySQL}, quoteRule('`')},
+	{"double-quoted-identifier", `"quoted" identifiers`, []string{DialectSQLite, DialectPostgreSQL}, quoteRule('"')},
+	{"bracket-identifier", "[quoted] identifiers", []string{DialectSQLite}, quoteRule('[')},
+	{"limit-comma", "LIMIT offset, count", []string{DialectSQLite, DialectMySQL}, func(tokens []sqlToken, i int) bool {
+		if !tokens[i].is("LIMIT") {
+			return false
+		}
+		comma := nextSqlToken(tokens, nextSqlToken(tokens, i))
+		return comma < len(tokens) && tokens[comma].Text == ","
+	}},
+	{"top", "SELECT TOP n", nil, func(tokens []sqlToken, i int) bool {
+		previous := previousSqlToken(tokens, i)
+		return tokens[i].is("TOP") && previous >= 0 && (tokens[previous].is("SELECT") || tokens[previous].is("DISTINCT"))
+	}},
+}
+
+// Something in a query that the dialect it's meant to be in doesn't have
+type DialectIssue struct {
+	Construct string
+	Message   string
+}
+
+// Find the constructs in a query that aren't valid in a dialect, each once
+func findDialectIssues(sqlQuery string, dialect string) []DialectIssue {
+	var issues []DialectIssue
+	tokens := tokeniseSql(sqlQuery)
+	for _, rule := range dialectRules {
+		if slices.Contains(rule.ValidIn, dialect) {
+			continue
+		}
+		for i := range tokens {
+			if rule.match(tokens, i) {
+				validIn := make([]string, len(rule.ValidIn))
+				for j, valid := range rule.ValidIn {
+					validIn[j] = dialectNames[valid]
+				}
+				message := fmt.Sprintf("%s isn't %s", rule.Description, dialectNames[dialect])
+				if len(validIn) > 0 {
+					message += fmt.Sprintf(" (it's %s)", strings.Join(validIn, " and "))
+				}
+				issues = append(issues, DialectIssue{Construct: rule.Construct, Message: message})
+				break
+			}
+		}
+	}
+	return issues
+}
+
+func dialectIssueConstructs(issues []DialectIssue) []string {
+	constructs := make([]string, len(issues))
+	for i, issue := range issues {
+		constructs[i] = issue.Construct
+	}
+	return constructs
+}
+
+// Rewrite a construct starting at token i into SQLite, returning the SQL that replaces
+// tokens[i:end] and end, or ok false if there's nothing there it can rewrite
+type sqliteRewrite func(tokens []sqlToken, i int) (replacement string, end int, ok bool)
+
+// Keywords that can come right before a bracket without making it a function call
+var sqlKeywordsBeforeBracket = []string{"SELECT", "WHERE", "AND", "OR", "NOT", "ON", "BY", "IN", "AS", "WHEN", "THEN", "ELSE", "HAVING", "FROM", "JOIN", "EXISTS", "CASE", "IS"}
+
+// The start of the operand ending at token end: a bracketed expression or function call, or a possibly qualified name or literal
+func sqlOperandStart(tokens []sqlToken, end int) int {
+	if end < 0 {
+		return -1
+	}
+	if tokens[end].Text == ")" {
+		open := openingSqlBracket(tokens, end)
+		if open < 0 {
+			return -1
+		}
+		name := previousSqlToken(tokens, open)
+		if name >= 0 && tokens[name].Kind == sqlWord && !slices.ContainsFunc(sqlKeywordsBeforeBracket, tokens[name].is) {
+			return name
+		}
+		return open
+	}
+	if tokens[end].Kind == sqlPunct || tokens[end].Kind == sqlSpace {
+		return -1
+	}
+	start := end
+	// table.column
+	for {
+		dot := previousSqlToken(tokens, start)
+		if dot < 1 || tokens[dot].Text != "." {
+			return start
+		}
+		qualifier := previousSqlToken(tokens, dot)
+		if qualifier < 0 || (tokens[qualifier].Kind != sqlWord && tokens[qualifier].Kind != sqlQuotedIdentifier) {
+			return start
+		}
+		start = qualifier
+	}
+}
+
+// What a PostgreSQL type casts to in SQLite: a function for dates and times, as CAST to DATE
+// in SQLite gives a number, otherwise a CAST to the type with the same affinity
+func sqliteCast(operand string, postgresType string) string {
+	name, _, _ := strings.Cut(postgresType, "(")
+	switch strings.ToUpper(strings.Fields(name)[0]) {
+	case "DATE":
+		return "date(" + operand + ")"
+	case "TIMESTAMP", "TIMESTAMPTZ", "DATETIME":
+		return "datetime(" + operand + ")"
+	case "INT", "INTEGER", "INT2", "INT4", "INT8", "SMALLINT", "BIGINT", "BOOLEAN", "BOOL":
+		return "CAST(" + operand + " AS INTEGER)"
+	case "NUMERIC", "DECIMAL", "REAL", "FLOAT", "FLOAT4", "FLOAT8", "DOUBLE":
+		return "CAST(" + operand + " AS REAL)"
+	default:
+		return "CAST(" + operand + " AS TEXT)"
+	}
+}
+
+// strftime formats for the fields of EXTRACT
+var extractFields = map[string]string{
+	"YEAR": "%Y", "MONTH": "%m", "DAY": "%d", "HOUR": "%H", "MINUTE": "%M", "SECOND": "%S",
+	"DOW": "%w", "DOY": "%j", "WEEK": "%W",
+}
+
+// date() modifiers for the units of DATE_TRUNC
+var dateTruncUnits = map[string]string{"YEAR": ", 'start of year'", "MONTH": ", 'start of month'", "DAY": ""}
+
+// strftime for each DATE_FORMAT specifier it has an equivalent for (%e, %c and %k lose MySQL's
+// missing leading zero). The rest can't be translated: some strftime doesn't have, like %b and %a,
+// and some it means something else by, like %M, which is the month's name to MySQL but minutes to
+// strftime, %W (weekday name, not week) and %p (AM or PM, which strftime doesn't have)
+var dateFormatSpecifiers = map[byte]string{
+	'Y': "%Y", 'm': "%m", 'd': "%d", 'H': "%H", 'S': "%S", 'j': "%j", 'w': "%w", '%': "%%",
+	'i': "%M", 's': "%S", 'T': "%H:%M:%S", 'e': "%d", 'c': "%m", 'k': "%H",
+}
+
+// A DATE_FORMAT format as strftime's, unless it uses a specifier strftime has no equivalent for
+func strftimeFormat(format string) (string, bool) {
+	var translated strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			translated.WriteByte(format[i])
+			continue
+		}
+		if i+1 == len(format) {
+			return "", false
+		}
+		i++
+		specifier, ok := dateFormatSpecifiers[format[i]]
+		if !ok {
+			return "", false
+		}
+		translated.WriteString(specifier)
+	}
+	return translated.String(), true
+}
+
+var sqliteRewrites = map[string]sqliteRewrite{
+	"ilike": func(tokens []sqlToken, i int) (string, int, bool) {
+		return "LIKE", i + 1, tokens[i].is("ILIKE")
+	},
+	"now": func(tokens []sqlToken, i int) (string, int, bool) {
+		if !isSqlCall(tokens, i, "NOW") {
+			return "", 0, false
+		}
+		close := closingSqlBracket(tokens, nextSqlToken(tokens, i))
+		return "datetime('now')", close + 1, close > 0
+	},
+	"if": func(tokens []sqlToken, i int) (string, int, bool) {
+		return "IIF", i + 1, isSqlCall(tokens, i, "IF")
+	},
+	"string-agg": func(tokens []sqlToken, i int) (string, int, bool) {
+		return "GROUP_CONCAT", i + 1, isSqlCall(tokens, i, "STRING_AGG")
+	},
+	"extract": func(tokens []sqlToken, i int) (string, int, bool) {
+		if !isSqlCall(tokens, i, "EXTRACT") {
+			return "", 0, false
+		}
+		open := nextSqlToken(tokens, i)
+		close := closingSqlBracket(tokens, open)
+		field := nextSqlToken(tokens, open)
+		from := nextSqlToken(tokens, field)
+		if close < 0 || from >= close || !tokens[from].is("FROM") {
+			return "", 0, false
+		}
+		format, ok := extractFields[strings.ToUpper(tokens[field].Text)]
+		if !ok {
+			return "", 0, false
+		}
+		date := strings.TrimSpace(joinSqlTokens(tokens[from+1 : close]))
+		return fmt.Sprintf("CAST(strftime('%s', %s) AS INTEGER)", format, date), close + 1, true
+	},
+	"date-trunc": func(tokens []sqlToken, i int) (string, int, bool) {
+		if !isSqlCall(tokens, i, "DATE_TRUNC") {
+			return "", 0, false
+		}
+		open := nextSqlToken(tokens, i)
+		close := closingSqlBracket(tokens, open)
+		if close < 0 {
+			return "", 0, false
+		}
+		arguments := sqlCallArguments(tokens, open, close)
+		if len(arguments) != 2 {
+			return "", 0, false
+		}
+		unit := strings.Trim(strings.TrimSpace(joinSqlTokens(arguments[0])), "'")
+		modifier, ok := dateTruncUnits[strings.ToUpper(unit)]
+		if !ok {
+			return "", 0, false
+		}
+		return fmt.Sprintf("date(%s%s)", strings.TrimSpace(joinSqlTokens(arguments[1])), modifier), close + 1, true
+	},
+	"date-format": func(tokens []sqlToken, i int) (string, int, bool) {
+		if !isSqlCall(tokens, i, "DATE_FORMAT") {
+			return "", 0, false
+		}
+		open := nextSqlToken(tokens, i)
+		close := closingSqlBracket(tokens, open)
+		if close < 0 {
+			return "", 0, false
+		}
+		arguments := sqlCallArguments(tokens, open, close)
+		if len(arguments) != 2 {
+			return "", 0, false
+		}
+		format := strings.TrimSpace(joinSqlTokens(arguments[1]))
+		if !strings.HasPrefix(format, "'") {
+			return "", 0, false
+		}
+		format, ok := strftimeFormat(format)
+		if !ok {
+			return "", 0, false
+		}
+		return fmt.Sprintf("strftime(%s, %s)", format, strings.TrimSpace(joinSqlTokens(arguments[0]))), close + 1, true
+	},
+}
+
+// Rewrite the constructs of other dialects that SQLite has its own way of doing, returning the
+// rewritten query and which constructs were rewritten. Anything else is left for SQLite to reject.
+func translateToSqlite(sqlQuery string) (string, []string) {
+	var translated []string
+	// one rewrite at a time, as a rewrite can contain others, e.g. EXTRACT(YEAR FROM o.date::date)
+	for range 100 {
+		tokens := tokeniseSql(sqlQuery)
+		rewritten := false
+		for i := 0; i < len(tokens) && !rewritten; i++ {
+			// :: rewrites its operand as well as what comes after it
+			if tokens[i].Kind == sqlPunct && tokens[i].Text == "::" {
+				start := sqlOperandStart(tokens, previousSqlToken(tokens, i))
+				typeStart := nextSqlToken(tokens, i)
+				if start < 0 || typeStart >= len(tokens) || tokens[typeStart].Kind != sqlWord {
+					continue
+				}
+				end := typeStart + 1
+				// double precision, character varying, numeric(10, 2)
+				if next := nextSqlToken(tokens, typeStart); next < len(tokens) && (tokens[next].is("PRECISION") || tokens[next].is("VARYING")) {
+					end = next + 1
+				}
+				if next := nextSqlToken(tokens, end-1); next < len(tokens) && tokens[next].Text == "(" {
+					if close := closingSqlBracket(tokens, next); close > 0 {
+						end = close + 1
+					}
+				}
+				operand := strings.TrimSpace(joinSqlTokens(tokens[start:i]))
+				sqlQuery = joinSqlTokens(tokens[:start]) + sqliteCast(operand, joinSqlTokens(tokens[typeStart:end])) + joinSqlTokens(tokens[end:])
+				translated = append(translated, "cast-operator")
+				rewritten = true
+				continue
+			}
+			for _, construct := range sortedKeys(sqliteRewrites) {
+				if replacement, end, ok := sqliteRewrites[construct](tokens, i); ok {
+					sqlQuery = joinSqlTokens(tokens[:i]) + replacement + joinSqlTokens(tokens[end:])
+					translated = append(translated, construct)
+					rewritten = true
+					break
+				}
+			}
+		}
+		if !rewritten {
+			break
+		}
+	}
+	return sqlQuery, uniqueSorted(translated)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func uniqueSorted(values []string) []string {
+	sorted := slices.Clone(values)
+	sort.Strings(sorted)
+	return slices.Compact(sorted)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokeniseSql(t *testing.T) {
+	query := `SELECT "name", 'it''s' || x::int -- the end
+FROM [t] /* c */ WHERE a <= 1.5e3;`
+	tokens := tokeniseSql(query)
+	assert.Equal(t, query, joinSqlTokens(tokens))
+
+	var significant []string
+	for _, token := range tokens {
+		if token.Kind != sqlSpace {
+			significant = append(significant, token.Text)
+		}
+	}
+	assert.Equal(t, []string{"SELECT", `"name"`, ",", `'it''s'`, "||", "x", "::", "int", "FROM", "[t]", "WHERE", "a", "<=", "1.5e3", ";"}, significant)
+}
+
+func TestFindDialectIssues(t *testing.T) {
+	query := `SELECT name FROM Customers WHERE name ILIKE '%smith%' AND created_at::date > NOW() - INTERVAL '7 days'`
+	assert.Equal(t, []string{"ilike", "cast-operator", "now", "interval"}, dialectIssueConstructs(findDialectIssues(query, DialectSQLite)))
+	assert.Empty(t, findDialectIssues(query, DialectPostgreSQL))
+	assert.Equal(t, []string{"ilike", "cast-operator"}, dialectIssueConstructs(findDialectIssues(query, DialectMySQL)))
+
+	query = `SELECT "name", strftime('%Y', o.order_date) FROM "Orders" o LIMIT 10, 5`
+	assert.Empty(t, findDialectIssues(query, DialectSQLite))
+	assert.Equal(t, []string{"strftime", "limit-comma"}, dialectIssueConstructs(findDialectIssues(query, DialectPostgreSQL)))
+	assert.Equal(t, []string{"strftime", "double-quoted-identifier"}, dialectIssueConstructs(findDialectIssues(query, DialectMySQL)))
+
+	// only code counts, not strings
+	assert.Empty(t, findDialectIssues(`SELECT 'ILIKE :: NOW()' FROM t`, DialectSQLite))
+
+	issues := findDialectIssues(`SELECT TOP 5 name FROM Customers`, DialectSQLite)
+	assert.Equal(t, "SELECT TOP n isn't SQLite", issues[0].Message)
+	assert.Equal(t, "ILIKE isn't SQLite (it's PostgreSQL)", findDialectIssues(`SELECT 1 WHERE 'a' ILIKE 'A'`, DialectSQLite)[0].Message)
+}
+
+func TestTranslateToSqlite(t *testing.T) {
+	testCases := []struct {
+		query      string
+		expected   string
+		translated []string
+	}{
+		{`SELECT name FROM Customers WHERE name ILIKE 'customer 1%'`, `SELECT name FROM Customers WHERE name LIKE 'customer 1%'`, []string{"ilike"}},
+		{`SELECT o.total::numeric(10, 2), COUNT(*)::float FROM Orders o`, `SELECT CAST(o.total AS REAL), CAST(COUNT(*) AS REAL) FROM Orders o`, []string{"cast-operator"}},
+		{`SELECT ('2024-01-' || '15')::date`, `SELECT date(('2024-01-' || '15'))`, []string{"cast-operator"}},
+		{`SELECT EXTRACT(YEAR FROM "order_date"::timestamp) AS y FROM Orders`, `SELECT CAST(strftime('%Y', datetime("order_date")) AS INTEGER) AS y FROM Orders`, []string{"cast-operator", "extract"}},
+		{`SELECT DATE_TRUNC('month', order_date), NOW()`, `SELECT date(order_date, 'start of month'), datetime('now')`, []string{"date-trunc", "now"}},
+		{"SELECT DATE_FORMAT(`order_date`, '%Y-%m %i'), IF(a > 1, 'x', 'y'), STRING_AGG(name, ', ')", "SELECT strftime('%Y-%m %M', `order_date`), IIF(a > 1, 'x', 'y'), GROUP_CONCAT(name, ', ')", []string{"date-format", "if", "string-agg"}},
+		// nothing to do, or nothing that can be done
+		{`SELECT name FROM Customers WHERE id = 1`, `SELECT name FROM Customers WHERE id = 1`, nil},
+		{`SELECT DATE_TRUNC('week', d), x + INTERVAL '1 day'`, `SELECT DATE_TRUNC('week', d), x + INTERVAL '1 day'`, nil},
+		// DATE_FORMAT specifiers that strftime doesn't have, or means something else by
+		{`SELECT DATE_FORMAT(d, '%M %Y')`, `SELECT DATE_FORMAT(d, '%M %Y')`, nil},
+		{`SELECT DATE_FORMAT(d, '%b %Y')`, `SELECT DATE_FORMAT(d, '%b %Y')`, nil},
+		{`SELECT DATE_FORMAT(d, '%W')`, `SELECT DATE_FORMAT(d, '%W')`, nil},
+		{`SELECT DATE_FORMAT(d, '%a %d')`, `SELECT DATE_FORMAT(d, '%a %d')`, nil},
+		{`SELECT DATE_FORMAT(d, '%h:%i %p')`, `SELECT DATE_FORMAT(d, '%h:%i %p')`, nil},
+		{`SELECT DATE_FORMAT(d, '100%')`, `SELECT DATE_FORMAT(d, '100%')`, nil},
+		{`SELECT DATE_FORMAT(d, '%T, 100%%')`, `SELECT strftime('%H:%M:%S, 100%%', d)`, []string{"date-format"}},
+	}
+	for _, testCase := range testCases {
+		translated, constructs := translateToSqlite(testCase.query)
+		assert.Equal(t, testCase.expected, translated, testCase.query)
+		assert.Equal(t, testCase.translated, constructs, testCase.query)
+	}
+}
+
+func TestTranslatedSqlRunsOnSqlite(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE Orders (id INTEGER PRIMARY KEY, order_date DATE, total REAL);
+INSERT INTO Orders (order_date, total) VALUES ('2023-03-15', 10.5), ('2024-07-01', 20);`)
+	assert.NoError(t, err)
+
+	query := `SELECT EXTRACT(YEAR FROM order_date::date) AS year, total::int AS total FROM Orders WHERE 'X' ILIKE 'x' ORDER BY 1`
+	_, err = db.Exec(query)
+	assert.Error(t, err)
+	translated, _ := translateToSqlite(query)
+	result, err := executeGroundTruthSql(db, translated)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"columns":[{"name":"year"},{"name":"total"}],"rows":[[2023,10],[2024,20]]}`, result)
+}
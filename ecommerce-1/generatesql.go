@@ -7,7 +7,6 @@ import (
 	"log"
 	"strings"
 	"text/template"
-	"time"
 
 	"github.com/tmc/langchaingo/llms"
 )
@@ -68,8 +67,21 @@ const (
 	//FunctionalSupersetMatch SqlQueryEvaluationType = "FunctionalSuperset" // second query has everything the first query has with extra fields that can be ignored
 	FunctionalMatch SqlQueryEvaluationType = "Functional" // sql queries might not have the same output columns but the the columns have the same meaning
 	ExactMatch      SqlQueryEvaluationType = "Exact"      // sql queries are character by character identical
+	InvalidMatch    SqlQueryEvaluationType = "Invalid"    // the evaluator responded with something that isn't one of the above
 )
 
+// Evaluators are chatty so tolerate whitespace, quotes, trailing punctuation and case
+// when mapping a response onto one of the evaluation types.
+func parseSqlQueryEvaluationType(response string) SqlQueryEvaluationType {
+	cleaned := strings.Trim(strings.TrimSpace(response), "\"'`.!")
+	for _, evaluationType := range []SqlQueryEvaluationType{NoMatch, FunctionalMatch, ExactMatch} {
+		if strings.EqualFold(cleaned, string(evaluationType)) {
+			return evaluationType
+		}
+	}
+	return InvalidMatch
+}
+
 func substituteTemplate(promptTemplate string, params map[string]string) string {
 	// Parse the template string
 	//promptTemplate = "Hello, {{.Name}}!"
@@ -93,15 +105,23 @@ func standardizeSpaces(s string) string {
 // Takes a ground truth sql query and a comparison sql query and uses the evaluator
 // to appropriate match.
 func compareSqlQueries(groundTruthSqlQuery string, comparisonQuery string, evaluatorLLM *LLMClient, maxTokens *int, seed int) (SqlQueryEvaluationType, error) {
+	verdict, _, err := compareSqlQueriesWithSystemPrompt(context.Background(), SqlComparisonApiSystemPrompt, groundTruthSqlQuery, comparisonQuery, evaluatorLLM, maxTokens, seed, Streaming{EarlyStop: true})
+	return verdict, err
+}
+
+// Same as compareSqlQueries but with a caller supplied comparator system prompt so
+// alternative prompts can be calibrated against a labelled dataset (see judge-eval), a
+// context so callers like the API server can give up on it, and a say in how it's streamed.
+// The stats are nil when the evaluator didn't need asking.
+func compareSqlQueriesWithSystemPrompt(ctx context.Context, systemPrompt string, groundTruthSqlQuery string, comparisonQuery string, evaluatorLLM *LLMClient, maxTokens *int, seed int, streaming Streaming) (SqlQueryEvaluationType, *GenerationStats, error) {
 
 	if evaluatorLLM == nil {
 		log.Fatal("evaluatorLLM cannot be nil")
 	}
 	// query2 is exactly the same as query1 which makes life easy
 	if groundTruthSqlQuery == comparisonQuery {
-		return ExactMatch, nil
+		return ExactMatch, nil, nil
 	}
-	ctx := context.Background()
 	options := []llms.CallOption{
 		llms.WithMaxTokens(*maxTokens),
 		llms.WithTemperature(0.0),
@@ -116,34 +136,45 @@ func compareSqlQueries(groundTruthSqlQuery string, comparisonQuery string, evalu
 		"ComparisonQuery":  comparisonQuery,
 	})
 
-	start := time.Now()
-	response, err := llms.GenerateFromSinglePrompt(ctx, evaluatorLLM.Instance, SqlComparisonApiSystemPrompt+comparisonPrompt, options...)
-	elapsed := time.Since(start)
-	fmt.Printf("- compareSqlQueries generation execution time: %s\n", elapsed)
+	// the verdict's the first line, so there's no need to wait for the reasoning some models add
+	response, stats, err := generateStreaming(ctx, evaluatorLLM.Instance, systemPrompt+comparisonPrompt, streaming, completeVerdict, options...)
+	fmt.Printf("- compareSqlQueries generation execution time: %s\n", stats)
 
 	if err != nil {
-		return "", err
+		return "", stats, err
 	}
 	fmt.Printf("- comapareSqlQueries Response: '%s'\n", response)
-	return SqlQueryEvaluationType(response), nil
+	return parseSqlQueryEvaluationType(response), stats, nil
 
 }
 
-func predictSqlQueryFromNaturalLanguageQuery(llm llms.Model, maxTokens *int, systemPrompt string, query *string, seed int, failedAttempts []FailedSqlQueryAttempt) (string, error) {
-	// Modify the system prompt to include the history of failed attempts
-	//fmt.Printf("- Query: '%s'\n", *query)
+// What SQL's generated from, kept in parts so they can be trimmed to fit a model's context window
+type SqlPrompt struct {
+	Instructions string // what the model's to do and in which dialect
+	Schema       string
+	Hints        string // e.g. values in the database the question refers to
+	Glossary     string // what business terms in the question mean
+	Examples     string // e.g. earlier questions in a conversation and the SQL that answered them
+	Question     string
+}
+
+// Generate SQL for a question, telling the model about any failed attempts so it can avoid the
+// same errors. The prompt's trimmed to fit contextWindow (0 for no limit) with room for maxTokens.
+func predictSqlQueryFromNaturalLanguageQuery(ctx context.Context, llm llms.Model, maxTokens *int, contextWindow int, prompt SqlPrompt, seed int, failedAttempts []FailedSqlQueryAttempt, streaming Streaming) (string, *GenerationStats, error) {
+	fullPrompt, trimmed, fits := fitPrompt(prompt.parts(failedAttempts), contextWindow, *maxTokens)
+	for _, trim := range trimmed {
+		fmt.Printf("- Prompt trimmed to fit the %d token context window: %s\n", contextWindow, trim)
+	}
+	if !fits {
+		log.Printf("! Prompt of about %d tokens is too big for the %d token context window even trimmed", estimateTokens(fullPrompt), contextWindow)
+	}
 	if len(failedAttempts) > 0 {
-		systemPrompt += "\nTake into account the following past failed attempts at generating a new SQL query that avoids the same errors:\n"
-		for _, attempt := range failedAttempts {
-			systemPrompt += fmt.Sprintf("- Generated failed sql query: '%s';\nError message explaining why it failed:\n'%s'\n", standardizeSpaces(attempt.SqlQuery), strings.ReplaceAll(attempt.ErrorMessage, "\n", " "))
-		}
-		fmt.Printf("- Failed attempt %d:\n- System Prompt:\n--------\n%s\n---------\n\n", len(failedAttempts), systemPrompt)
+		fmt.Printf("- Failed attempt %d:\n- System Prompt:\n--------\n%s\n---------\n\n", len(failedAttempts), fullPrompt)
 	}
 
 	// print out system prompt
 	//fmt.Printf("- System Prompt:\n--------\n%s\n--------\n", strings.ReplaceAll(systemPrompt, "\n", " "))
 
-	ctx := context.Background()
 	options := []llms.CallOption{
 		llms.WithMaxTokens(*maxTokens),
 		llms.WithTemperature(0.0),
@@ -152,14 +183,12 @@ func predictSqlQueryFromNaturalLanguageQuery(llm llms.Model, maxTokens *int, sys
 		options = append(options, llms.WithSeed(seed))
 	}
 
-	start := time.Now()
-	response, err := llms.GenerateFromSinglePrompt(ctx, llm, systemPrompt+"\n"+*query, options...)
-	elapsed := time.Since(start)
-	fmt.Printf("- Query generation execution time: %s\n", elapsed)
+	response, stats, err := generateStreaming(ctx, llm, fullPrompt, streaming, completeSqlStatement, options...)
+	fmt.Printf("- Query generation execution time: %s\n", stats)
 
 	if err != nil {
-		return "", err
+		return "", stats, err
 	}
 
-	return response, nil
+	return response, stats, nil
 }
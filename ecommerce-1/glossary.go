@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// What a glossary term defines
+const (
+	GlossaryExpression = "expression" // a value worked out per row, e.g. a line's value is quantity * price
+	GlossaryMetric     = "metric"     // an aggregate, e.g. profit is SUM(quantity * price)
+	GlossaryJoin       = "join"       // how tables are joined to get from one thing to another
+)
+
+// Whether benchmark runs use a pack's glossary, and whether models are run without it too so
+// the two can be compared
+const (
+	GlossaryOn      = "on"
+	GlossaryOff     = "off"
+	GlossaryCompare = "compare"
+)
+
+const DefaultGlossary = GlossaryOn
+
+func validGlossaryMode(mode string) bool {
+	return mode == GlossaryOn || mode == GlossaryOff || mode == GlossaryCompare
+}
+
+// A business term and the SQL it means, which the schema alone doesn't say
+type GlossaryTerm struct {
+	Term        string   `yaml:"term"`
+	Synonyms    []string `yaml:"synonyms,omitempty"` // other ways questions say it, e.g. profitable
+	Kind        string   `yaml:"kind"`
+	SQL         string   `yaml:"sql"`
+	Description string   `yaml:"description,omitempty"`
+}
+
+// A dataset pack's business terms, given to the model when a question uses them
+type Glossary struct {
+	Terms []GlossaryTerm `yaml:"terms"`
+}
+
+func loadGlossary(filename string) (*Glossary, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var glossary Glossary
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&glossary); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	for i, term := range glossary.Terms {
+		if term.Term == "" || term.SQL == "" {
+			return nil, fmt.Errorf("%s: term %d: term and sql are both required", filename, i+1)
+		}
+		if term.Kind != GlossaryExpression && term.Kind != GlossaryMetric && term.Kind != GlossaryJoin {
+			return nil, fmt.Errorf("%s: term '%s': unknown kind '%s', expected %s, %s or %s", filename, term.Term, term.Kind, GlossaryExpression, GlossaryMetric, GlossaryJoin)
+		}
+	}
+	return &glossary, nil
+}
+
+// The terms a question uses, by their name or a synonym, singular or plural
+func (glossary *Glossary) Matching(question string) []GlossaryTerm {
+	if glossary == nil {
+		return nil
+	}
+	questionWords := " " + strings.Join(linkingWords(question), " ") + " "
+	var matching []GlossaryTerm
+	for _, term := range glossary.Terms {
+		for _, name := range append([]string{term.Term}, term.Synonyms...) {
+			if words := linkingWords(name); len(words) > 0 && strings.Contains(questionWords, " "+strings.Join(words, " ")+" ") {
+				fmt.Printf("- Glossary term: %s\n", term.Term)
+				matching = append(matching, term)
+				break
+			}
+		}
+	}
+	return matching
+}
+
+func glossaryTermNames(terms []GlossaryTerm) []string {
+	var names []string
+	for _, term := range terms {
+		names = append(names, term.Term)
+	}
+	return names
+}
+
+// Glossary terms as they're given to the generator
+func glossaryPrompt(terms []GlossaryTerm) string {
+	if len(terms) == 0 {
+		return ""
+	}
+	var prompt strings.Builder
+	prompt.WriteString("\nDefinitions of terms in the question, to be used in the SQL:\n")
+	for _, term := range terms {
+		fmt.Fprintf(&prompt, "- %s (%s): %s", term.Term, term.Kind, standardizeSpaces(term.SQL))
+		if term.Description != "" {
+			fmt.Fprintf(&prompt, " -- %s", term.Description)
+		}
+		prompt.WriteString("\n")
+	}
+	return prompt.String()
+}
+
+// How a model did with the glossary compared with without it, over every question and over the
+// questions that used its terms, which are the ones it can make a difference to, e.g.
+// "glossary: 6/8 correct vs 4/8 without, 3/3 vs 1/3 on the questions using its terms". Both
+// runs asked the same questions in the same order.
+func glossaryEffect(with *ModelRunRecord, without *ModelRunRecord) string {
+	effect := fmt.Sprintf("glossary: %d/%d correct vs %d/%d without", with.CorrectCount(), len(with.Questions), without.CorrectCount(), len(without.Questions))
+	using, correctWith, correctWithout := 0, 0, 0
+	for i, question := range with.Questions {
+		if len(question.GlossaryTerms) == 0 || i >= len(without.Questions) {
+			continue
+		}
+		using++
+		if question.Correct {
+			correctWith++
+		}
+		if without.Questions[i].Correct {
+			correctWithout++
+		}
+	}
+	if using > 0 {
+		effect += fmt.Sprintf(", %d/%d vs %d/%d on the questions using its terms", correctWith, using, correctWithout, using)
+	}
+	return effect
+}
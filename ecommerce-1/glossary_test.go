@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadGlossary(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "glossary.yaml")
+	assert.NoError(t, os.WriteFile(filename, []byte(`terms:
+  - term: profit
+    synonyms: [revenue]
+    kind: metric
+    sql: SUM(op.quantity * p.price)
+`), 0644))
+	glossary, err := loadGlossary(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, []GlossaryTerm{{Term: "profit", Synonyms: []string{"revenue"}, Kind: GlossaryMetric, SQL: "SUM(op.quantity * p.price)"}}, glossary.Terms)
+
+	assert.NoError(t, os.WriteFile(filename, []byte("terms:\n  - term: profit\n    kind: guess\n    sql: 1\n"), 0644))
+	_, err = loadGlossary(filename)
+	assert.ErrorContains(t, err, "unknown kind 'guess'")
+	assert.NoError(t, os.WriteFile(filename, []byte("terms:\n  - term: profit\n    kind: metric\n"), 0644))
+	_, err = loadGlossary(filename)
+	assert.Error(t, err)
+	assert.NoError(t, os.WriteFile(filename, []byte("terms:\n  - term: profit\n    kind: metric\n    sql: 1\n    cost: 2\n"), 0644))
+	_, err = loadGlossary(filename)
+	assert.Error(t, err)
+}
+
+func TestGlossaryMatching(t *testing.T) {
+	glossary := &Glossary{Terms: []GlossaryTerm{
+		{Term: "profit", Synonyms: []string{"revenue", "order value"}, Kind: GlossaryMetric, SQL: "SUM(op.quantity * p.price)", Description: "at list price"},
+		{Term: "shipped", Kind: GlossaryExpression, SQL: "o.shipping_status = 'shipped'"},
+	}}
+	// plurals and synonyms match, but only as whole words
+	assert.Equal(t, []string{"profit"}, glossaryTermNames(glossary.Matching("Which products made the most profits?")))
+	assert.Equal(t, []string{"profit"}, glossaryTermNames(glossary.Matching("What are the order values this year?")))
+	assert.Empty(t, glossary.Matching("Which orders had values over 10?"))
+	assert.Empty(t, glossary.Matching("Who was unshipped?"))
+	assert.Equal(t, []string{"profit", "shipped"}, glossaryTermNames(glossary.Matching("Revenue from shipped orders")))
+
+	var none *Glossary
+	assert.Empty(t, none.Matching("What's the profit?"))
+
+	assert.Equal(t, "", glossaryPrompt(nil))
+	assert.Equal(t, `
+Definitions of terms in the question, to be used in the SQL:
+- profit (metric): SUM(op.quantity * p.price) -- at list price
+- shipped (expression): o.shipping_status = 'shipped'
+`, glossaryPrompt(glossary.Terms))
+}
+
+func TestGlossaryEffect(t *testing.T) {
+	with := &ModelRunRecord{Name: "openai", Model: "gpt", Glossary: true, Questions: []*QuestionRecord{
+		{Correct: true, GlossaryTerms: []string{"profit"}},
+		{Correct: true},
+		{Correct: false, GlossaryTerms: []string{"shipped"}},
+	}}
+	without := &ModelRunRecord{Name: "openai", Model: "gpt", Questions: []*QuestionRecord{
+		{Correct: false},
+		{Correct: true},
+		{Correct: false},
+	}}
+	assert.Equal(t, "glossary: 2/3 correct vs 1/3 without, 1/2 vs 0/2 on the questions using its terms", glossaryEffect(with, without))
+
+	assert.Equal(t, "openai"+ServiceModelSeperator+"gpt (glossary)", with.Label())
+	assert.Equal(t, "openai"+ServiceModelSeperator+"gpt", without.Label())
+	pack := &PackRunRecord{Models: []*ModelRunRecord{without, with}}
+	assert.Same(t, without, pack.WithoutGlossary(with))
+	assert.Nil(t, pack.WithoutGlossary(without))
+}
+
+func TestDatasetPacksGlossaries(t *testing.T) {
+	packs, err := discoverDatasetPacks(DefaultPacksDir)
+	assert.NoError(t, err)
+	for _, pack := range packs {
+		_, err := pack.LoadGlossary()
+		assert.NoError(t, err, pack.Name)
+	}
+	pack, err := selectDatasetPacks(packs, "ecommerce")
+	assert.NoError(t, err)
+	glossary, err := pack[0].LoadGlossary()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"profit", "customer to product"}, glossaryTermNames(glossary.Matching("Who is the most profitable customer?")))
+}
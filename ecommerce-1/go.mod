@@ -6,9 +6,9 @@ toolchain go1.22.4
 
 require (
 	github.com/mattn/go-sqlite3 v1.14.22
-	github.com/russross/blackfriday/v2 v2.1.0
 	github.com/stretchr/testify v1.9.0
 	github.com/tmc/langchaingo v0.1.10
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -53,5 +53,4 @@ require (
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240325203815-454cdb8f5daa // indirect
 	google.golang.org/grpc v1.62.1 // indirect
 	google.golang.org/protobuf v1.33.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Difficulty levels a ground truth item can be labelled with
+const (
+	DifficultyEasy   = "easy"
+	DifficultyMedium = "medium"
+	DifficultyHard   = "hard"
+)
+
+// A single natural language question together with what we consider to be a correct answer.
+// Only Query and SQL are required: everything else is metadata for slicing results and for
+// being more forgiving about what counts as correct.
+type GroundTruthItem struct {
+	ID          string   `yaml:"id" json:"id"`
+	Query       string   `yaml:"question" json:"question"`
+	Paraphrases []string `yaml:"paraphrases,omitempty" json:"paraphrases,omitempty"` // alternate phrasings of Query with the same answer
+	// External knowledge needed to answer the question (BIRD's "evidence"), given to the model with it
+	Evidence string `yaml:"evidence,omitempty" json:"evidence,omitempty"`
+	SQL      string `yaml:"sql" json:"sql"`
+	// Other SQL queries that are just as acceptable an answer as SQL, e.g. SELECT name vs SELECT *
+	AlternativeSQL []string `yaml:"alternative_sql,omitempty" json:"alternative_sql,omitempty"`
+	Result         string   `yaml:"result,omitempty" json:"result,omitempty"` // expected result of SQL as a JSON result set
+	// Other results (as JSON, either a result set or an array of objects) that answer the question just as well, e.g. just the name of the top customer
+	AcceptableResults []string `yaml:"acceptable_results,omitempty" json:"acceptable_results,omitempty"`
+	// Columns of Result a correct answer has to return. An answer with just these columns
+	// matches whatever it calls them, e.g. SELECT name AS product for expected_columns: [name].
+	ExpectedColumns []string `yaml:"expected_columns,omitempty" json:"expected_columns,omitempty"`
+	OrderSensitive  bool     `yaml:"order_sensitive,omitempty" json:"order_sensitive,omitempty"` // whether row order matters when comparing results
+	Tags            []string `yaml:"tags,omitempty" json:"tags,omitempty"`                       // e.g. aggregation, join, subquery, negation
+	Difficulty      string   `yaml:"difficulty,omitempty" json:"difficulty,omitempty"`
+	Notes           string   `yaml:"notes,omitempty" json:"notes,omitempty"`
+}
+
+// The question followed by all of its alternate phrasings
+func (item GroundTruthItem) Questions() []string {
+	return append([]string{item.Query}, item.Paraphrases...)
+}
+
+// Turn every alternate phrasing into an item of its own so it gets asked separately.
+// The IDs of the paraphrased items are suffixed with the phrasing number, e.g. customer-count#1
+func expandParaphrases(groundTruth []GroundTruthItem) []GroundTruthItem {
+	var expanded []GroundTruthItem
+	for _, item := range groundTruth {
+		for i, question := range item.Questions() {
+			paraphrased := item
+			paraphrased.Query = question
+			paraphrased.Paraphrases = nil
+			if i > 0 {
+				paraphrased.ID = fmt.Sprintf("%s#%d", item.ID, i)
+			}
+			expanded = append(expanded, paraphrased)
+		}
+	}
+	return expanded
+}
+
+// Load ground truth from any of the supported formats, chosen by file extension:
+// .yaml/.yml and .jsonl are the native formats, .md and .csv are imported as-is
+// with IDs generated from the questions.
+func loadGroundTruth(filename string) ([]GroundTruthItem, error) {
+	var groundTruth []GroundTruthItem
+	var err error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		groundTruth, err = loadGroundTruthYaml(filename)
+	case ".jsonl":
+		groundTruth, err = loadGroundTruthJsonl(filename)
+	case ".csv":
+		groundTruth, err = loadGroundTruthCsv(filename)
+	case ".md":
+		groundTruth, err = loadGroundTruthMd(filename)
+	default:
+		return nil, fmt.Errorf("unsupported ground truth format: %s", filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	assignGroundTruthIds(groundTruth)
+	if err := validateGroundTruth(groundTruth); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return groundTruth, nil
+}
+
+// Save ground truth in one of the native formats, chosen by file extension
+func saveGroundTruth(filename string, groundTruth []GroundTruthItem) error {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return saveGroundTruthYaml(filename, groundTruth)
+	case ".jsonl":
+		return saveGroundTruthJsonl(filename, groundTruth)
+	default:
+		return fmt.Errorf("ground truth can only be saved as .yaml or .jsonl, not %s", filename)
+	}
+}
+
+func loadGroundTruthYaml(filename string) ([]GroundTruthItem, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var groundTruth []GroundTruthItem
+	if err := yaml.Unmarshal(content, &groundTruth); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return groundTruth, nil
+}
+
+func loadGroundTruthJsonl(filename string) ([]GroundTruthItem, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var groundTruth []GroundTruthItem
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var item GroundTruthItem
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filename, lineNumber, err)
+		}
+		groundTruth = append(groundTruth, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return groundTruth, nil
+}
+
+func loadGroundTruthCsv(filename string) ([]GroundTruthItem, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	var groundTruth []GroundTruthItem
+
+	// Skip the header row if your CSV has headers
+	_, err = reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			continue // skip rows that do not have enough columns
+		}
+
+		item := GroundTruthItem{
+			Query:  record[0],
+			SQL:    record[1],
+			Result: record[2],
+		}
+		groundTruth = append(groundTruth, item)
+	}
+
+	return groundTruth, nil
+}
+
+// Markdown tables with Query (or Question), SQL and optionally Result columns, like the
+// original ground-truth.md. Every such table in the document is loaded; the heading a table
+// is under becomes a tag on its items. SQL can be wrapped in a code span to protect pipes.
+func loadGroundTruthMd(filename string) ([]GroundTruthItem, error) {
+	tables, err := parseMarkdownTablesFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var groundTruth []GroundTruthItem
+	for _, table := range tables {
+		questionColumn := "Query"
+		if table.ColumnIndex(questionColumn) < 0 {
+			questionColumn = "Question"
+		}
+		if table.ColumnIndex(questionColumn) < 0 || table.ColumnIndex("SQL") < 0 {
+			continue // not a ground truth table
+		}
+		for _, row := range table.Rows {
+			item := GroundTruthItem{
+				Query:  unwrapCodeSpan(table.Value(row, questionColumn)),
+				SQL:    unwrapCodeSpan(table.Value(row, "SQL")),
+				Result: unwrapCodeSpan(table.Value(row, "Result")),
+			}
+			if table.Heading != "" {
+				item.Tags = []string{slugify(table.Heading)}
+			}
+			groundTruth = append(groundTruth, item)
+		}
+	}
+	if len(groundTruth) == 0 {
+		return nil, fmt.Errorf("%s: no table with Query and SQL columns found", filename)
+	}
+	return groundTruth, nil
+}
+
+var nonSlugCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+func slugify(s string) string {
+	return strings.Trim(nonSlugCharacters.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// Imported formats have no IDs so derive them from the question
+func assignGroundTruthIds(groundTruth []GroundTruthItem) {
+	for i := range groundTruth {
+		if groundTruth[i].ID == "" {
+			groundTruth[i].ID = slugify(groundTruth[i].Query)
+		}
+	}
+}
+
+func validateGroundTruth(groundTruth []GroundTruthItem) error {
+	var problems []string
+	seenIds := make(map[string]bool)
+	for i, item := range groundTruth {
+		where := fmt.Sprintf("item %d (%s)", i+1, item.ID)
+		if item.ID == "" {
+			problems = append(problems, where+": missing id")
+		} else if seenIds[item.ID] {
+			problems = append(problems, where+": duplicate id")
+		}
+		seenIds[item.ID] = true
+		if strings.TrimSpace(item.Query) == "" {
+			problems = append(problems, where+": missing question")
+		}
+		if strings.TrimSpace(item.SQL) == "" {
+			problems = append(problems, where+": missing sql")
+		}
+		if item.Result != "" {
+			if result, err := parseResultSet(item.Result); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: result isn't a valid JSON result: %v", where, err))
+			} else if _, err := result.project(item.ExpectedColumns); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: expected_columns: %v", where, err))
+			}
+		}
+		for j, acceptableResult := range item.AcceptableResults {
+			if _, err := parseResultSet(acceptableResult); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: acceptable_results %d isn't a valid JSON result: %v", where, j+1, err))
+			}
+		}
+		switch item.Difficulty {
+		case "", DifficultyEasy, DifficultyMedium, DifficultyHard:
+		default:
+			problems = append(problems, fmt.Sprintf("%s: unknown difficulty '%s'", where, item.Difficulty))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid ground truth:\n- %s", strings.Join(problems, "\n- "))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadGroundTruthYamlMatchesMarkdownImport(t *testing.T) {
+	pack, err := loadDatasetPack(filepath.Join(DefaultPacksDir, DefaultPack))
+	assert.NoError(t, err)
+	structured, err := pack.LoadGroundTruth()
+	assert.NoError(t, err)
+	imported, err := loadGroundTruth(pack.Path("ground-truth.md"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, len(imported), len(structured))
+	for i := range imported {
+		assert.Equal(t, imported[i].Query, structured[i].Query)
+		assert.Equal(t, imported[i].SQL, structured[i].SQL)
+		// the markdown still has results in the old array of objects format
+		importedResult, err := parseResultSet(imported[i].Result)
+		assert.NoError(t, err)
+		structuredResult, err := parseResultSet(structured[i].Result)
+		assert.NoError(t, err)
+		assert.Equal(t, importedResult.canonicalRows(), structuredResult.canonicalRows())
+		assert.NotEmpty(t, imported[i].ID)
+		assert.NotEmpty(t, structured[i].Tags)
+	}
+}
+
+func TestLoadGroundTruthJsonl(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ground-truth.jsonl")
+	content := `{"id": "count", "question": "How many customers are there?", "sql": "SELECT COUNT(*) FROM Customers;", "tags": ["aggregation"], "difficulty": "easy"}
+
+{"question": "Who is the most profitable customer?", "sql": "SELECT 1;", "alternative_sql": ["SELECT 2;"], "order_sensitive": true}
+`
+	assert.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+
+	groundTruth, err := loadGroundTruth(filename)
+	assert.NoError(t, err)
+	assert.Len(t, groundTruth, 2)
+	assert.Equal(t, []string{"aggregation"}, groundTruth[0].Tags)
+	assert.Equal(t, "who-is-the-most-profitable-customer", groundTruth[1].ID)
+	assert.Equal(t, []string{"SELECT 2;"}, groundTruth[1].AlternativeSQL)
+	assert.True(t, groundTruth[1].OrderSensitive)
+}
+
+func TestValidateGroundTruth(t *testing.T) {
+	err := validateGroundTruth([]GroundTruthItem{
+		{ID: "a", Query: "q", SQL: "SELECT 1"},
+		{ID: "a", Query: "q", SQL: "SELECT 1", Difficulty: "impossible"},
+		{ID: "b", Query: "", SQL: ""},
+		{ID: "c", Query: "q", SQL: "SELECT 1, 2", Result: `{"columns":[{"name":"id"},{"name":"name"}],"rows":[[1,2]]}`, ExpectedColumns: []string{"price"}},
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicate id")
+	assert.Contains(t, err.Error(), "unknown difficulty")
+	assert.Contains(t, err.Error(), "missing sql")
+	assert.Contains(t, err.Error(), "expected_columns: no column 'price'")
+}
+
+func TestExpandParaphrases(t *testing.T) {
+	expanded := expandParaphrases([]GroundTruthItem{
+		{ID: "count", Query: "How many customers are there?", Paraphrases: []string{"What is the number of customers?"}, SQL: "SELECT COUNT(*) FROM Customers"},
+		{ID: "other", Query: "Anything else?", SQL: "SELECT 1"},
+	})
+	assert.Len(t, expanded, 3)
+	assert.Equal(t, "count#1", expanded[1].ID)
+	assert.Equal(t, "What is the number of customers?", expanded[1].Query)
+	assert.Equal(t, expanded[0].SQL, expanded[1].SQL)
+}
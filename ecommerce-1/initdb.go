@@ -4,317 +4,224 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// Create tables
-const CREATE_CUSTOMERS_TABLE = `
-	CREATE TABLE IF NOT EXISTS Customers (
-	    id INTEGER PRIMARY KEY AUTOINCREMENT,
-	    name TEXT NOT NULL,
-	    email TEXT UNIQUE NOT NULL
-	);
-	CREATE INDEX idx_customers_name ON Customers(name);`
-const CREATE_ORDERS_TABLE = `
-	CREATE TABLE IF NOT EXISTS Orders (
-	    id INTEGER PRIMARY KEY AUTOINCREMENT,
-	    customer_id INTEGER REFERENCES Customers(id),
-	    shipping_status TEXT CHECK (shipping_status IN ('pending', 'shipped', 'delivered')) NOT NULL,
-	    FOREIGN KEY(customer_id) REFERENCES Customers(id)
-	);`
-const CREATE_PRODUCTS_TABLE = `
-	CREATE TABLE IF NOT EXISTS Products (
-	    id INTEGER PRIMARY KEY AUTOINCREMENT,
-	    name TEXT NOT NULL,
-	    price REAL NOT NULL
-	);
-	CREATE INDEX idx_products_name ON Products(name);`
-
-const CREATE_ORDER_PRODUCTS_TABLE = `
-	CREATE TABLE IF NOT EXISTS Order_Products (
-	    order_id INTEGER REFERENCES Orders(id),
-	    product_id INTEGER REFERENCES Products(id),
-	    quantity INTEGER NOT NULL,
-	    PRIMARY KEY(order_id, product_id)
-	);`
-
-var TABLES = []string{CREATE_CUSTOMERS_TABLE, CREATE_ORDERS_TABLE, CREATE_PRODUCTS_TABLE, CREATE_ORDER_PRODUCTS_TABLE}
-
-type ProductQuantity struct {
-	Name     string
-	Quantity int
+// Everything needed to build a dataset database from scratch or bring an existing one up to date.
+// The database's version is kept in PRAGMA user_version: 1 once the schema and seed have been
+// applied, then one more for every migration.
+type DbDefinition struct {
+	Schema     SqlScript
+	Seed       SqlScript   // optional
+	Migrations []SqlScript // changes to the schema (and possibly the data) made after the database was first created
 }
 
-func getCustomerIdByName(db *sql.DB, customerName string) (int, error) {
-	var customerId int
-	err := db.QueryRow("SELECT id FROM Customers WHERE name=?", customerName).Scan(&customerId)
-	if err != nil && err != sql.ErrNoRows {
-		return 0, fmt.Errorf("failed to get customer ID: %v", err)
-	}
-	return customerId, nil
+func (definition DbDefinition) Version() int {
+	return 1 + len(definition.Migrations)
 }
 
-// Function to get product ID by name
-func getProductIdByName(db *sql.DB, productName string) (int, error) {
-	var productId int
-	err := db.QueryRow("SELECT id FROM Products WHERE name=?", productName).Scan(&productId)
-	if err != nil && err != sql.ErrNoRows {
-		return 0, fmt.Errorf("failed to get product ID: %v", err)
+// Open the dataset database, creating it from the definition if it doesn't exist yet and
+// migrating it if it's behind. The handle returned is open and its tables are known to
+// match the definition; on any error there's no handle and no half built database left behind.
+func initialiseDb(dbName string, definition DbDefinition) (*sql.DB, error) {
+	_, err := os.Stat(dbName)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
 	}
-	return productId, nil
-}
 
-func createNewOrder(db *sql.DB, customerName string, products []ProductQuantity, shippingStatus string) error {
-	customerId, err := getCustomerIdByName(db, customerName)
+	db, err := sql.Open("sqlite3", dbName)
 	if err != nil {
-		return fmt.Errorf("failed to get customer ID: %v", err)
+		return nil, fmt.Errorf("error opening database %s: %v", dbName, err)
 	}
-
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to start transaction: %v", err)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening database %s: %v", dbName, err)
 	}
 
-	// Insert into Orders table
-	result, err := tx.Exec("INSERT INTO Orders (customer_id, shipping_status) VALUES (?,?)", customerId, shippingStatus)
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to insert order: %v", err)
+	if exists {
+		fmt.Println("Opened existing database:", dbName)
+	} else {
+		fmt.Println("Creating database:", dbName)
 	}
+	if err := bootstrapDb(db, definition); err != nil {
+		db.Close()
+		if !exists {
+			os.Remove(dbName)
+		}
+		return nil, fmt.Errorf("database %s: %v", dbName, err)
+	}
+	return db, nil
+}
 
-	lastOrderId, err := result.LastInsertId()
+// Open a database something else built, like a benchmark's, read only. It isn't versioned,
+// migrated or checked against a schema, as it's not ours to change.
+func openReadOnlyDb(dbName string) (*sql.DB, error) {
+	if _, err := os.Stat(dbName); err != nil {
+		return nil, err
+	}
+	// the file name is part of a URI, so anything that would end it early is escaped
+	escaped := strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(dbName)
+	db, err := sql.Open("sqlite3", "file:"+escaped+"?mode=ro")
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to get last insert ID: %v", err)
+		return nil, fmt.Errorf("error opening database %s: %v", dbName, err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening database %s: %v", dbName, err)
 	}
+	fmt.Println("Opened read only database:", dbName)
+	return db, nil
+}
 
-	// Iterate over products and insert into Order_Products table
-	for _, pq := range products {
-		productId, err := getProductIdByName(db, pq.Name)
-		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to get product ID: %v", err)
-		}
+func dbVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
 
-		_, err = tx.Exec("INSERT INTO Order_Products (order_id, product_id, quantity) VALUES (?,?,?)", lastOrderId, productId, pq.Quantity)
-		if err != nil {
+// Run some SQL scripts and bump the version in a single transaction so it either all happens or none of it does
+func applyDbVersion(db *sql.DB, version int, scripts ...SqlScript) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, script := range scripts {
+		if err := executeSqlScript(tx, script); err != nil {
 			tx.Rollback()
-			return fmt.Errorf("failed to insert into Order_Products: %v", err)
+			return err
 		}
 	}
-
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+	// PRAGMA doesn't take parameters
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		tx.Rollback()
+		return err
 	}
-
-	return nil
+	return tx.Commit()
 }
 
-func initialiseDb(dbName string) (*sql.DB, error) {
-
-	// Check if the database file exists and simply return it if it does
-	if _, err := os.Stat(dbName); !os.IsNotExist(err) {
-		// Database exists, open it
-		db, err := sql.Open("sqlite3", dbName)
-		if err != nil {
-			return nil, fmt.Errorf("error opening existing database: %v", err)
-		}
-		fmt.Println("Opened existing database:", dbName)
-		return db, nil
+func bootstrapDb(db *sql.DB, definition DbDefinition) error {
+	version, err := dbVersion(db)
+	if err != nil {
+		return err
 	}
-
-	// Open the database
-	db, err := sql.Open("sqlite3", dbName)
+	tables, err := describeDbTables(db)
 	if err != nil {
-		fmt.Println(err)
-		return nil, err
+		return err
 	}
-	defer db.Close()
 
-	// Ensure the database is properly closed when the program exits
-	defer func() {
-		err := db.Close()
-		if err != nil {
-			fmt.Println(err)
+	// databases from before versioning already have the schema and data, they just weren't stamped
+	if version == 0 && len(tables) > 0 {
+		fmt.Println("Database has no version, assuming it's at version 1")
+		if err := applyDbVersion(db, 1); err != nil {
+			return err
 		}
-	}()
+		version = 1
+	}
 
-	fmt.Println("Creating tables...")
-	for _, query := range TABLES {
-		_, err := db.Exec(query)
-		if err != nil {
-			fmt.Println(err)
+	if version > definition.Version() {
+		return fmt.Errorf("database is at version %d but the schema only goes up to version %d", version, definition.Version())
+	}
+	if version == 0 {
+		fmt.Println("Creating tables and inserting sample data...")
+		if err := applyDbVersion(db, 1, definition.Schema, definition.Seed); err != nil {
+			return fmt.Errorf("creating schema:\n%v", err)
 		}
+		version = 1
 	}
-
-	// Insert sample data
-	fmt.Println("Inserting sample data...")
-	insertSampleData(db)
-	return db, nil
+	for ; version < definition.Version(); version++ {
+		migration := definition.Migrations[version-1]
+		fmt.Printf("Applying migration %d: %s\n", version+1, migration.Name)
+		if err := applyDbVersion(db, version+1, migration); err != nil {
+			return fmt.Errorf("migration %d:\n%v", version+1, err)
+		}
+	}
+	return verifyDbSchema(db, definition)
 }
 
-func insertSampleData(db *sql.DB) {
-	// Insert customers
-	customers := []struct {
-		name  string
-		email string
-	}{
-		{"Customer 1", "customer1@example.com"},
-		{"Customer 2", "customer2@example.com"},
-		{"Customer 3", "customer3@example.com"},
-		{"Customer 4", "customer4@example.com"},
-		{"Customer 5", "customer5@example.com"},
-		{"Customer 6", "customer6@example.com"},
-		{"Customer 7", "customer7@example.com"},
-		{"Customer 8", "customer8@example.com"},
-		{"Customer 9", "customer9@example.com"},
-		{"Customer 10", "customer10@example.com"},
+// Every table in the database and its columns, in order
+func describeDbTables(db *sql.DB) (map[string][]string, error) {
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return nil, err
 	}
-
-	for _, c := range customers {
-		_, err := db.Exec("INSERT INTO Customers (name, email) VALUES (?,?)", c.name, c.email)
-		if err != nil {
-			fmt.Println(err)
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
 		}
+		names = append(names, name)
 	}
-
-	// Insert products
-	products := []struct {
-		name  string
-		price float64
-	}{
-		{"Product 1", 100.00},
-		{"Product 2", 200.00},
-		{"Product 3", 300.00},
-		{"Product 4", 400.00},
-		{"Product 5", 500.00},
-		{"Product 6", 600.00},
-		{"Product 7", 700.00},
-		{"Product 8", 800.00},
-		{"Product 9", 900.00},
-		{"Product 10", 10000.00},
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	for _, p := range products {
-		_, err := db.Exec("INSERT INTO Products (name, price) VALUES (?,?)", p.name, p.price)
+	tables := make(map[string][]string)
+	for _, name := range names {
+		var columns []string
+		rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, name)
 		if err != nil {
-			fmt.Println(err)
+			return nil, err
+		}
+		for rows.Next() {
+			var column string
+			if err := rows.Scan(&column); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			columns = append(columns, column)
 		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		tables[name] = columns
 	}
+	return tables, nil
+}
 
-	// Insert orders
-	orders := []struct {
-		customerName   string
-		products       []ProductQuantity
-		shippingStatus string
-	}{
-		{
-			customerName: "Customer 1",
-			products: []ProductQuantity{
-				{Name: "Product 1", Quantity: 1},
-			},
-			shippingStatus: "pending",
-		},
-		{
-			customerName: "Customer 2",
-			products: []ProductQuantity{
-				{Name: "Product 1", Quantity: 1},
-				{Name: "Product 2", Quantity: 2},
-			},
-			shippingStatus: "shipped",
-		},
-		{
-			customerName: "Customer 3",
-			products: []ProductQuantity{
-				{Name: "Product 1", Quantity: 1},
-				{Name: "Product 2", Quantity: 2},
-				{Name: "Product 3", Quantity: 3},
-			},
-			shippingStatus: "delivered",
-		},
-		{
-			customerName: "Customer 4",
-			products: []ProductQuantity{
-				{Name: "Product 1", Quantity: 1},
-				{Name: "Product 2", Quantity: 2},
-				{Name: "Product 3", Quantity: 3},
-				{Name: "Product 4", Quantity: 4},
-			},
-			shippingStatus: "delivered",
-		},
-		{
-			customerName: "Customer 5",
-			products: []ProductQuantity{
-				{Name: "Product 1", Quantity: 1},
-				{Name: "Product 2", Quantity: 2},
-				{Name: "Product 3", Quantity: 3},
-				{Name: "Product 4", Quantity: 4},
-				{Name: "Product 5", Quantity: 5},
-			},
-			shippingStatus: "delivered",
-		},
-		{
-			customerName: "Customer 6",
-			products: []ProductQuantity{
-				{Name: "Product 1", Quantity: 1},
-				{Name: "Product 2", Quantity: 2},
-				{Name: "Product 3", Quantity: 3},
-				{Name: "Product 4", Quantity: 4},
-				{Name: "Product 5", Quantity: 5},
-				{Name: "Product 6", Quantity: 6},
-			},
-			shippingStatus: "delivered",
-		},
-		{
-			customerName: "Customer 7",
-			products: []ProductQuantity{
-				{Name: "Product 1", Quantity: 1},
-				{Name: "Product 2", Quantity: 2},
-				{Name: "Product 3", Quantity: 3},
-				{Name: "Product 4", Quantity: 4},
-				{Name: "Product 5", Quantity: 5},
-				{Name: "Product 6", Quantity: 6},
-				{Name: "Product 7", Quantity: 7},
-			},
-			shippingStatus: "delivered",
-		},
-		{
-			customerName: "Customer 8",
-			products: []ProductQuantity{
-				{Name: "Product 1", Quantity: 1},
-				{Name: "Product 2", Quantity: 2},
-				{Name: "Product 3", Quantity: 3},
-				{Name: "Product 4", Quantity: 4},
-				{Name: "Product 5", Quantity: 5},
-				{Name: "Product 6", Quantity: 6},
-				{Name: "Product 7", Quantity: 7},
-				{Name: "Product 8", Quantity: 8},
-			},
-			shippingStatus: "delivered",
-		},
-		{
-			customerName: "Customer 9",
-			products: []ProductQuantity{
-				{Name: "Product 1", Quantity: 1},
-				{Name: "Product 2", Quantity: 2},
-				{Name: "Product 3", Quantity: 3},
-				{Name: "Product 4", Quantity: 4},
-				{Name: "Product 5", Quantity: 5},
-				{Name: "Product 6", Quantity: 6},
-				{Name: "Product 7", Quantity: 7},
-				{Name: "Product 8", Quantity: 8},
-				{Name: "Product 9", Quantity: 9},
-			},
-			shippingStatus: "delivered",
-		},
+// Check the database has the tables and columns the definition would create, so a stale or
+// hand edited database file is caught here rather than as a model getting questions wrong
+func verifyDbSchema(db *sql.DB, definition DbDefinition) error {
+	expectedDb, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return err
+	}
+	defer expectedDb.Close()
+	// every connection gets its own in memory database so stick to one
+	expectedDb.SetMaxOpenConns(1)
+	for _, script := range append([]SqlScript{definition.Schema}, definition.Migrations...) {
+		if err := executeSqlScript(expectedDb, script); err != nil {
+			return fmt.Errorf("building the expected schema:\n%v", err)
+		}
 	}
 
-	for _, o := range orders {
-		err := createNewOrder(db, o.customerName, o.products, o.shippingStatus)
-		if err != nil {
-			fmt.Println(err)
+	expected, err := describeDbTables(expectedDb)
+	if err != nil {
+		return err
+	}
+	actual, err := describeDbTables(db)
+	if err != nil {
+		return err
+	}
+	var problems []string
+	for table, columns := range expected {
+		if actualColumns, ok := actual[table]; !ok {
+			problems = append(problems, fmt.Sprintf("table %s is missing", table))
+		} else if !reflect.DeepEqual(columns, actualColumns) {
+			problems = append(problems, fmt.Sprintf("table %s has columns (%s), expected (%s)", table, strings.Join(actualColumns, ", "), strings.Join(columns, ", ")))
 		}
 	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("schema doesn't match: %s; delete the database to recreate it", strings.Join(problems, "; "))
+	}
+	return nil
 }
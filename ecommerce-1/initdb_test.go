@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testDbDefinition = DbDefinition{
+	Schema: SqlScript{Name: "schema.sql", Sql: `CREATE TABLE IF NOT EXISTS Customers (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+CREATE INDEX IF NOT EXISTS idx_customers_name ON Customers(name);`},
+	Seed: SqlScript{Name: "seed.sql", Sql: `INSERT INTO Customers (name) VALUES ('Customer 1'), ('Customer 2');`},
+}
+
+func TestInitialiseDbCreatesAndReopens(t *testing.T) {
+	dbName := filepath.Join(t.TempDir(), "test.db")
+
+	// the first open creates the database and the handle has to be usable straight away
+	db, err := initialiseDb(dbName, testDbDefinition)
+	assert.NoError(t, err)
+	var count int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM Customers`).Scan(&count))
+	assert.Equal(t, 2, count)
+	version, err := dbVersion(db)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+	db.Close()
+
+	// reopening doesn't seed again
+	db, err = initialiseDb(dbName, testDbDefinition)
+	assert.NoError(t, err)
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM Customers`).Scan(&count))
+	assert.Equal(t, 2, count)
+	db.Close()
+
+	// migrations are applied once, in order
+	migrated := testDbDefinition
+	migrated.Migrations = []SqlScript{
+		{Name: "add-email.sql", Sql: `ALTER TABLE Customers ADD COLUMN email TEXT;`},
+		{Name: "fill-email.sql", Sql: `UPDATE Customers SET email = lower(replace(name, ' ', '')) || '@example.com';`},
+	}
+	db, err = initialiseDb(dbName, migrated)
+	assert.NoError(t, err)
+	var email string
+	assert.NoError(t, db.QueryRow(`SELECT email FROM Customers WHERE id = 1`).Scan(&email))
+	assert.Equal(t, "customer1@example.com", email)
+	version, err = dbVersion(db)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, version)
+	db.Close()
+
+	// a database newer than the definition, or one that doesn't match it, is an error
+	_, err = initialiseDb(dbName, testDbDefinition)
+	assert.ErrorContains(t, err, "version 3")
+	changed := migrated
+	changed.Schema = SqlScript{Name: "schema.sql", Sql: `CREATE TABLE IF NOT EXISTS Customers (id INTEGER PRIMARY KEY, name TEXT NOT NULL, phone TEXT);`}
+	_, err = initialiseDb(dbName, changed)
+	assert.ErrorContains(t, err, "table Customers has columns (id, name, email), expected (id, name, phone, email)")
+	changed.Schema.Sql = testDbDefinition.Schema.Sql + `CREATE TABLE IF NOT EXISTS Orders (id INTEGER PRIMARY KEY);`
+	_, err = initialiseDb(dbName, changed)
+	assert.ErrorContains(t, err, "table Orders is missing")
+}
+
+func TestInitialiseDbFailureLeavesNothingBehind(t *testing.T) {
+	dbName := filepath.Join(t.TempDir(), "test.db")
+	broken := testDbDefinition
+	broken.Seed = SqlScript{Name: "seed.sql", Sql: `INSERT INTO Customers (name) VALUES ('Customer 1'), (NULL);`}
+
+	db, err := initialiseDb(dbName, broken)
+	assert.ErrorContains(t, err, "seed.sql:1: NOT NULL constraint failed: Customers.name")
+	assert.Nil(t, db)
+	_, err = os.Stat(dbName)
+	assert.True(t, os.IsNotExist(err))
+
+	// so fixing the definition and trying again just works
+	db, err = initialiseDb(dbName, testDbDefinition)
+	assert.NoError(t, err)
+	db.Close()
+}
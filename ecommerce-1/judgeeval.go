@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+const JudgeEvalDatasetFile = "judge-eval.jsonl"
+
+// The classes we report on, in the order they appear in the confusion matrix.
+// InvalidMatch only ever appears as a predicted class: it's what the evaluator gets
+// when it responds with something we can't interpret.
+var judgeEvalClasses = []SqlQueryEvaluationType{ExactMatch, FunctionalMatch, NoMatch, InvalidMatch}
+
+// A labelled pair of SQL queries along with the verdict we expect the evaluator to give.
+type JudgeEvalCase struct {
+	GroundTruthSQL string                 `json:"ground_truth_sql"`
+	CandidateSQL   string                 `json:"candidate_sql"`
+	Expected       SqlQueryEvaluationType `json:"expected"`
+	Note           string                 `json:"note,omitempty"`
+}
+
+type JudgeEvalResult struct {
+	Case   JudgeEvalCase
+	Actual SqlQueryEvaluationType
+}
+
+type JudgeClassMetrics struct {
+	Class          SqlQueryEvaluationType
+	TruePositives  int
+	FalsePositives int
+	FalseNegatives int
+}
+
+// Precision is undefined when the evaluator never predicted the class, hence the bool.
+func (m JudgeClassMetrics) Precision() (float64, bool) {
+	predicted := m.TruePositives + m.FalsePositives
+	if predicted == 0 {
+		return 0, false
+	}
+	return float64(m.TruePositives) / float64(predicted), true
+}
+
+// Recall is undefined when the dataset has no cases labelled with the class.
+func (m JudgeClassMetrics) Recall() (float64, bool) {
+	support := m.TruePositives + m.FalseNegatives
+	if support == 0 {
+		return 0, false
+	}
+	return float64(m.TruePositives) / float64(support), true
+}
+
+type JudgeEvalMetrics struct {
+	Total     int
+	Correct   int
+	Confusion map[SqlQueryEvaluationType]map[SqlQueryEvaluationType]int // expected -> actual -> count
+	PerClass  []JudgeClassMetrics
+}
+
+func loadJudgeEvalCases(filename string) ([]JudgeEvalCase, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var cases []JudgeEvalCase
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		var judgeCase JudgeEvalCase
+		if err := json.Unmarshal([]byte(line), &judgeCase); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filename, lineNumber, err)
+		}
+		expected := parseSqlQueryEvaluationType(string(judgeCase.Expected))
+		if expected == InvalidMatch {
+			return nil, fmt.Errorf("%s:%d: unknown expected verdict '%s'", filename, lineNumber, judgeCase.Expected)
+		}
+		judgeCase.Expected = expected
+		cases = append(cases, judgeCase)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+func computeJudgeEvalMetrics(results []JudgeEvalResult) JudgeEvalMetrics {
+	metrics := JudgeEvalMetrics{
+		Total:     len(results),
+		Confusion: make(map[SqlQueryEvaluationType]map[SqlQueryEvaluationType]int),
+	}
+	for _, class := range judgeEvalClasses {
+		metrics.Confusion[class] = make(map[SqlQueryEvaluationType]int)
+	}
+
+	for _, result := range results {
+		metrics.Confusion[result.Case.Expected][result.Actual]++
+		if result.Case.Expected == result.Actual {
+			metrics.Correct++
+		}
+	}
+
+	for _, class := range judgeEvalClasses {
+		classMetrics := JudgeClassMetrics{Class: class}
+		for _, other := range judgeEvalClasses {
+			if other == class {
+				classMetrics.TruePositives = metrics.Confusion[class][class]
+				continue
+			}
+			classMetrics.FalseNegatives += metrics.Confusion[class][other]
+			classMetrics.FalsePositives += metrics.Confusion[other][class]
+		}
+		metrics.PerClass = append(metrics.PerClass, classMetrics)
+	}
+	return metrics
+}
+
+func formatRatio(value float64, ok bool) string {
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", value)
+}
+
+func printJudgeEvalReport(w io.Writer, evaluatorName string, metrics JudgeEvalMetrics) {
+	fmt.Fprintf(w, "\n=== Judge evaluation: %s\n", evaluatorName)
+	accuracy := 0.0
+	if metrics.Total > 0 {
+		accuracy = float64(metrics.Correct) / float64(metrics.Total)
+	}
+	fmt.Fprintf(w, "Accuracy: %d/%d (%.2f)\n\n", metrics.Correct, metrics.Total, accuracy)
+
+	fmt.Fprintf(w, "%-20s", "expected \\ actual")
+	for _, actual := range judgeEvalClasses {
+		fmt.Fprintf(w, "%12s", actual)
+	}
+	fmt.Fprintln(w)
+	for _, expected := range judgeEvalClasses {
+		// the evaluator can answer Invalid but a case is never labelled with it
+		if expected == InvalidMatch {
+			continue
+		}
+		fmt.Fprintf(w, "%-20s", expected)
+		for _, actual := range judgeEvalClasses {
+			fmt.Fprintf(w, "%12d", metrics.Confusion[expected][actual])
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "\n%-12s%12s%12s%12s\n", "class", "precision", "recall", "support")
+	for _, classMetrics := range metrics.PerClass {
+		precision, precisionOk := classMetrics.Precision()
+		recall, recallOk := classMetrics.Recall()
+		fmt.Fprintf(w, "%-12s%12s%12s%12d\n", classMetrics.Class, formatRatio(precision, precisionOk), formatRatio(recall, recallOk), classMetrics.TruePositives+classMetrics.FalseNegatives)
+	}
+}
+
+// judge: compare two SQL queries with the evaluator, exiting non-zero unless they match
+func runJudge(args []string) int {
+	flags := flag.NewFlagSet("judge", flag.ExitOnError)
+	baseURL := flags.String("base-url", "", "Base URL for the API server")
+	maxTokens := flags.Int("max-tokens", 200, "Maximum number of tokens in the summary")
+	seed := flags.Int("seed", NoSeed, "Seed for deterministic (in theory) results (optional)")
+	evaluator := flags.String("evaluator", DefaultEvaluator, "Evaluator as 'name : model'")
+	systemPromptFile := flags.String("system-prompt", "", "File containing an alternative comparator system prompt (optional)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: judge [flags] <gold sql> <candidate sql>\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 || !validModelName(*evaluator) {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	systemPrompt := SqlComparisonApiSystemPrompt
+	if *systemPromptFile != "" {
+		content, err := os.ReadFile(*systemPromptFile)
+		if err != nil {
+			log.Fatalf("Failed to read system prompt: %v", err)
+		}
+		systemPrompt = string(content)
+	}
+	evaluatorLLM := lookupLLMClient(*evaluator, initialiseLLMClients(*baseURL))
+	verdict, _, err := compareSqlQueriesWithSystemPrompt(context.Background(), systemPrompt, flags.Arg(0), flags.Arg(1), evaluatorLLM, maxTokens, *seed, Streaming{Progress: os.Stdout, EarlyStop: true})
+	if err != nil {
+		log.Fatalf("Failed to compare SQL queries: %v", err)
+	}
+	fmt.Println(verdict)
+	if verdict == ExactMatch || verdict == FunctionalMatch {
+		return ExitOk
+	}
+	return ExitFailure
+}
+
+// The evaluators -evaluator names: one model, or with "all" every model that initialised, in
+// the same order every run
+func judgeEvaluators(evaluator string, llmClients LLMClientsMap) []*LLMClient {
+	if evaluator != "all" {
+		return []*LLMClient{lookupLLMClient(evaluator, llmClients)}
+	}
+	var evaluators []*LLMClient
+	for _, llmClient := range sortedLLMClients(llmClients) {
+		if llmClient.Instance == nil {
+			log.Printf("Skipping evaluator %s%s%s: it failed to initialise", llmClient.Name, ServiceModelSeperator, llmClient.Model)
+			continue
+		}
+		evaluators = append(evaluators, llmClient)
+	}
+	return evaluators
+}
+
+// judge-eval: run one or more evaluators over a labelled dataset of SQL pairs so the
+// evaluator model and comparator prompt can be chosen with data rather than gut feel.
+func runJudgeEval(args []string) int {
+	flags := flag.NewFlagSet("judge-eval", flag.ExitOnError)
+	baseURL := flags.String("base-url", "", "Base URL for the API server")
+	maxTokens := flags.Int("max-tokens", 200, "Maximum number of tokens in the summary")
+	seed := flags.Int("seed", NoSeed, "Seed for deterministic (in theory) results (optional)")
+	dataset := flags.String("dataset", JudgeEvalDatasetFile, "JSONL file of labelled (ground truth SQL, candidate SQL, expected verdict) cases")
+	evaluator := flags.String("evaluator", DefaultEvaluator, "Evaluator to calibrate as 'name : model', or 'all' for every configured client")
+	systemPromptFile := flags.String("system-prompt", "", "File containing an alternative comparator system prompt (optional)")
+	verbose := flags.Bool("verbose", false, "Print every misclassified case")
+	flags.Parse(args)
+	if *evaluator != "all" && !validModelName(*evaluator) {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	cases, err := loadJudgeEvalCases(*dataset)
+	if err != nil {
+		log.Fatalf("Failed to load judge evaluation dataset: %v", err)
+	}
+	fmt.Printf("Loaded %d judge evaluation cases from %s\n", len(cases), *dataset)
+
+	systemPrompt := SqlComparisonApiSystemPrompt
+	if *systemPromptFile != "" {
+		content, err := os.ReadFile(*systemPromptFile)
+		if err != nil {
+			log.Fatalf("Failed to read system prompt: %v", err)
+		}
+		systemPrompt = string(content)
+		fmt.Printf("Using comparator system prompt from %s\n", *systemPromptFile)
+	}
+
+	for _, evaluatorLLM := range judgeEvaluators(*evaluator, initialiseLLMClients(*baseURL)) {
+		var results []JudgeEvalResult
+		for _, judgeCase := range cases {
+			actual, _, err := compareSqlQueriesWithSystemPrompt(context.Background(), systemPrompt, judgeCase.GroundTruthSQL, judgeCase.CandidateSQL, evaluatorLLM, maxTokens, *seed, Streaming{EarlyStop: true})
+			if err != nil {
+				log.Printf("Error comparing SQL queries: %v", err)
+				actual = InvalidMatch
+			}
+			results = append(results, JudgeEvalResult{Case: judgeCase, Actual: actual})
+		}
+
+		if *verbose {
+			for _, result := range results {
+				if result.Actual != result.Case.Expected {
+					fmt.Printf("%sMisclassified%s (%s) expected %s got %s\n- Ground Truth Query: '%s'\n- Candidate Query:    '%s'\n",
+						boldRed, reset, result.Case.Note, result.Case.Expected, result.Actual, result.Case.GroundTruthSQL, result.Case.CandidateSQL)
+				}
+			}
+		}
+		printJudgeEvalReport(os.Stdout, evaluatorLLM.Name+ServiceModelSeperator+evaluatorLLM.Model, computeJudgeEvalMetrics(results))
+	}
+	return ExitOk
+}
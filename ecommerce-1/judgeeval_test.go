@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSqlQueryEvaluationType(t *testing.T) {
+	assert.Equal(t, FunctionalMatch, parseSqlQueryEvaluationType("Functional"))
+	assert.Equal(t, FunctionalMatch, parseSqlQueryEvaluationType(" functional.\n"))
+	assert.Equal(t, NoMatch, parseSqlQueryEvaluationType("\"None\""))
+	assert.Equal(t, ExactMatch, parseSqlQueryEvaluationType("Exact"))
+	assert.Equal(t, InvalidMatch, parseSqlQueryEvaluationType("The queries are functionally equivalent"))
+}
+
+func TestComputeJudgeEvalMetrics(t *testing.T) {
+	results := []JudgeEvalResult{
+		{Case: JudgeEvalCase{Expected: FunctionalMatch}, Actual: FunctionalMatch},
+		{Case: JudgeEvalCase{Expected: FunctionalMatch}, Actual: NoMatch},
+		{Case: JudgeEvalCase{Expected: NoMatch}, Actual: NoMatch},
+		{Case: JudgeEvalCase{Expected: NoMatch}, Actual: FunctionalMatch},
+		{Case: JudgeEvalCase{Expected: NoMatch}, Actual: InvalidMatch},
+		{Case: JudgeEvalCase{Expected: ExactMatch}, Actual: ExactMatch},
+	}
+	metrics := computeJudgeEvalMetrics(results)
+
+	assert.Equal(t, 6, metrics.Total)
+	assert.Equal(t, 3, metrics.Correct)
+	assert.Equal(t, 1, metrics.Confusion[NoMatch][InvalidMatch])
+
+	byClass := make(map[SqlQueryEvaluationType]JudgeClassMetrics)
+	for _, classMetrics := range metrics.PerClass {
+		byClass[classMetrics.Class] = classMetrics
+	}
+
+	precision, ok := byClass[FunctionalMatch].Precision()
+	assert.True(t, ok)
+	assert.InDelta(t, 0.5, precision, 0.001)
+	recall, ok := byClass[NoMatch].Recall()
+	assert.True(t, ok)
+	assert.InDelta(t, 1.0/3.0, recall, 0.001)
+
+	// never labelled Invalid so recall is undefined
+	_, ok = byClass[InvalidMatch].Recall()
+	assert.False(t, ok)
+}
+
+func TestLoadJudgeEvalCases(t *testing.T) {
+	cases, err := loadJudgeEvalCases(JudgeEvalDatasetFile)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, cases)
+	for _, judgeCase := range cases {
+		assert.NotEqual(t, InvalidMatch, judgeCase.Expected)
+		if judgeCase.Expected == ExactMatch {
+			assert.Equal(t, judgeCase.GroundTruthSQL, judgeCase.CandidateSQL)
+		}
+	}
+
+	badFile := filepath.Join(t.TempDir(), "bad.jsonl")
+	assert.NoError(t, os.WriteFile(badFile, []byte(`{"ground_truth_sql": "SELECT 1", "candidate_sql": "SELECT 2", "expected": "Maybe"}`), 0644))
+	_, err = loadJudgeEvalCases(badFile)
+	assert.Error(t, err)
+}
+
+func TestJudgeEvaluators(t *testing.T) {
+	model := &scriptedModel{}
+	llmClients := LLMClientsMap{
+		"b : two":   {Name: "b", Model: "two", Instance: model},
+		"a : one":   {Name: "a", Model: "one", Instance: model},
+		"c : three": {Name: "c", Model: "three"}, // failed to initialise
+		"a : zero":  {Name: "a", Model: "zero", Instance: model},
+	}
+	var names []string
+	for _, evaluator := range judgeEvaluators("all", llmClients) {
+		names = append(names, evaluator.Model)
+	}
+	assert.Equal(t, []string{"one", "zero", "two"}, names)
+	assert.Equal(t, "two", judgeEvaluators("b : two", llmClients)[0].Model)
+}
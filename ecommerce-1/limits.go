@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+const (
+	DefaultQueryTimeout   = 10 * time.Second
+	DefaultMaxResultRows  = 1000
+	DefaultMaxResultBytes = 1 << 20
+)
+
+// What happened when a generated query was run
+const (
+	QueryOutcomeOk        = "ok"
+	QueryOutcomeError     = "error"
+	QueryOutcomeTimeout   = "timeout"   // interrupted after QueryLimits.Timeout
+	QueryOutcomeTruncated = "truncated" // ran, but only the first rows within MaxRows and MaxBytes were kept
+)
+
+// How far a generated query is allowed to go. Zero means no limit.
+type QueryLimits struct {
+	Timeout  time.Duration
+	MaxRows  int
+	MaxBytes int // of the result as JSON
+}
+
+var ErrQueryTimeout = errors.New("query timed out")
+
+// Limits SQLite enforces itself on the connections generated SQL runs on. There's no limit on
+// the number of VM instructions: SQLite would need a progress handler for that (SQLITE_LIMIT_VDBE_OP
+// no longer does anything) and go-sqlite3 doesn't expose one, so runaway queries are stopped by
+// QueryLimits.Timeout instead, which interrupts them the same way.
+var sqliteLimits = map[int]int{
+	sqlite3.SQLITE_LIMIT_LENGTH:          1 << 20, // largest string or blob a query can make, e.g. with zeroblob()
+	sqlite3.SQLITE_LIMIT_SQL_LENGTH:      100_000,
+	sqlite3.SQLITE_LIMIT_EXPR_DEPTH:      100,
+	sqlite3.SQLITE_LIMIT_COMPOUND_SELECT: 50,
+	sqlite3.SQLITE_LIMIT_ATTACHED:        0, // no reaching other database files
+	sqlite3.SQLITE_LIMIT_TRIGGER_DEPTH:   10,
+}
+
+// go-sqlite3 doesn't have SQLITE_RECURSIVE, the authorizer's action for WITH RECURSIVE
+const sqliteRecursive = 33
+
+// Pragmas that only describe the schema, which pragma_table_info() and the like run
+var schemaPragmas = map[string]bool{
+	"table_info": true, "table_xinfo": true, "table_list": true, "foreign_key_list": true,
+	"index_list": true, "index_info": true, "index_xinfo": true,
+}
+
+// Stop SQL changing a database, checked as each statement is prepared so that, unlike PRAGMA
+// query_only, the SQL can't turn it off. Only reads, functions, recursive CTEs and the pragmas
+// describing the schema are allowed: no writes, other pragmas, ATTACH or transactions. Like the
+// limits, it's per connection.
+func restrictToReads(db *sql.DB) error {
+	return withSqliteConn(db, func(conn *sqlite3.SQLiteConn) error {
+		conn.RegisterAuthorizer(func(action int, arg1 string, _ string, _ string) int {
+			switch {
+			case action == sqlite3.SQLITE_SELECT || action == sqlite3.SQLITE_READ || action == sqlite3.SQLITE_FUNCTION || action == sqliteRecursive:
+				return sqlite3.SQLITE_OK
+			case action == sqlite3.SQLITE_PRAGMA && schemaPragmas[strings.ToLower(arg1)]:
+				return sqlite3.SQLITE_OK
+			}
+			return sqlite3.SQLITE_DENY
+		})
+		return nil
+	})
+}
+
+// Apply sqliteLimits to a database. Limits are per connection so this is only any use on
+// databases with a single long lived connection, like snapshots.
+func applySqliteLimits(db *sql.DB) error {
+	return withSqliteConn(db, func(conn *sqlite3.SQLiteConn) error {
+		for limit, value := range sqliteLimits {
+			conn.SetLimit(limit, value)
+		}
+		return nil
+	})
+}
+
+func queryContext(parent context.Context, limits QueryLimits) (context.Context, context.CancelFunc) {
+	if limits.Timeout > 0 {
+		return context.WithTimeout(parent, limits.Timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// Run a generated query within limits and return its result as JSON along with what happened.
+// A timeout returns ErrQueryTimeout so it can be told apart from the query being wrong.
+func runLimitedQuery(db *sql.DB, sqlQuery string, limits QueryLimits) (string, string, error) {
+	return runLimitedQueryContext(context.Background(), db, sqlQuery, limits)
+}
+
+// Same as runLimitedQuery but also stopping when ctx is done, e.g. when an API request times out
+func runLimitedQueryContext(parent context.Context, db *sql.DB, sqlQuery string, limits QueryLimits) (string, string, error) {
+	ctx, cancel := queryContext(parent, limits)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, sqlQuery)
+	if err == nil {
+		var result *ResultSet
+		var truncated bool
+		result, truncated, err = readResultSet(rows, limits.MaxRows, limits.MaxBytes)
+		rows.Close()
+		if err == nil {
+			if truncated {
+				return result.JSON(), QueryOutcomeTruncated, nil
+			}
+			return result.JSON(), QueryOutcomeOk, nil
+		}
+	}
+	if parent.Err() != nil {
+		return "", QueryOutcomeError, parent.Err()
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", QueryOutcomeTimeout, fmt.Errorf("%w after %s", ErrQueryTimeout, limits.Timeout)
+	}
+	return "", QueryOutcomeError, err
+}
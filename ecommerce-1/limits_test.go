@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunLimitedQuery(t *testing.T) {
+	source, err := initialiseDb(filepath.Join(t.TempDir(), "test.db"), testDbDefinition)
+	assert.NoError(t, err)
+	defer source.Close()
+	db, err := snapshotDb(source)
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, applySqliteLimits(db))
+	limits := QueryLimits{Timeout: 200 * time.Millisecond, MaxRows: 10, MaxBytes: 1000}
+
+	result, outcome, err := runLimitedQuery(db, `SELECT name FROM Customers ORDER BY id`, limits)
+	assert.NoError(t, err)
+	assert.Equal(t, QueryOutcomeOk, outcome)
+	assert.Equal(t, `{"columns":[{"name":"name","type":"TEXT"}],"rows":[["Customer 1"],["Customer 2"]]}`, result)
+
+	// an endless result is cut off rather than filling memory
+	result, outcome, err = runLimitedQuery(db, `WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n) SELECT x FROM n`, limits)
+	assert.NoError(t, err)
+	assert.Equal(t, QueryOutcomeTruncated, outcome)
+	assert.Equal(t, `{"columns":[{"name":"x"}],"rows":[[1],[2],[3],[4],[5],[6],[7],[8],[9],[10]]}`, result)
+
+	// and an endless query is interrupted
+	start := time.Now()
+	_, outcome, err = runLimitedQuery(db, `WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n) SELECT COUNT(*) FROM n`, limits)
+	assert.ErrorIs(t, err, ErrQueryTimeout)
+	assert.Equal(t, QueryOutcomeTimeout, outcome)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	_, outcome, err = runLimitedQuery(db, `SELECT nope FROM Customers`, limits)
+	assert.Error(t, err)
+	assert.Equal(t, QueryOutcomeError, outcome)
+
+	// the connection is still usable after all that, but can't reach other databases
+	_, outcome, err = runLimitedQuery(db, `SELECT COUNT(*) FROM Customers`, limits)
+	assert.NoError(t, err)
+	assert.Equal(t, QueryOutcomeOk, outcome)
+	_, err = db.Exec(`ATTACH DATABASE ':memory:' AS other`)
+	assert.Error(t, err)
+	_, outcome, err = runLimitedQuery(db, `SELECT length(zeroblob(10000000))`, limits)
+	assert.Error(t, err)
+	assert.Equal(t, QueryOutcomeError, outcome)
+}
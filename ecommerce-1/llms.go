@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 
 	"github.com/tmc/langchaingo/llms"
 	_ "github.com/tmc/langchaingo/llms/anthropic"
@@ -24,12 +26,16 @@ const (
 
 const ServiceModelSeperator = " : "
 
+// The model that generates SQL for ad hoc questions and judges queries unless told otherwise
+const DefaultEvaluator = "Ollama/OpenAI" + ServiceModelSeperator + "llama3"
+
 type LLMClient struct {
 	Name                   string
 	Model                  string
 	WeightsAccess          WeightsAccessType
 	NumParameters          string
 	InputContextWindowSize int
+	Price                  *ModelPrice // nil if unknown
 	Instance               llms.Model
 }
 
@@ -47,11 +53,39 @@ func getLLMClient(name, model string, clientsMap LLMClientsMap) *LLMClient {
 	return clientsMap[key]
 }
 
+// Whether a model's given as 'name : model', so commands can check their flags before looking it up
+func validModelName(nameAndModel string) bool {
+	return strings.Contains(nameAndModel, ServiceModelSeperator)
+}
+
+// Look up a client given as 'name : model', the way they're named on the command line
+func lookupLLMClient(nameAndModel string, clientsMap LLMClientsMap) *LLMClient {
+	name, model, found := strings.Cut(nameAndModel, ServiceModelSeperator)
+	if !found {
+		log.Fatalf("Model '%s' should be of the form 'name%smodel'", nameAndModel, ServiceModelSeperator)
+	}
+	return getLLMClient(name, model, clientsMap)
+}
+
+// Clients in a stable order (by key) so runs and reports list models consistently
+func sortedLLMClients(clientsMap LLMClientsMap) []*LLMClient {
+	keys := make([]string, 0, len(clientsMap))
+	for key := range clientsMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	clients := make([]*LLMClient, 0, len(keys))
+	for _, key := range keys {
+		clients = append(clients, clientsMap[key])
+	}
+	return clients
+}
+
 func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 
 	clients := []LLMClient{
 		{
-			Name: "Ollama/OpenAI", Model: "llama3", WeightsAccess: Open, NumParameters: "8b", InputContextWindowSize: 8192,
+			Name: "Ollama/OpenAI", Model: "llama3", WeightsAccess: Open, NumParameters: "8b", InputContextWindowSize: 8192, Price: LocalModelPrice,
 			Instance: func() llms.Model {
 				model, err := openai.New(openai.WithModel("llama3:instruct"), openai.WithBaseURL(localServerUrl))
 				if err != nil {
@@ -62,7 +96,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 			}(),
 		},
 		// {
-		// 	Name: "Groq", Model: "llama3-8b-8192", WeightsAccess: Open, NumParameters: "8b", InputContextWindowSize: 8192,
+		// 	Name: "Groq", Model: "llama3-8b-8192", WeightsAccess: Open, NumParameters: "8b", InputContextWindowSize: 8192, Price: &ModelPrice{InputPerMillion: 0.05, OutputPerMillion: 0.08},
 		// 	Instance: func() llms.Model {
 		// 		model, err := openai.New(
 		// 			openai.WithModel("llama3-8b-8192"),
@@ -77,7 +111,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 		// 	}(),
 		// },
 		// {
-		// 	Name: "Groq", Model: "llama3-70b-8192", WeightsAccess: Open, NumParameters: "70b", InputContextWindowSize: 8192,
+		// 	Name: "Groq", Model: "llama3-70b-8192", WeightsAccess: Open, NumParameters: "70b", InputContextWindowSize: 8192, Price: &ModelPrice{InputPerMillion: 0.59, OutputPerMillion: 0.79},
 		// 	Instance: func() llms.Model {
 		// 		model, err := openai.New(
 		// 			openai.WithModel("llama3-70b-8192"),
@@ -107,7 +141,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 		// 	}(),
 		// },
 		// {
-		// 	Name: "Ollama/OpenAI", Model: "codestral-22B-v0.1", WeightsAccess: Open, NumParameters: "22b", InputContextWindowSize: 32768,
+		// 	Name: "Ollama/OpenAI", Model: "codestral-22B-v0.1", WeightsAccess: Open, NumParameters: "22b", InputContextWindowSize: 32768, Price: LocalModelPrice,
 		// 	Instance: func() llms.Model {
 		// 		model, err := openai.New(openai.WithModel("codestral"), openai.WithBaseURL(localServerUrl))
 		// 		if err != nil {
@@ -118,7 +152,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 		// 	}(),
 		// },
 		// {
-		// 	Name: "Ollama/OpenAI", Model: "qwen2:0.5b", WeightsAccess: Open, NumParameters: "0.5b", InputContextWindowSize: 32768,
+		// 	Name: "Ollama/OpenAI", Model: "qwen2:0.5b", WeightsAccess: Open, NumParameters: "0.5b", InputContextWindowSize: 32768, Price: LocalModelPrice,
 		// 	Instance: func() llms.Model {
 		// 		model, err := openai.New(openai.WithModel("qwen2:0.5b"), openai.WithBaseURL(localServerUrl))
 		// 		if err != nil {
@@ -129,7 +163,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 		// 	}(),
 		// },
 		{
-			Name: "Ollama/OpenAI", Model: "qwen2:1.5b", WeightsAccess: Open, NumParameters: "1.5b", InputContextWindowSize: 32768,
+			Name: "Ollama/OpenAI", Model: "qwen2:1.5b", WeightsAccess: Open, NumParameters: "1.5b", InputContextWindowSize: 32768, Price: LocalModelPrice,
 			Instance: func() llms.Model {
 				model, err := openai.New(openai.WithModel("qwen2:1.5b"), openai.WithBaseURL(localServerUrl))
 				if err != nil {
@@ -140,7 +174,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 			}(),
 		},
 		// {
-		// 	Name: "Ollama/OpenAI", Model: "qwen2:7b", WeightsAccess: Open, NumParameters: "7b", InputContextWindowSize: 131072,
+		// 	Name: "Ollama/OpenAI", Model: "qwen2:7b", WeightsAccess: Open, NumParameters: "7b", InputContextWindowSize: 131072, Price: LocalModelPrice,
 		// 	Instance: func() llms.Model {
 		// 		model, err := openai.New(openai.WithModel("qwen2:7b"), openai.WithBaseURL(localServerUrl))
 		// 		if err != nil {
@@ -151,7 +185,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 		// 	}(),
 		// },
 		// {
-		// 	Name: "Ollama/OpenAI", Model: "phi3:mini", WeightsAccess: Open, NumParameters: "3.8b", InputContextWindowSize: 4096,
+		// 	Name: "Ollama/OpenAI", Model: "phi3:mini", WeightsAccess: Open, NumParameters: "3.8b", InputContextWindowSize: 4096, Price: LocalModelPrice,
 		// 	Instance: func() llms.Model {
 		// 		model, err := openai.New(openai.WithModel("phi3:mini"), openai.WithBaseURL(localServerUrl))
 		// 		if err != nil {
@@ -162,7 +196,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 		// 	}(),
 		// },
 		// {
-		// 	Name: "Ollama/OpenAI", Model: "phi3:medium", WeightsAccess: Open, NumParameters: "14b", InputContextWindowSize: 4096,
+		// 	Name: "Ollama/OpenAI", Model: "phi3:medium", WeightsAccess: Open, NumParameters: "14b", InputContextWindowSize: 4096, Price: LocalModelPrice,
 		// 	Instance: func() llms.Model {
 		// 		model, err := openai.New(openai.WithModel("phi3:medium"), openai.WithBaseURL(localServerUrl))
 		// 		if err != nil {
@@ -173,7 +207,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 		// 	}(),
 		// },
 		// {
-		// 	Name: "Ollama/OpenAI", Model: "phi3:medium-128k", WeightsAccess: Open, NumParameters: "14b", InputContextWindowSize: 131072,
+		// 	Name: "Ollama/OpenAI", Model: "phi3:medium-128k", WeightsAccess: Open, NumParameters: "14b", InputContextWindowSize: 131072, Price: LocalModelPrice,
 		// 	Instance: func() llms.Model {
 		// 		model, err := openai.New(openai.WithModel("phi3:medium-128k"), openai.WithBaseURL(localServerUrl))
 		// 		if err != nil {
@@ -184,7 +218,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 		// 	}(),
 		// },
 		// {
-		// 	Name: "Cohere", Model: "Command-R+", WeightsAccess: Open, NumParameters: "104b", InputContextWindowSize: 131072,
+		// 	Name: "Cohere", Model: "Command-R+", WeightsAccess: Open, NumParameters: "104b", InputContextWindowSize: 131072, Price: &ModelPrice{InputPerMillion: 3, OutputPerMillion: 15},
 		// 	Instance: func() llms.Model {
 		// 		model, err := cohere.New(
 		// 			cohere.WithModel("command-r-plus"),
@@ -198,7 +232,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 		// 	}(),
 		// },
 		// {
-		// 	Name: "Anthropic", Model: "claude-3-haiku-20240307", WeightsAccess: Closed, NumParameters: "?", InputContextWindowSize: 4096,
+		// 	Name: "Anthropic", Model: "claude-3-haiku-20240307", WeightsAccess: Closed, NumParameters: "?", InputContextWindowSize: 4096, Price: &ModelPrice{InputPerMillion: 0.25, OutputPerMillion: 1.25},
 		// 	Instance: func() llms.Model {
 		// 		model, err := anthropic.New(anthropic.WithModel("claude-3-haiku-20240307"))
 		// 		if err != nil {
@@ -209,7 +243,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 		// 	}(),
 		// },
 		// {
-		// 	Name: "Anthropic", Model: "claude-3-sonnet-20240229", WeightsAccess: Closed, NumParameters: "?", InputContextWindowSize: 4096,
+		// 	Name: "Anthropic", Model: "claude-3-sonnet-20240229", WeightsAccess: Closed, NumParameters: "?", InputContextWindowSize: 4096, Price: &ModelPrice{InputPerMillion: 3, OutputPerMillion: 15},
 		// 	Instance: func() llms.Model {
 		// 		model, err := anthropic.New(anthropic.WithModel("claude-3-sonnet-20240229"))
 		// 		if err != nil {
@@ -220,7 +254,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 		// 	}(),
 		// },
 		// {
-		// 	Name: "Google AI", Model: "Gemini Flash 1.5", WeightsAccess: Closed, NumParameters: "?", InputContextWindowSize: 1048576,
+		// 	Name: "Google AI", Model: "Gemini Flash 1.5", WeightsAccess: Closed, NumParameters: "?", InputContextWindowSize: 1048576, Price: &ModelPrice{InputPerMillion: 0.35, OutputPerMillion: 1.05},
 		// 	Instance: func() llms.Model {
 		// 		apiKey := os.Getenv("GEMINI_API_KEY")
 		// 		model, err := googleai.New(context.Background(),
@@ -245,7 +279,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 		// 	}(),
 		// },
 		// {
-		// 	Name: "Llamafile", Model: "open-mistral-7b", WeightsAccess: Open, NumParameters: "7b", InputContextWindowSize: 8192,
+		// 	Name: "Llamafile", Model: "open-mistral-7b", WeightsAccess: Open, NumParameters: "7b", InputContextWindowSize: 8192, Price: LocalModelPrice,
 		// 	Instance: func() llms.Model {
 		// 		options := []llamafile.Option{
 		// 			llamafile.WithEmbeddingSize(2048),
@@ -260,7 +294,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 		// 	}(),
 		// },
 		// {
-		// 	Name: "Ollama", Model: "llama3:instruct", WeightsAccess: Open, NumParameters: "8b", InputContextWindowSize: 8192,
+		// 	Name: "Ollama", Model: "llama3:instruct", WeightsAccess: Open, NumParameters: "8b", InputContextWindowSize: 8192, Price: LocalModelPrice,
 		// 	Instance: func() llms.Model {
 		// 		model, err := ollama.New(ollama.WithModel("llama3:instruct"))
 		// 		if err != nil {
@@ -271,7 +305,7 @@ func initialiseLLMClients(localServerUrl string) map[string]*LLMClient {
 		// 	}(),
 		// },
 		// {
-		// 	Name: "OpenAI GPT-4-turbo-preview", Model: "gpt-4-turbo-preview", WeightsAccess: Open, NumParameters: "?", InputContextWindowSize: 8192,
+		// 	Name: "OpenAI GPT-4-turbo-preview", Model: "gpt-4-turbo-preview", WeightsAccess: Open, NumParameters: "?", InputContextWindowSize: 8192, Price: &ModelPrice{InputPerMillion: 10, OutputPerMillion: 30},
 		// 	Instance: func() llms.Model {
 		// 		model, err := openai.New(openai.WithModel("gpt-4-turbo-preview"))
 		// 		if err != nil {
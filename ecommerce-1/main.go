@@ -1,19 +1,15 @@
 package main
 
 import (
-	"bytes"
 	"database/sql"
-	"encoding/csv"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"strings"
+	"time"
 )
 
-const GroundTruthMdFile = "ground-truth.md"
 const NoSeed = -1
 const (
 	boldRed   = "\033[1;31m"
@@ -21,58 +17,11 @@ const (
 	reset     = "\033[0m"
 )
 
-// Determine what kind of match we have between the ground truth and the generated SQL query.
-
-type GroundTruthItem struct {
-	Query  string
-	SQL    string
-	Result string
-}
-
 type FailedSqlQueryAttempt struct {
 	SqlQuery     string
 	ErrorMessage string
 }
 
-func loadGroundTruthCsv(filename string) ([]GroundTruthItem, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	var groundTruth []GroundTruthItem
-
-	// Skip the header row if your CSV has headers
-	_, err = reader.Read()
-	if err != nil {
-		return nil, err
-	}
-
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-		if len(record) < 3 {
-			continue // skip rows that do not have enough columns
-		}
-
-		item := GroundTruthItem{
-			Query:  record[0],
-			SQL:    record[1],
-			Result: record[2],
-		}
-		groundTruth = append(groundTruth, item)
-	}
-
-	return groundTruth, nil
-}
-
 // func createOpenAiClient(baseUrl string, model *string) *openai.Client {
 // 	var apiKey string
 // 	if baseUrl == "" {
@@ -108,64 +57,11 @@ func loadGroundTruthCsv(filename string) ([]GroundTruthItem, error) {
 
 // Take some Row rules and conver them to JSON format for easy parsing
 func rows2Json(rows *sql.Rows) (string, error) {
-	// Retrieve column names
-	cols, err := rows.Columns()
+	result, _, err := readResultSet(rows, 0, 0)
 	if err != nil {
 		return "", err
 	}
-
-	// Prepare slices for scanning
-	colVals := make([]interface{}, len(cols))
-	scanArgs := make([]interface{}, len(colVals))
-	for i := range colVals {
-		scanArgs[i] = &colVals[i]
-	}
-
-	// Initialize a slice to hold all rows
-	allRows := make([]map[string]interface{}, 0)
-
-	// Iterate over rows
-	for rows.Next() {
-		rowMap := make(map[string]interface{})
-		if err := rows.Scan(scanArgs...); err != nil {
-			return "", err
-		}
-
-		for i, col := range cols {
-			// Ensure the values are properly formatted for JSON
-			var value interface{}
-			byteVal, ok := colVals[i].([]byte)
-			if ok {
-				value = string(byteVal)
-			} else {
-				value = colVals[i]
-			}
-			rowMap[col] = value
-		}
-
-		allRows = append(allRows, rowMap)
-	}
-
-	// Handle any errors from iterating over rows
-	if err := rows.Err(); err != nil {
-		return "", err
-	}
-
-	// Convert allRows to JSON
-	jsonData, err := json.Marshal(allRows)
-	if err != nil {
-		return "", err
-	}
-
-	//return string(jsonData), nil
-	var compactedJSON bytes.Buffer
-	err = json.Compact(&compactedJSON, jsonData)
-	if err != nil {
-		return "", err
-	}
-
-	return compactedJSON.String(), nil
-
+	return result.JSON(), nil
 }
 
 func stripNewlines(s string) string {
@@ -173,12 +69,42 @@ func stripNewlines(s string) string {
 }
 
 func main() {
-	// deal with command line flags first
-	baseURL := flag.String("base-url", "", "Base URL for the API server")
-	maxTokens := flag.Int("max-tokens", 200, "Maximum number of tokens in the summary")
+	os.Exit(runCli(os.Args[1:]))
+}
+
+// run: evaluate every model over the ground truth of one or more dataset packs
+func runBenchmark(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	baseURL := flags.String("base-url", "", "Base URL for the API server")
+	maxTokens := flags.Int("max-tokens", 200, "Maximum number of tokens in the summary")
 	var seed int
-	flag.IntVar(&seed, "seed", NoSeed, "Seed for deterministic (in theory) results (optional)")
-	flag.Parse()
+	flags.IntVar(&seed, "seed", NoSeed, "Seed for deterministic (in theory) results (optional)")
+	packsDir := flags.String("packs-dir", DefaultPacksDir, "Directory containing dataset packs")
+	packNames := flags.String("pack", DefaultPack, "Comma separated dataset packs to evaluate, or 'all'")
+	askParaphrases := flags.Bool("paraphrases", false, "Also ask every alternate phrasing of each ground truth question")
+	resultsDir := flags.String("results-dir", DefaultResultsDir, "Directory the run results are saved in")
+	queryTimeout := flags.Duration("query-timeout", DefaultQueryTimeout, "Longest a generated query can run before it's interrupted, the only limit on the work it does (0 for no limit)")
+	maxRows := flags.Int("max-rows", DefaultMaxResultRows, "Most rows of a generated query's result that are kept, which doesn't limit the work it does (0 for no limit)")
+	maxResultBytes := flags.Int("max-result-bytes", DefaultMaxResultBytes, "Most bytes of a generated query's result, as JSON, that are kept, which doesn't limit the work it does (0 for no limit)")
+	dialect := flags.String("dialect", DefaultDialect, "SQL dialect the models are asked to write: sqlite, postgresql or mysql")
+	translateDialect := flags.Bool("translate-dialect", true, "Rewrite constructs from other dialects (ILIKE, ::, EXTRACT, ...) into SQLite before running generated SQL")
+	stream := flags.Bool("stream", true, "Show generated SQL and verdicts as they arrive")
+	earlyStop := flags.Bool("early-stop", true, "Stop generating once the SQL statement, or the evaluator's verdict, is complete")
+	schemaLinking := flags.String("schema-linking", DefaultSchemaLinking, "How each question's tables are picked from schemas of more than 4: off, lexical or model")
+	valueHints := flags.Bool("value-hints", true, "Tell the models about values in the database each question refers to")
+	glossary := flags.String("glossary", DefaultGlossary, "Whether packs' glossaries of business terms are used: on, off, or compare to run every model without and with them")
+	snapshot := flags.String("snapshot", SnapshotPerModel, "Run generated SQL against an in-memory copy of each pack's database per 'model' or per 'run'")
+	flags.Parse(args)
+
+	if !validSnapshotMode(*snapshot) || !validDialect(*dialect) || !validGlossaryMode(*glossary) || !validSchemaLinking(*schemaLinking) {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	packs, err := findDatasetPacks(*packsDir, *packNames)
+	if err != nil {
+		log.Fatalf("Failed to find dataset packs: %v", err)
+	}
 
 	llmClients := initialiseLLMClients(*baseURL)
 	// print out the initialisers: name and model
@@ -191,94 +117,49 @@ func main() {
 	LLMevaluator := getLLMClient("Ollama/OpenAI", "llama3", llmClients)
 	fmt.Printf("Evaluator selected %s %s\n", LLMevaluator.Name, LLMevaluator.Model)
 
-	// ensure our db exists and has the content we want to test against
-	db, err := initialiseDb("ecommerce-autogen.db")
-	if err != nil {
-		fmt.Println(err)
+	config := BenchmarkConfig{
+		MaxTokens:        maxTokens,
+		Seed:             seed,
+		Evaluator:        LLMevaluator,
+		AskParaphrases:   *askParaphrases,
+		Snapshot:         *snapshot,
+		Limits:           QueryLimits{Timeout: *queryTimeout, MaxRows: *maxRows, MaxBytes: *maxResultBytes},
+		Dialect:          *dialect,
+		TranslateDialect: *translateDialect,
+		Streaming:        Streaming{EarlyStop: *earlyStop},
+		SchemaLinking:    *schemaLinking,
+		ValueHints:       *valueHints,
+		Glossary:         *glossary,
 	}
-
-	// ensure we have our ground truth MD file in a CSV file for easy processing
-	groundTruthCsvFile, err := convertMdWithSingleTableToCsv(GroundTruthMdFile)
-	if err != nil {
-		log.Fatalf("Failed to convert MD to CSV: %v", err)
-		// load the ground truth
+	if *stream {
+		config.Streaming.Progress = os.Stdout
 	}
-	groundTruth, err := loadGroundTruthCsv(groundTruthCsvFile)
-	if err != nil {
-		log.Fatalf("Failed to load CSV: %v", err)
+	runRecord := &RunRecord{
+		StartedAt:     time.Now(),
+		Seed:          seed,
+		MaxTokens:     *maxTokens,
+		Dialect:       *dialect,
+		SchemaLinking: *schemaLinking,
+		ValueHints:    *valueHints,
+		Glossary:      *glossary,
+		Evaluator:     LLMevaluator.Name + ServiceModelSeperator + LLMevaluator.Model,
 	}
-	//fmt.Printf("Loaded %d ground truth items\n", len(groundTruth))
 
-	// do the AI stuff to predict the SQL query from natural language
-
-	for _, llmClient := range llmClients {
-		fmt.Printf("\n\n=======================================\n")
-		fmt.Printf("Using model: %s %s\n", llmClient.Name, llmClient.Model)
-
-		systemPrompt := SqlGeneratorApiSystemPrompt + strings.Join(TABLES, "\n")
-
-		for _, item := range groundTruth {
-			var failedAttempts []FailedSqlQueryAttempt
-			var predictedSqlQuery string
-			var err error
-			fmt.Printf("\n==== %s: %s\n", llmClient.Name, llmClient.Model)
-
-			successfulSqlQuery := false
-
-			for len(failedAttempts) <= MaxSqlGenerationFaultRetries && !successfulSqlQuery {
-				// predict the SQL query from the natural language query
-				// print out the natural query
-				fmt.Printf("Query: %s\n", item.Query)
-				predictedSqlQuery, err = predictSqlQueryFromNaturalLanguageQuery(llmClient.Instance, maxTokens, systemPrompt, &item.Query, seed, failedAttempts)
-				if err != nil {
-					log.Printf("Error predicting SQL for query '%s': %v\n", item.Query, err)
-					break
-				}
-				// SQL statements are often multi-line but work on a single line so for readability we compress it to a single line
-				predictedSqlQuery = stripNewlines(predictedSqlQuery)
-
-				// Execute the SQL query
-				rows, err := db.Query(predictedSqlQuery)
-
-				// SQL query failed so let's regenerate the query
-				// taking into account this and previous errors
-				// by including them in the message sent to the LLM, and try again.
-				if err != nil {
-					log.Printf("! Error executing query '%s' (%s) generating a new query", predictedSqlQuery, err.Error())
-					failedAttempts = append(failedAttempts, FailedSqlQueryAttempt{
-						// Compress the sql query to a single line
-						SqlQuery:     predictedSqlQuery,
-						ErrorMessage: stripNewlines(err.Error()),
-					})
-
-					// generating the query was successful, so let's compare against ground truth
-				} else {
-					successfulSqlQuery = true
-					fmt.Printf("- Ground Truth Query: '%s'\n", item.SQL)
-					fmt.Printf("- Generated Query:    '%s'\n", predictedSqlQuery)
-
-					sqlQueryComparison, err := compareSqlQueries(item.SQL, predictedSqlQuery, LLMevaluator, maxTokens, seed)
-					if err != nil {
-						log.Printf("Error comparing SQL queries: %v", err)
-					}
-					fmt.Printf("- SQL Query Comparison result: %s\n", sqlQueryComparison)
-					jsonRows, _ := rows2Json(rows)
-
-					fmt.Printf("- Ground Truth Result:%s\n", item.Result)
-					fmt.Printf("- SQL Result:         %s\n", jsonRows)
-
-					if item.Result == jsonRows {
-						fmt.Printf("- And they are the %ssame%s\n\n", boldGreen, reset)
-					} else {
-						fmt.Printf("- And they are %sdifferent%s\n\n", boldRed, reset)
-					}
-
-				}
-			}
-
-			if !successfulSqlQuery {
-				log.Printf("Failed to execute a valid query after %d attempts for query '%s'.", MaxSqlGenerationFaultRetries+1, item.Query)
-			}
+	// do the AI stuff to predict the SQL query from natural language, one pack at a time
+	for _, pack := range packs {
+		packRecord, err := runPackBenchmark(pack, sortedLLMClients(llmClients), config)
+		if err != nil {
+			log.Fatalf("Failed to evaluate pack %s: %v", pack.Name, err)
 		}
+		runRecord.Packs = append(runRecord.Packs, packRecord)
+	}
+	runRecord.FinishedAt = time.Now()
+
+	printRunSummary(os.Stdout, runRecord)
+	resultsFile, err := saveRunRecord(*resultsDir, runRecord)
+	if err != nil {
+		log.Fatalf("Failed to save results: %v", err)
 	}
+	fmt.Printf("\nResults saved to %s\n", resultsFile)
+	return ExitOk
 }
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// The Model Context Protocol revision spoken: JSON-RPC 2.0, one message per line over stdio
+const McpProtocolVersion = "2024-11-05"
+
+const McpSchemaResourceUri = "text2sql://schema"
+
+// JSON-RPC error codes
+const (
+	JsonRpcParseError     = -32700
+	JsonRpcInvalidRequest = -32600
+	JsonRpcMethodNotFound = -32601
+	JsonRpcInvalidParams  = -32602
+)
+
+type jsonRpcRequest struct {
+	JsonRpc string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"` // none for notifications, which get no response
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type jsonRpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *jsonRpcError) Error() string {
+	return err.Message
+}
+
+type jsonRpcResponse struct {
+	JsonRpc string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *jsonRpcError   `json:"error,omitempty"`
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Tools report their own failures in their result rather than as protocol errors, so the
+// model calling them gets to see what went wrong
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+	call        func(server *McpServer, ctx context.Context, arguments map[string]any) (string, error)
+}
+
+func mcpStringArgument(arguments map[string]any, name string) (string, error) {
+	value, _ := arguments[name].(string)
+	if strings.TrimSpace(value) == "" {
+		return "", &jsonRpcError{JsonRpcInvalidParams, fmt.Sprintf("%s is required", name)}
+	}
+	return value, nil
+}
+
+func mcpInputSchema(required string, description string) map[string]any {
+	return map[string]any{
+		"type":       "object",
+		"properties": map[string]any{required: map[string]any{"type": "string", "description": description}},
+		"required":   []string{required},
+	}
+}
+
+var mcpTools = []mcpTool{
+	{
+		Name:        "list_tables",
+		Description: "List the tables and views in the database",
+		InputSchema: map[string]any{"type": "object", "properties": map[string]any{}},
+		call: func(server *McpServer, ctx context.Context, arguments map[string]any) (string, error) {
+			tables, err := listTables(ctx, server.Asker.Db)
+			return strings.Join(tables, "\n"), err
+		},
+	},
+	{
+		Name:        "describe_table",
+		Description: "Describe a table's columns, keys and size, with the SQL that created it",
+		InputSchema: mcpInputSchema("table", "Name of the table, as list_tables gives it"),
+		call: func(server *McpServer, ctx context.Context, arguments map[string]any) (string, error) {
+			table, err := mcpStringArgument(arguments, "table")
+			if err != nil {
+				return "", err
+			}
+			return describeTable(ctx, server.Asker.Db, table)
+		},
+	},
+	{
+		Name:        "generate_sql",
+		Description: "Write SQL that answers a question about the database. The SQL is checked it compiles, and generated again if not, but isn't run.",
+		InputSchema: mcpInputSchema("question", "The question, in plain language"),
+		call: func(server *McpServer, ctx context.Context, arguments map[string]any) (string, error) {
+			question, err := mcpStringArgument(arguments, "question")
+			if err != nil {
+				return "", err
+			}
+			answer, err := server.Asker.Answer(ctx, question, false)
+			if err != nil {
+				return "", err
+			}
+			return answer.Runnable(), nil
+		},
+	},
+	{
+		Name:        "run_readonly_query",
+		Description: "Run a SQL query against the database, which is read only, and return its result as a Markdown table",
+		InputSchema: mcpInputSchema("sql", "SQLite SQL to run"),
+		call: func(server *McpServer, ctx context.Context, arguments map[string]any) (string, error) {
+			sqlQuery, err := mcpStringArgument(arguments, "sql")
+			if err != nil {
+				return "", err
+			}
+			jsonRows, outcome, err := runLimitedQueryContext(ctx, server.Asker.Db, sqlQuery, server.Asker.Limits)
+			if err != nil {
+				return "", err
+			}
+			result, err := parseResultSet(jsonRows)
+			if err != nil {
+				return "", err
+			}
+			if outcome == QueryOutcomeTruncated {
+				return fmt.Sprintf("%s(only the first %d rows)", result.Markdown(), len(result.Rows)), nil
+			}
+			return fmt.Sprintf("%s(%d rows)", result.Markdown(), len(result.Rows)), nil
+		},
+	},
+}
+
+// Tables and views, as SQL can refer to them
+func listTables(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+func describeTable(ctx context.Context, db *sql.DB, table string) (string, error) {
+	var name, kind, createSql string
+	err := db.QueryRowContext(ctx, `SELECT name, type, sql FROM sqlite_master WHERE type IN ('table', 'view') AND name = ? COLLATE NOCASE`, table).Scan(&name, &kind, &createSql)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("no table named '%s', see list_tables", table)
+	}
+	if err != nil {
+		return "", err
+	}
+	quoted := `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+
+	var rowCount int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+quoted).Scan(&rowCount); err != nil {
+		return "", err
+	}
+	foreignKeys := make(map[string]string)
+	rows, err := db.QueryContext(ctx, `SELECT "from", "table", "to" FROM pragma_foreign_key_list(?)`, name)
+	if err != nil {
+		return "", err
+	}
+	for rows.Next() {
+		var from, toTable string
+		var to sql.NullString // the referenced table's primary key when not given
+		if err := rows.Scan(&from, &toTable, &to); err != nil {
+			rows.Close()
+			return "", err
+		}
+		foreignKeys[from] = fmt.Sprintf("references %s(%s)", toTable, to.String)
+	}
+	rows.Close()
+
+	var description strings.Builder
+	fmt.Fprintf(&description, "%s %s, %d rows\nColumns:\n", kind, name, rowCount)
+	rows, err = db.QueryContext(ctx, `SELECT name, type, "notnull", pk FROM pragma_table_info(?) ORDER BY cid`, name)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var column, columnType string
+		var notNull, primaryKey int
+		if err := rows.Scan(&column, &columnType, &notNull, &primaryKey); err != nil {
+			return "", err
+		}
+		details := []string{}
+		if columnType != "" {
+			details = append(details, columnType)
+		}
+		if primaryKey > 0 {
+			details = append(details, "primary key")
+		}
+		if notNull != 0 {
+			details = append(details, "not null")
+		}
+		if foreignKey, ok := foreignKeys[column]; ok {
+			details = append(details, foreignKey)
+		}
+		fmt.Fprintf(&description, "- %s: %s\n", column, strings.Join(details, ", "))
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(&description, "\n%s;\n", createSql)
+	return description.String(), nil
+}
+
+// The database and generator as an MCP server, for agent frameworks to use as tools
+type McpServer struct {
+	Asker       *Asker
+	ToolTimeout time.Duration // 0 for none
+}
+
+func (server *McpServer) callTool(params json.RawMessage) (*mcpToolResult, error) {
+	var call struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &call); err != nil {
+		return nil, &jsonRpcError{JsonRpcInvalidParams, err.Error()}
+	}
+	for _, tool := range mcpTools {
+		if tool.Name != call.Name {
+			continue
+		}
+		ctx := context.Background()
+		if server.ToolTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, server.ToolTimeout)
+			defer cancel()
+		}
+		text, err := tool.call(server, ctx, call.Arguments)
+		var protocolErr *jsonRpcError
+		if errors.As(err, &protocolErr) {
+			return nil, protocolErr
+		}
+		if err != nil {
+			return &mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+		}
+		return &mcpToolResult{Content: []mcpContent{{Type: "text", Text: text}}}, nil
+	}
+	return nil, &jsonRpcError{JsonRpcInvalidParams, fmt.Sprintf("no tool named '%s'", call.Name)}
+}
+
+func (server *McpServer) readResource(params json.RawMessage) (any, error) {
+	var read struct {
+		Uri string `json:"uri"`
+	}
+	if err := json.Unmarshal(params, &read); err != nil {
+		return nil, &jsonRpcError{JsonRpcInvalidParams, err.Error()}
+	}
+	if read.Uri != McpSchemaResourceUri {
+		return nil, &jsonRpcError{JsonRpcInvalidParams, fmt.Sprintf("no resource %s", read.Uri)}
+	}
+	return map[string]any{"contents": []map[string]string{{"uri": McpSchemaResourceUri, "mimeType": "text/plain", "text": server.Asker.Schema}}}, nil
+}
+
+func (server *McpServer) handle(request *jsonRpcRequest) (any, error) {
+	switch request.Method {
+	case "initialize":
+		return map[string]any{
+			"protocolVersion": McpProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}, "resources": map[string]any{}},
+			"serverInfo":      map[string]string{"name": "text2sql", "version": "1"},
+			"instructions":    fmt.Sprintf("Answers questions about a SQLite database. The model is asked to write %s SQL.", server.Asker.Dialect),
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": mcpTools}, nil
+	case "tools/call":
+		return server.callTool(request.Params)
+	case "resources/list":
+		return map[string]any{"resources": []map[string]string{{
+			"uri": McpSchemaResourceUri, "name": "schema", "mimeType": "text/plain",
+			"description": "The database schema as the SQL generator is shown it",
+		}}}, nil
+	case "resources/read":
+		return server.readResource(request.Params)
+	}
+	return nil, &jsonRpcError{JsonRpcMethodNotFound, fmt.Sprintf("unknown method %s", request.Method)}
+}
+
+// Answer requests one at a time until in ends
+func (server *McpServer) Serve(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxRequestBytes)
+	encoder := json.NewEncoder(out)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var request jsonRpcRequest
+		response := jsonRpcResponse{JsonRpc: "2.0", ID: json.RawMessage("null")}
+		if err := json.Unmarshal([]byte(line), &request); err != nil {
+			response.Error = &jsonRpcError{JsonRpcParseError, err.Error()}
+		} else if request.JsonRpc != "2.0" || request.Method == "" {
+			response.Error = &jsonRpcError{JsonRpcInvalidRequest, "not a JSON-RPC 2.0 request"}
+		} else {
+			if request.ID == nil {
+				continue // notifications, e.g. notifications/initialized, need nothing doing
+			}
+			response.ID = request.ID
+			result, err := server.handle(&request)
+			var protocolErr *jsonRpcError
+			if errors.As(err, &protocolErr) {
+				response.Error = protocolErr
+			} else if err != nil {
+				response.Error = &jsonRpcError{JsonRpcInvalidParams, err.Error()}
+			} else {
+				response.Result = result
+			}
+		}
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// mcp: the database and generator as an MCP server over stdio
+func runMcp(args []string) int {
+	// stdout belongs to the protocol, so everything else printed along the way goes to stderr
+	protocolOut := os.Stdout
+	os.Stdout = os.Stderr
+
+	flags := flag.NewFlagSet("mcp", flag.ExitOnError)
+	options := addAskFlags(flags)
+	toolTimeout := flags.Duration("tool-timeout", DefaultRequestTimeout, "Longest a tool call can take, retries included (0 for no limit)")
+	flags.Parse(args)
+	if !options.valid() || flags.NArg() > 0 {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	asker := options.openReadOnly()
+	defer asker.Db.Close()
+	server := &McpServer{Asker: asker, ToolTimeout: *toolTimeout}
+	if err := server.Serve(os.Stdin, protocolOut); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+	return ExitOk
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMcpServer(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE Customers (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+CREATE TABLE Orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES Customers(id), shipping_status TEXT);
+INSERT INTO Orders (shipping_status) VALUES ('pending'), ('shipped'), ('shipped');`)
+	assert.NoError(t, err)
+	assert.NoError(t, restrictToReads(db))
+
+	model := &scriptedModel{responses: []string{"SELECT COUNT(*) FROM Order", "SELECT COUNT(*) FROM Orders"}}
+	maxTokens := 200
+	server := &McpServer{Asker: &Asker{Db: db, Model: model, Schema: "CREATE TABLE Orders (id INTEGER PRIMARY KEY);", Dialect: DialectSQLite,
+		MaxTokens: &maxTokens, Seed: NoSeed, Limits: QueryLimits{MaxRows: 1}}}
+
+	requests := []string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2024-11-05", "capabilities": {}, "clientInfo": {"name": "test", "version": "1"}}}`,
+		`{"jsonrpc": "2.0", "method": "notifications/initialized"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "tools/list"}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "tools/call", "params": {"name": "list_tables", "arguments": {}}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "tools/call", "params": {"name": "describe_table", "arguments": {"table": "orders"}}}`,
+		`{"jsonrpc": "2.0", "id": 5, "method": "tools/call", "params": {"name": "generate_sql", "arguments": {"question": "How many orders are there?"}}}`,
+		`{"jsonrpc": "2.0", "id": 6, "method": "tools/call", "params": {"name": "run_readonly_query", "arguments": {"sql": "SELECT id FROM Orders"}}}`,
+		`{"jsonrpc": "2.0", "id": 7, "method": "tools/call", "params": {"name": "run_readonly_query", "arguments": {"sql": "DELETE FROM Orders"}}}`,
+		`{"jsonrpc": "2.0", "id": 8, "method": "tools/call", "params": {"name": "run_readonly_query", "arguments": {}}}`,
+		`{"jsonrpc": "2.0", "id": "nine", "method": "resources/read", "params": {"uri": "text2sql://schema"}}`,
+		`{"jsonrpc": "2.0", "id": 10, "method": "prompts/list"}`,
+		`not json`,
+		`{"jsonrpc": "2.0", "id": 12, "method": "tools/call", "params": {"name": "run_readonly_query", "arguments": {"sql": "PRAGMA query_only = OFF"}}}`,
+		`{"jsonrpc": "2.0", "id": 13, "method": "tools/call", "params": {"name": "run_readonly_query", "arguments": {"sql": "DELETE FROM Orders RETURNING id"}}}`,
+		`{"jsonrpc": "2.0", "id": 14, "method": "tools/call", "params": {"name": "run_readonly_query", "arguments": {"sql": "SELECT COUNT(*) AS n FROM Orders"}}}`,
+	}
+	var out bytes.Buffer
+	assert.NoError(t, server.Serve(strings.NewReader(strings.Join(requests, "\n")), &out))
+
+	var responses []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var response map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &response), line)
+		responses = append(responses, response)
+	}
+	// the notification gets no response
+	assert.Len(t, responses, len(requests)-1)
+	result := func(i int) map[string]any {
+		result, _ := responses[i]["result"].(map[string]any)
+		return result
+	}
+	toolText := func(i int) string {
+		content := result(i)["content"].([]any)
+		return content[0].(map[string]any)["text"].(string)
+	}
+
+	assert.Equal(t, McpProtocolVersion, result(0)["protocolVersion"])
+	var toolNames []string
+	for _, tool := range result(1)["tools"].([]any) {
+		toolNames = append(toolNames, tool.(map[string]any)["name"].(string))
+	}
+	assert.Equal(t, []string{"list_tables", "describe_table", "generate_sql", "run_readonly_query"}, toolNames)
+	assert.Equal(t, "Customers\nOrders", toolText(2))
+	assert.Equal(t, `table Orders, 3 rows
+Columns:
+- id: INTEGER, primary key
+- customer_id: INTEGER, references Customers(id)
+- shipping_status: TEXT
+
+CREATE TABLE Orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES Customers(id), shipping_status TEXT);
+`, toolText(3))
+	assert.Equal(t, "SELECT COUNT(*) FROM Orders", toolText(4))
+	assert.Equal(t, "| id |\n| --- |\n| 1 |\n(only the first 1 rows)", toolText(5))
+	// failing SQL is the tool's error, missing arguments the protocol's
+	assert.Equal(t, true, result(6)["isError"])
+	assert.Contains(t, toolText(6), "not authorized")
+	assert.Equal(t, float64(JsonRpcInvalidParams), responses[7]["error"].(map[string]any)["code"])
+	assert.Equal(t, "nine", responses[8]["id"])
+	assert.Equal(t, "CREATE TABLE Orders (id INTEGER PRIMARY KEY);", result(8)["contents"].([]any)[0].(map[string]any)["text"])
+	assert.Equal(t, float64(JsonRpcMethodNotFound), responses[9]["error"].(map[string]any)["code"])
+	assert.Equal(t, float64(JsonRpcParseError), responses[10]["error"].(map[string]any)["code"])
+	assert.Nil(t, responses[10]["id"])
+	// and there's no turning read only off
+	assert.Equal(t, true, result(11)["isError"])
+	assert.Equal(t, true, result(12)["isError"])
+	assert.Equal(t, "| n |\n| --- |\n| 3 |\n(1 rows)", toolText(13))
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// A table found in a Markdown document. Cells are kept verbatim apart from escaped pipes
+// (\|) being unescaped, so inline code like `SELECT a || b` survives intact.
+type MarkdownTable struct {
+	Heading string // text of the closest heading before the table, "" if there isn't one
+	Columns []string
+	Rows    []MarkdownTableRow
+}
+
+// A row of cells, padded or truncated to the number of columns in the table header
+type MarkdownTableRow []string
+
+// Value of the cell in the named column (case insensitive), "" if there's no such column
+func (table MarkdownTable) Value(row MarkdownTableRow, column string) string {
+	index := table.ColumnIndex(column)
+	if index < 0 {
+		return ""
+	}
+	return row[index]
+}
+
+func (table MarkdownTable) ColumnIndex(column string) int {
+	for i, name := range table.Columns {
+		if strings.EqualFold(name, column) {
+			return i
+		}
+	}
+	return -1
+}
+
+var (
+	atxHeading       = regexp.MustCompile(`^ {0,3}#{1,6}(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	setextUnderline  = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	codeFence        = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	delimiterCell    = regexp.MustCompile(`^:?-+:?$`)
+	singleCodeSpanRe = regexp.MustCompile("^(`+)\\s?(.*?)\\s?(`+)$")
+)
+
+func parseMarkdownTablesFile(fileName string) ([]MarkdownTable, error) {
+	input, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return parseMarkdownTables(input)
+}
+
+// Find every GitHub flavoured Markdown table in a document, in document order.
+// Tables inside fenced code blocks are ignored.
+func parseMarkdownTables(input []byte) ([]MarkdownTable, error) {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(input))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var tables []MarkdownTable
+	heading := ""
+	fence := ""
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		// skip over fenced code blocks entirely
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+			}
+			continue
+		}
+		if match := codeFence.FindStringSubmatch(line); match != nil {
+			fence = match[1]
+			continue
+		}
+
+		if match := atxHeading.FindStringSubmatch(line); match != nil {
+			heading = strings.TrimSpace(match[1])
+			continue
+		}
+		if i+1 < len(lines) && strings.TrimSpace(line) != "" && !strings.Contains(line, "|") && setextUnderline.MatchString(lines[i+1]) {
+			heading = strings.TrimSpace(line)
+			i++
+			continue
+		}
+
+		// a table is a header row immediately followed by a delimiter row with as many cells
+		if i+1 >= len(lines) || !strings.Contains(line, "|") {
+			continue
+		}
+		columns := splitMarkdownTableRow(line)
+		if !isMarkdownDelimiterRow(lines[i+1], len(columns)) {
+			continue
+		}
+
+		table := MarkdownTable{Heading: heading, Columns: columns}
+		i += 2
+		for ; i < len(lines) && strings.TrimSpace(lines[i]) != "" && strings.Contains(lines[i], "|"); i++ {
+			cells := splitMarkdownTableRow(lines[i])
+			row := make(MarkdownTableRow, len(columns))
+			copy(row, cells)
+			table.Rows = append(table.Rows, row)
+		}
+		i-- // the loop increment moves us on to the line that ended the table
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+func isMarkdownDelimiterRow(line string, columnCount int) bool {
+	if !strings.Contains(line, "-") {
+		return false
+	}
+	cells := splitMarkdownTableRow(line)
+	if len(cells) != columnCount {
+		return false
+	}
+	for _, cell := range cells {
+		if !delimiterCell.MatchString(cell) {
+			return false
+		}
+	}
+	return true
+}
+
+// Split a table row into trimmed cells. Pipes separate cells unless they are escaped (\|)
+// or inside a code span; code spans are otherwise kept exactly as written.
+func splitMarkdownTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	var cells []string
+	var cell strings.Builder
+	openingBackticks := 0 // length of the backtick run that opened the current code span
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case c == '`':
+			run := 1
+			for i+run < len(line) && line[i+run] == '`' {
+				run++
+			}
+			if openingBackticks == 0 && strings.Contains(line[i+run:], strings.Repeat("`", run)) {
+				openingBackticks = run
+			} else if run == openingBackticks {
+				openingBackticks = 0
+			}
+			cell.WriteString(line[i : i+run])
+			i += run - 1
+		case c == '|' && openingBackticks == 0:
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(c)
+		}
+	}
+	cells = append(cells, strings.TrimSpace(cell.String()))
+
+	// leading and trailing pipes are optional and don't introduce empty cells
+	if strings.HasPrefix(line, "|") {
+		cells = cells[1:]
+	}
+	if len(cells) > 0 && strings.HasSuffix(line, "|") && !strings.HasSuffix(line, "\\|") && openingBackticks == 0 {
+		cells = cells[:len(cells)-1]
+	}
+	return cells
+}
+
+// If a cell consists of a single code span return what's inside it, otherwise the cell as-is
+func unwrapCodeSpan(cell string) string {
+	match := singleCodeSpanRe.FindStringSubmatch(cell)
+	if match == nil || match[1] != match[3] || strings.Contains(match[2], match[1]) {
+		return cell
+	}
+	return match[2]
+}
+
+// Only called when a CSV copy of a table is explicitly asked for
+func writeMarkdownTableCsv(table MarkdownTable, fileName string) error {
+	outputFile, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+
+	csvWriter := csv.NewWriter(outputFile)
+	if err := csvWriter.Write(table.Columns); err != nil {
+		return err
+	}
+	for _, row := range table.Rows {
+		if err := csvWriter.Write(row); err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const multiTableMarkdown = "# Ground truth\n" +
+	"\n" +
+	"| not | a table |\n" +
+	"\n" +
+	"## Counting\n" +
+	"\n" +
+	"| Query | SQL | Result |\n" +
+	"| :--- | --- | ---: |\n" +
+	"| How many customers are there? | `SELECT COUNT(*) FROM \"Customers\";` | [{\"COUNT(*)\":10}] |\n" +
+	"| Names joined | `SELECT first \\|\\| ' ' \\|\\| last FROM People;` |\n" +
+	"\n" +
+	"```\n" +
+	"| Query | SQL |\n" +
+	"| --- | --- |\n" +
+	"| inside a code block | SELECT 1 |\n" +
+	"```\n" +
+	"\n" +
+	"Joins\n" +
+	"-----\n" +
+	"Query | SQL\n" +
+	"--- | ---\n" +
+	"Concatenated names? | `SELECT first || ' ' || last FROM People;`\n" +
+	"Escaped pipe | SELECT 'a\\|b'\n" +
+	"Code in a sentence | use `name` not *name* | ignored extra cell\n"
+
+func TestParseMarkdownTables(t *testing.T) {
+	tables, err := parseMarkdownTables([]byte(multiTableMarkdown))
+	assert.NoError(t, err)
+	assert.Len(t, tables, 2)
+
+	counting := tables[0]
+	assert.Equal(t, "Counting", counting.Heading)
+	assert.Equal(t, []string{"Query", "SQL", "Result"}, counting.Columns)
+	assert.Len(t, counting.Rows, 2)
+	assert.Equal(t, "`SELECT COUNT(*) FROM \"Customers\";`", counting.Value(counting.Rows[0], "sql"))
+	assert.Equal(t, `[{"COUNT(*)":10}]`, counting.Value(counting.Rows[0], "Result"))
+	assert.Equal(t, "`SELECT first || ' ' || last FROM People;`", counting.Value(counting.Rows[1], "SQL"))
+	assert.Equal(t, "", counting.Value(counting.Rows[1], "Result")) // short rows are padded
+
+	joins := tables[1]
+	assert.Equal(t, "Joins", joins.Heading)
+	assert.Len(t, joins.Rows, 3)
+	assert.Equal(t, "`SELECT first || ' ' || last FROM People;`", joins.Value(joins.Rows[0], "SQL"))
+	assert.Equal(t, "SELECT 'a|b'", joins.Value(joins.Rows[1], "SQL"))
+	assert.Equal(t, MarkdownTableRow{"Code in a sentence", "use `name` not *name*"}, joins.Rows[2])
+}
+
+func TestUnwrapCodeSpan(t *testing.T) {
+	assert.Equal(t, "SELECT a || b", unwrapCodeSpan("`SELECT a || b`"))
+	assert.Equal(t, "SELECT `a`", unwrapCodeSpan("`` SELECT `a` ``"))
+	assert.Equal(t, "use `name` not `id`", unwrapCodeSpan("use `name` not `id`"))
+	assert.Equal(t, "SELECT 1", unwrapCodeSpan("SELECT 1"))
+}
+
+func TestLoadGroundTruthMdFromEveryTable(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "ground-truth.md")
+	assert.NoError(t, os.WriteFile(filename, []byte(multiTableMarkdown), 0644))
+
+	groundTruth, err := loadGroundTruth(filename)
+	assert.NoError(t, err)
+	assert.Len(t, groundTruth, 5)
+	assert.Equal(t, `SELECT COUNT(*) FROM "Customers";`, groundTruth[0].SQL)
+	assert.Equal(t, []string{"counting"}, groundTruth[0].Tags)
+	assert.Equal(t, "SELECT first || ' ' || last FROM People;", groundTruth[2].SQL)
+	assert.Equal(t, []string{"joins"}, groundTruth[2].Tags)
+
+	// loading must not leave a CSV file behind
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestWriteMarkdownTableCsv(t *testing.T) {
+	tables, err := parseMarkdownTables([]byte(multiTableMarkdown))
+	assert.NoError(t, err)
+	filename := filepath.Join(t.TempDir(), "table.csv")
+	assert.NoError(t, writeMarkdownTableCsv(tables[1], filename))
+
+	file, err := os.Open(filename)
+	assert.NoError(t, err)
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Query", "SQL"}, records[0])
+	assert.Equal(t, "SELECT 'a|b'", records[2][1])
+}
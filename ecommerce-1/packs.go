@@ -0,0 +1,225 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const DefaultPacksDir = "packs"
+const DefaultPack = "ecommerce"
+const PackMetadataFile = "pack.yaml"
+
+// A dataset pack is a directory holding everything needed to evaluate text to SQL against one
+// schema: the schema itself, seed data, the database built from them and the ground truth.
+// It's described by a pack.yaml in the directory; file names in it are relative to the directory.
+type DatasetPack struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Database    string `yaml:"database"`       // SQLite database, created from Schema and Seed if missing, or only read if there's no Seed
+	Schema      string `yaml:"schema"`         // SQL that creates the tables, also shown to the model
+	Seed        string `yaml:"seed,omitempty"` // SQL that inserts the sample data, or a .yaml seed spec to generate it from (optional)
+	GroundTruth string `yaml:"ground_truth"`
+	// SQL files applied in order to databases created before them; new ones are only ever appended
+	Migrations []string `yaml:"migrations,omitempty"`
+	// How predictions are scored: empty to match against every acceptable answer in the ground
+	// truth, or one of the official execution accuracy metrics for imported benchmarks
+	Metric string `yaml:"metric,omitempty"`
+	// business terms and the SQL they mean, given to the model when a question uses them (optional)
+	Glossary string `yaml:"glossary,omitempty"`
+
+	Dir string `yaml:"-"`
+}
+
+// Resolve a file named in pack.yaml relative to the pack directory
+func (pack *DatasetPack) Path(file string) string {
+	if file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(pack.Dir, file)
+}
+
+func (pack *DatasetPack) SchemaSql() (string, error) {
+	schema, err := os.ReadFile(pack.Path(pack.Schema))
+	if err != nil {
+		return "", fmt.Errorf("pack %s: %v", pack.Name, err)
+	}
+	return string(schema), nil
+}
+
+// The schema as it's shown to the model
+func (pack *DatasetPack) PromptSchema() (string, error) {
+	schema, err := pack.SchemaSql()
+	if err != nil {
+		return "", err
+	}
+	return schemaForPrompt(schema), nil
+}
+
+// The pack's glossary, or nil if it doesn't have one
+func (pack *DatasetPack) LoadGlossary() (*Glossary, error) {
+	if pack.Glossary == "" {
+		return nil, nil
+	}
+	glossary, err := loadGlossary(pack.Path(pack.Glossary))
+	if err != nil {
+		return nil, fmt.Errorf("pack %s: %v", pack.Name, err)
+	}
+	return glossary, nil
+}
+
+func (pack *DatasetPack) LoadGroundTruth() ([]GroundTruthItem, error) {
+	return loadGroundTruth(pack.Path(pack.GroundTruth))
+}
+
+// Whether the pack's database was built by something else, as imported benchmarks' are: with no
+// seed or migrations of its own there's nothing to build or bring up to date, so it's only read
+func (pack *DatasetPack) ExternalDb() bool {
+	return pack.Seed == "" && len(pack.Migrations) == 0
+}
+
+func (pack *DatasetPack) OpenDb() (*sql.DB, error) {
+	if pack.ExternalDb() {
+		db, err := openReadOnlyDb(pack.Path(pack.Database))
+		if err != nil {
+			return nil, fmt.Errorf("pack %s: %v", pack.Name, err)
+		}
+		return db, nil
+	}
+	schema, err := pack.SchemaSql()
+	if err != nil {
+		return nil, err
+	}
+	seed, err := pack.SeedSql()
+	if err != nil {
+		return nil, err
+	}
+	definition := DbDefinition{
+		Schema: SqlScript{Name: pack.Path(pack.Schema), Sql: schema},
+		Seed:   SqlScript{Name: pack.Path(pack.Seed), Sql: seed},
+	}
+	for _, migration := range pack.Migrations {
+		content, err := os.ReadFile(pack.Path(migration))
+		if err != nil {
+			return nil, fmt.Errorf("pack %s: %v", pack.Name, err)
+		}
+		definition.Migrations = append(definition.Migrations, SqlScript{Name: pack.Path(migration), Sql: string(content)})
+	}
+	db, err := initialiseDb(pack.Path(pack.Database), definition)
+	if err != nil {
+		return nil, fmt.Errorf("pack %s: %v", pack.Name, err)
+	}
+	return db, nil
+}
+
+// The SQL that inserts the pack's sample data, generated if the seed is a seed spec
+func (pack *DatasetPack) SeedSql() (string, error) {
+	switch strings.ToLower(filepath.Ext(pack.Seed)) {
+	case "":
+		return "", nil
+	case ".yaml", ".yml":
+		spec, err := loadSeedSpec(pack.Path(pack.Seed))
+		if err != nil {
+			return "", fmt.Errorf("pack %s: %v", pack.Name, err)
+		}
+		seed, err := generateSeedSql(spec)
+		if err != nil {
+			return "", fmt.Errorf("pack %s: %v", pack.Name, err)
+		}
+		return seed, nil
+	default:
+		content, err := os.ReadFile(pack.Path(pack.Seed))
+		if err != nil {
+			return "", fmt.Errorf("pack %s: %v", pack.Name, err)
+		}
+		return string(content), nil
+	}
+}
+
+func loadDatasetPack(dir string) (*DatasetPack, error) {
+	content, err := os.ReadFile(filepath.Join(dir, PackMetadataFile))
+	if err != nil {
+		return nil, err
+	}
+	var pack DatasetPack
+	if err := yaml.Unmarshal(content, &pack); err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Join(dir, PackMetadataFile), err)
+	}
+	pack.Dir = dir
+	if pack.Name == "" {
+		pack.Name = filepath.Base(dir)
+	}
+	if pack.Database == "" || pack.Schema == "" || pack.GroundTruth == "" {
+		return nil, fmt.Errorf("pack %s: database, schema and ground_truth are all required", pack.Name)
+	}
+	if !validMetric(pack.Metric) {
+		return nil, fmt.Errorf("pack %s: unknown metric '%s'", pack.Name, pack.Metric)
+	}
+	return &pack, nil
+}
+
+// Every subdirectory of packsDir with a pack.yaml in it, sorted by name
+func discoverDatasetPacks(packsDir string) ([]*DatasetPack, error) {
+	entries, err := os.ReadDir(packsDir)
+	if err != nil {
+		return nil, err
+	}
+	var packs []*DatasetPack
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(packsDir, entry.Name())
+		if _, err := os.Stat(filepath.Join(dir, PackMetadataFile)); err != nil {
+			continue
+		}
+		pack, err := loadDatasetPack(dir)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, pack)
+	}
+	sort.Slice(packs, func(i, j int) bool { return packs[i].Name < packs[j].Name })
+	return packs, nil
+}
+
+// Pick packs by a comma separated list of names, or "all" of them
+func selectDatasetPacks(packs []*DatasetPack, names string) ([]*DatasetPack, error) {
+	if names == "all" {
+		return packs, nil
+	}
+	var selected []*DatasetPack
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, pack := range packs {
+			if pack.Name == name {
+				selected = append(selected, pack)
+				found = true
+				break
+			}
+		}
+		if !found {
+			var available []string
+			for _, pack := range packs {
+				available = append(available, pack.Name)
+			}
+			return nil, fmt.Errorf("unknown pack '%s', available packs: %s", name, strings.Join(available, ", "))
+		}
+	}
+	return selected, nil
+}
+
+// Find and select packs in one go, which is what every command wants
+func findDatasetPacks(packsDir string, names string) ([]*DatasetPack, error) {
+	packs, err := discoverDatasetPacks(packsDir)
+	if err != nil {
+		return nil, err
+	}
+	return selectDatasetPacks(packs, names)
+}
@@ -10,7 +10,7 @@ CREATE TABLE IF NOT EXISTS "Orders" (
 	"customer_id"	INTEGER,
 	"shipping_status"	TEXT NOT NULL CHECK("shipping_status" IN ('pending', 'shipped', 'delivered')),
 	PRIMARY KEY("id" AUTOINCREMENT),
-	FOREIGN KEY("customer_id") REFERENCES "Customers"("id"),
+	FOREIGN KEY("customer_id") REFERENCES "Customers"("id")
 );
 CREATE TABLE IF NOT EXISTS "Products" (
 	"id"	INTEGER,
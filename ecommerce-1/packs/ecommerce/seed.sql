@@ -0,0 +1,48 @@
+-- Sample data: customer n places one order containing products 1..n, n of each,
+-- except customer 10 who hasn't ordered anything. Only customer 2's order has been shipped.
+
+INSERT INTO Customers (name, email) VALUES
+    ('Customer 1', 'customer1@example.com'),
+    ('Customer 2', 'customer2@example.com'),
+    ('Customer 3', 'customer3@example.com'),
+    ('Customer 4', 'customer4@example.com'),
+    ('Customer 5', 'customer5@example.com'),
+    ('Customer 6', 'customer6@example.com'),
+    ('Customer 7', 'customer7@example.com'),
+    ('Customer 8', 'customer8@example.com'),
+    ('Customer 9', 'customer9@example.com'),
+    ('Customer 10', 'customer10@example.com');
+
+INSERT INTO Products (name, price) VALUES
+    ('Product 1', 100.00),
+    ('Product 2', 200.00),
+    ('Product 3', 300.00),
+    ('Product 4', 400.00),
+    ('Product 5', 500.00),
+    ('Product 6', 600.00),
+    ('Product 7', 700.00),
+    ('Product 8', 800.00),
+    ('Product 9', 900.00),
+    ('Product 10', 10000.00);
+
+INSERT INTO Orders (customer_id, shipping_status) VALUES
+    (1, 'pending'),
+    (2, 'shipped'),
+    (3, 'delivered'),
+    (4, 'delivered'),
+    (5, 'delivered'),
+    (6, 'delivered'),
+    (7, 'delivered'),
+    (8, 'delivered'),
+    (9, 'delivered');
+
+INSERT INTO Order_Products (order_id, product_id, quantity) VALUES
+    (1, 1, 1),
+    (2, 1, 1), (2, 2, 2),
+    (3, 1, 1), (3, 2, 2), (3, 3, 3),
+    (4, 1, 1), (4, 2, 2), (4, 3, 3), (4, 4, 4),
+    (5, 1, 1), (5, 2, 2), (5, 3, 3), (5, 4, 4), (5, 5, 5),
+    (6, 1, 1), (6, 2, 2), (6, 3, 3), (6, 4, 4), (6, 5, 5), (6, 6, 6),
+    (7, 1, 1), (7, 2, 2), (7, 3, 3), (7, 4, 4), (7, 5, 5), (7, 6, 6), (7, 7, 7),
+    (8, 1, 1), (8, 2, 2), (8, 3, 3), (8, 4, 4), (8, 5, 5), (8, 6, 6), (8, 7, 7), (8, 8, 8),
+    (9, 1, 1), (9, 2, 2), (9, 3, 3), (9, 4, 4), (9, 5, 5), (9, 6, 6), (9, 7, 7), (9, 8, 8), (9, 9, 9);
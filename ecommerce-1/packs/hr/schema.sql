@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS Departments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT UNIQUE NOT NULL,
+    location TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS Employees (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    email TEXT UNIQUE NOT NULL,
+    department_id INTEGER REFERENCES Departments(id),
+    manager_id INTEGER REFERENCES Employees(id),
+    job_title TEXT NOT NULL,
+    salary REAL NOT NULL,
+    hire_date TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_employees_department ON Employees(department_id);
+
+CREATE TABLE IF NOT EXISTS Projects (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    department_id INTEGER REFERENCES Departments(id),
+    status TEXT CHECK (status IN ('planned', 'active', 'completed')) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS Employee_Projects (
+    employee_id INTEGER REFERENCES Employees(id),
+    project_id INTEGER REFERENCES Projects(id),
+    hours_per_week INTEGER NOT NULL,
+    PRIMARY KEY(employee_id, project_id)
+);
@@ -0,0 +1,43 @@
+-- Legal has no employees and Eve Black isn't on any project, to give negation questions an answer.
+
+INSERT INTO Departments (name, location) VALUES
+    ('Engineering', 'London'),
+    ('Sales', 'New York'),
+    ('Marketing', 'London'),
+    ('Finance', 'Berlin'),
+    ('Legal', 'Berlin');
+
+INSERT INTO Employees (name, email, department_id, manager_id, job_title, salary, hire_date) VALUES
+    ('Alice Smith', 'alice.smith@example.com', 1, NULL, 'Head of Engineering', 150000, '2015-03-01'),
+    ('Bob Jones', 'bob.jones@example.com', 1, 1, 'Senior Engineer', 110000, '2017-06-15'),
+    ('Carol White', 'carol.white@example.com', 1, 1, 'Engineer', 90000, '2020-01-10'),
+    ('Dan Brown', 'dan.brown@example.com', 1, 2, 'Engineer', 85000, '2021-09-01'),
+    ('Eve Black', 'eve.black@example.com', 2, NULL, 'Head of Sales', 130000, '2016-02-20'),
+    ('Frank Green', 'frank.green@example.com', 2, 5, 'Account Executive', 70000, '2019-04-01'),
+    ('Grace Hall', 'grace.hall@example.com', 2, 5, 'Account Executive', 72000, '2022-11-15'),
+    ('Heidi King', 'heidi.king@example.com', 3, NULL, 'Head of Marketing', 120000, '2018-07-01'),
+    ('Ivan Lee', 'ivan.lee@example.com', 3, 8, 'Marketing Analyst', 65000, '2023-01-09'),
+    ('Judy Moss', 'judy.moss@example.com', 4, NULL, 'Head of Finance', 140000, '2014-05-12'),
+    ('Ken Nash', 'ken.nash@example.com', 4, 10, 'Accountant', 75000, '2020-08-03'),
+    ('Liam Ortiz', 'liam.ortiz@example.com', 1, 2, 'Engineer', 88000, '2023-03-20');
+
+INSERT INTO Projects (name, department_id, status) VALUES
+    ('Data Platform', 1, 'active'),
+    ('Mobile App', 1, 'planned'),
+    ('CRM Migration', 2, 'active'),
+    ('Brand Refresh', 3, 'completed'),
+    ('Budget 2025', 4, 'completed');
+
+INSERT INTO Employee_Projects (employee_id, project_id, hours_per_week) VALUES
+    (1, 1, 5),
+    (2, 1, 20),
+    (3, 1, 30),
+    (12, 1, 40),
+    (4, 2, 10),
+    (2, 3, 5),
+    (6, 3, 15),
+    (7, 3, 25),
+    (8, 4, 10),
+    (9, 4, 35),
+    (10, 5, 5),
+    (11, 5, 20);
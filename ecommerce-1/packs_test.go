@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverDatasetPacks(t *testing.T) {
+	packs, err := discoverDatasetPacks(DefaultPacksDir)
+	assert.NoError(t, err)
+	var names []string
+	for _, pack := range packs {
+		names = append(names, pack.Name)
+	}
+	assert.Contains(t, names, "ecommerce")
+	assert.Contains(t, names, "hr")
+
+	selected, err := selectDatasetPacks(packs, "hr, ecommerce")
+	assert.NoError(t, err)
+	assert.Equal(t, "hr", selected[0].Name)
+	assert.Equal(t, "ecommerce", selected[1].Name)
+
+	selected, err = selectDatasetPacks(packs, "all")
+	assert.NoError(t, err)
+	assert.Len(t, selected, len(packs))
+
+	_, err = selectDatasetPacks(packs, "payroll")
+	assert.Error(t, err)
+}
+
+func TestLoadDatasetPack(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "inventory")
+	assert.NoError(t, os.Mkdir(dir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, PackMetadataFile), []byte("database: inventory.db\nschema: schema.sql\nground_truth: /abs/ground-truth.yaml\n"), 0644))
+
+	pack, err := loadDatasetPack(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "inventory", pack.Name) // defaults to the directory name
+	assert.Equal(t, filepath.Join(dir, "inventory.db"), pack.Path(pack.Database))
+	assert.Equal(t, "/abs/ground-truth.yaml", pack.Path(pack.GroundTruth))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, PackMetadataFile), []byte("name: inventory\n"), 0644))
+	_, err = loadDatasetPack(dir)
+	assert.Error(t, err)
+}
+
+// The shipped packs' gold SQL has to run and their stored results have to be current,
+// otherwise every model gets marked down for the ground truth's mistakes.
+func TestDatasetPacksGroundTruthIsCurrent(t *testing.T) {
+	packs, err := discoverDatasetPacks(DefaultPacksDir)
+	assert.NoError(t, err)
+	for _, pack := range packs {
+		groundTruth, err := pack.LoadGroundTruth()
+		assert.NoError(t, err)
+		db, err := pack.OpenDb()
+		assert.NoError(t, err)
+		for _, check := range checkGroundTruthResults(db, groundTruth) {
+			assert.NoError(t, check.Err, "%s: %s", pack.Name, check.ID)
+			assert.False(t, check.Changed(), "%s: %s result is stale", pack.Name, check.ID)
+		}
+		db.Close()
+	}
+}
+
+// Databases a pack doesn't build, like imported benchmarks', are opened as they are and never written
+func TestOpenExternalDb(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "concert_singer.sqlite")
+	db, err := sql.Open("sqlite3", dbFile)
+	assert.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE singer (id INTEGER PRIMARY KEY, name TEXT); INSERT INTO singer (name) VALUES ('Joe');`)
+	assert.NoError(t, err)
+	db.Close()
+	before, err := os.ReadFile(dbFile)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chmod(dbFile, 0444))
+	// and the schema shown to the model needn't match it exactly
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "schema.sql"), []byte(`CREATE TABLE "singer" ("id" NUMERIC, "name" TEXT, PRIMARY KEY("id"));`), 0644))
+
+	pack := &DatasetPack{Name: "spider-concert-singer", Database: "concert_singer.sqlite", Schema: "schema.sql", Dir: dir}
+	assert.True(t, pack.ExternalDb())
+	db, err = pack.OpenDb()
+	assert.NoError(t, err)
+	version, err := dbVersion(db)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+	var name string
+	assert.NoError(t, db.QueryRow(`SELECT name FROM singer`).Scan(&name))
+	assert.Equal(t, "Joe", name)
+	_, err = db.Exec(`DELETE FROM singer`)
+	assert.Error(t, err)
+	db.Close()
+	after, err := os.ReadFile(dbFile)
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	pack.Database = "missing.sqlite"
+	_, err = pack.OpenDb()
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(dir, "missing.sqlite"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOpenAskDbFile(t *testing.T) {
+	dir := t.TempDir()
+	created := filepath.Join(dir, "created.sqlite")
+	db, err := sql.Open("sqlite3", created)
+	assert.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE singer (id INTEGER PRIMARY KEY, name TEXT)`)
+	assert.NoError(t, err)
+	db.Close()
+	// a name that would end the URI early unless it's escaped
+	dbFile := filepath.Join(dir, "what?#50%.sqlite")
+	assert.NoError(t, os.Rename(created, dbFile))
+
+	db, schema, err := openAskDb(dbFile, "", "")
+	assert.NoError(t, err)
+	assert.Contains(t, schema, "singer")
+	_, err = db.Exec(`INSERT INTO singer (name) VALUES ('Joe')`)
+	assert.Error(t, err)
+	db.Close()
+
+	_, _, err = openAskDb(filepath.Join(dir, "missing.sqlite"), "", "")
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(dir, "missing.sqlite"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = dumpSqliteSchema(filepath.Join(dir, "missing.sqlite"))
+	assert.Error(t, err)
+}
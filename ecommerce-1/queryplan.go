@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// How much each kind of EXPLAIN QUERY PLAN step adds to a plan's cost. The numbers only mean
+// anything relative to each other: reading every row of a table is the thing to avoid, doing it
+// again for every row of another table (a correlated subquery) is worse, and looking rows up by
+// an index is what we'd hope for.
+const (
+	PlanCostFullScan           = 10 // SCAN t
+	PlanCostIndexScan          = 5  // SCAN t USING INDEX i: every row, but in index order or without touching the table
+	PlanCostAutomaticIndex     = 5  // SQLite built a temporary index the schema doesn't have
+	PlanCostIndexSearch        = 1  // SEARCH t USING INDEX i
+	PlanCostTempBTree          = 3  // sorting, grouping or DISTINCT that no index could do
+	PlanCostSubquery           = 2  // run once
+	PlanCostCorrelatedSubquery = 20 // run for every row of the outer query
+)
+
+type QueryPlanStep struct {
+	ID     int    `json:"id"`
+	Parent int    `json:"parent"`
+	Detail string `json:"detail"`
+}
+
+// The EXPLAIN QUERY PLAN of a query and a rough cost from counting what it does
+type QueryPlan struct {
+	Steps                []QueryPlanStep `json:"steps"`
+	FullScans            int             `json:"full_scans"`
+	IndexScans           int             `json:"index_scans"`
+	IndexSearches        int             `json:"index_searches"`
+	AutomaticIndexes     int             `json:"automatic_indexes"`
+	TempBTrees           int             `json:"temp_btrees"`
+	Subqueries           int             `json:"subqueries"`
+	CorrelatedSubqueries int             `json:"correlated_subqueries"`
+	Cost                 int             `json:"cost"`
+}
+
+// Ask SQLite how it would run a query, without running it
+func explainQueryPlan(db *sql.DB, sqlQuery string, limits QueryLimits) (*QueryPlan, error) {
+	ctx, cancel := queryContext(context.Background(), limits)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "EXPLAIN QUERY PLAN "+sqlQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var steps []QueryPlanStep
+	for rows.Next() {
+		var step QueryPlanStep
+		var notUsed int
+		if err := rows.Scan(&step.ID, &step.Parent, &notUsed, &step.Detail); err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return analyseQueryPlan(steps), nil
+}
+
+// Count the steps of a plan by kind. The details are meant for people rather than programs
+// so this goes by how SQLite words them, e.g. "SEARCH c USING INTEGER PRIMARY KEY (rowid=?)".
+func analyseQueryPlan(steps []QueryPlanStep) *QueryPlan {
+	plan := &QueryPlan{Steps: steps}
+	for _, step := range steps {
+		detail := step.Detail
+		switch {
+		case strings.HasPrefix(detail, "SCAN CONSTANT ROW"):
+			// SELECT without a FROM
+		case strings.Contains(detail, "AUTOMATIC") && strings.Contains(detail, "INDEX"):
+			plan.AutomaticIndexes++
+		case strings.HasPrefix(detail, "SCAN ") && strings.Contains(detail, " USING "):
+			plan.IndexScans++
+		case strings.HasPrefix(detail, "SCAN "):
+			plan.FullScans++
+		case strings.HasPrefix(detail, "SEARCH "):
+			plan.IndexSearches++
+		case strings.HasPrefix(detail, "USE TEMP B-TREE"):
+			plan.TempBTrees++
+		case strings.HasPrefix(detail, "CORRELATED ") && strings.Contains(detail, "SUBQUERY"):
+			plan.CorrelatedSubqueries++
+		case strings.Contains(detail, "SUBQUERY"):
+			plan.Subqueries++
+		}
+	}
+	plan.Cost = plan.FullScans*PlanCostFullScan +
+		plan.IndexScans*PlanCostIndexScan +
+		plan.AutomaticIndexes*PlanCostAutomaticIndex +
+		plan.IndexSearches*PlanCostIndexSearch +
+		plan.TempBTrees*PlanCostTempBTree +
+		plan.Subqueries*PlanCostSubquery +
+		plan.CorrelatedSubqueries*PlanCostCorrelatedSubquery
+	return plan
+}
+
+// e.g. "cost 23: 2 full scans, 1 temp b-tree"
+func (plan *QueryPlan) Summary() string {
+	var counts []string
+	for _, count := range []struct {
+		n              int
+		single, plural string
+	}{
+		{plan.FullScans, "full scan", "full scans"},
+		{plan.IndexScans, "index scan", "index scans"},
+		{plan.IndexSearches, "index search", "index searches"},
+		{plan.AutomaticIndexes, "automatic index", "automatic indexes"},
+		{plan.TempBTrees, "temp b-tree", "temp b-trees"},
+		{plan.Subqueries, "subquery", "subqueries"},
+		{plan.CorrelatedSubqueries, "correlated subquery", "correlated subqueries"},
+	} {
+		if count.n == 1 {
+			counts = append(counts, "1 "+count.single)
+		} else if count.n > 1 {
+			counts = append(counts, fmt.Sprintf("%d %s", count.n, count.plural))
+		}
+	}
+	if len(counts) == 0 {
+		return fmt.Sprintf("cost %d", plan.Cost)
+	}
+	return fmt.Sprintf("cost %d: %s", plan.Cost, strings.Join(counts, ", "))
+}
+
+// The plan as an indented tree, like the sqlite3 shell shows it
+func (plan *QueryPlan) String() string {
+	depths := map[int]int{0: 0}
+	var tree strings.Builder
+	for _, step := range plan.Steps {
+		depth := depths[step.Parent] + 1
+		depths[step.ID] = depth
+		fmt.Fprintf(&tree, "%s%s\n", strings.Repeat("  ", depth-1), step.Detail)
+	}
+	return tree.String()
+}
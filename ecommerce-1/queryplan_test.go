@@ -0,0 +1,63 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainQueryPlan(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE Customers (id INTEGER PRIMARY KEY, name TEXT NOT NULL, email TEXT);
+CREATE INDEX idx_customers_name ON Customers(name);
+CREATE TABLE Orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES Customers(id), total REAL);`)
+	assert.NoError(t, err)
+
+	// using the index on name
+	plan, err := explainQueryPlan(db, `SELECT email FROM Customers WHERE name = 'Customer 1'`, QueryLimits{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, plan.IndexSearches)
+	assert.Equal(t, 0, plan.FullScans)
+	assert.Equal(t, PlanCostIndexSearch, plan.Cost)
+
+	// ignoring it
+	plan, err = explainQueryPlan(db, `SELECT email FROM Customers WHERE lower(name) = 'customer 1' ORDER BY email`, QueryLimits{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, plan.FullScans)
+	assert.Equal(t, 1, plan.TempBTrees)
+	assert.Equal(t, PlanCostFullScan+PlanCostTempBTree, plan.Cost)
+	assert.Equal(t, "cost 13: 1 full scan, 1 temp b-tree", plan.Summary())
+
+	// a correlated subquery costs more than the join it could have been
+	correlated, err := explainQueryPlan(db, `SELECT c.name, (SELECT SUM(o.total) FROM Orders o WHERE o.customer_id = c.id) FROM Customers c`, QueryLimits{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, correlated.CorrelatedSubqueries)
+	join, err := explainQueryPlan(db, `SELECT c.name, SUM(o.total) FROM Customers c LEFT JOIN Orders o ON o.customer_id = c.id GROUP BY c.id`, QueryLimits{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, join.CorrelatedSubqueries)
+	assert.Greater(t, correlated.Cost, join.Cost)
+	assert.Contains(t, correlated.String(), "CORRELATED SCALAR SUBQUERY 1\n  SCAN o")
+
+	_, err = explainQueryPlan(db, `SELECT nope FROM Customers`, QueryLimits{})
+	assert.Error(t, err)
+}
+
+func TestAnalyseQueryPlan(t *testing.T) {
+	plan := analyseQueryPlan([]QueryPlanStep{
+		{ID: 2, Detail: "SCAN Customers USING COVERING INDEX idx_customers_name"},
+		{ID: 7, Detail: "LIST SUBQUERY 1"},
+		{ID: 9, Parent: 7, Detail: "SCAN Orders"},
+		{ID: 12, Detail: "SEARCH o USING AUTOMATIC COVERING INDEX (customer_id=?)"},
+		{ID: 15, Detail: "SCAN CONSTANT ROW"},
+	})
+	assert.Equal(t, 1, plan.IndexScans)
+	assert.Equal(t, 1, plan.Subqueries)
+	assert.Equal(t, 1, plan.FullScans)
+	assert.Equal(t, 1, plan.AutomaticIndexes)
+	assert.Equal(t, 0, plan.IndexSearches)
+	assert.Equal(t, PlanCostIndexScan+PlanCostSubquery+PlanCostFullScan+PlanCostAutomaticIndex, plan.Cost)
+}
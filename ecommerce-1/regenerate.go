@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The outcome of running one ground truth item's gold SQL against the dataset database
+type GroundTruthResultCheck struct {
+	ID     string
+	Stored string // the result recorded in the ground truth file
+	Actual string // the result the gold SQL produces today
+	Err    error  // set if the gold SQL (or one of its alternatives) no longer runs
+}
+
+func (check GroundTruthResultCheck) Changed() bool {
+	return check.Err == nil && check.Stored != check.Actual
+}
+
+// Run some gold SQL and serialise the rows exactly as the benchmark does for predicted queries
+func executeGroundTruthSql(db *sql.DB, sqlQuery string) (string, error) {
+	rows, err := db.Query(stripNewlines(sqlQuery))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	return rows2Json(rows)
+}
+
+func checkGroundTruthResults(db *sql.DB, groundTruth []GroundTruthItem) []GroundTruthResultCheck {
+	var checks []GroundTruthResultCheck
+	for _, item := range groundTruth {
+		check := GroundTruthResultCheck{ID: item.ID, Stored: item.Result}
+		check.Actual, check.Err = executeGroundTruthSql(db, item.SQL)
+		if check.Err == nil {
+			// alternatives aren't stored but they are gold SQL too so they have to keep working
+			for i, alternativeSql := range item.AlternativeSQL {
+				if _, err := executeGroundTruthSql(db, alternativeSql); err != nil {
+					check.Err = fmt.Errorf("alternative_sql %d: %v", i+1, err)
+					break
+				}
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// Write regenerated results back to a ground truth file. YAML is patched in place so
+// comments and formatting survive; the imported formats (.md, .csv) are read only.
+func writeGroundTruthResults(filename string, groundTruth []GroundTruthItem) error {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return patchGroundTruthYamlResults(filename, groundTruth)
+	case ".jsonl":
+		return saveGroundTruthJsonl(filename, groundTruth)
+	default:
+		return fmt.Errorf("can't write results to %s: convert it to .yaml or .jsonl first", filename)
+	}
+}
+
+func patchGroundTruthYamlResults(filename string, groundTruth []GroundTruthItem) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	if len(document.Content) != 1 || document.Content[0].Kind != yaml.SequenceNode || len(document.Content[0].Content) != len(groundTruth) {
+		return fmt.Errorf("%s: expected a list of %d ground truth items", filename, len(groundTruth))
+	}
+
+	for i, itemNode := range document.Content[0].Content {
+		resultNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str"}
+		found := false
+		for j := 0; j+1 < len(itemNode.Content); j += 2 {
+			if itemNode.Content[j].Value == "result" {
+				resultNode = itemNode.Content[j+1]
+				found = true
+				break
+			}
+		}
+		if !found {
+			itemNode.Content = append(itemNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "result"}, resultNode)
+		}
+		resultNode.Value = groundTruth[i].Result
+		// results are JSON so single quotes keep them readable
+		resultNode.Style = yaml.SingleQuotedStyle
+	}
+
+	var patched bytes.Buffer
+	encoder := yaml.NewEncoder(&patched)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return err
+	}
+	encoder.Close()
+	return os.WriteFile(filename, patched.Bytes(), 0644)
+}
+
+func saveGroundTruthJsonl(filename string, groundTruth []GroundTruthItem) error {
+	var lines bytes.Buffer
+	for _, item := range groundTruth {
+		line, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		lines.Write(line)
+		lines.WriteString("\n")
+	}
+	return os.WriteFile(filename, lines.Bytes(), 0644)
+}
+
+// dataset regenerate: execute every gold SQL query against each pack's database and either
+// check (-check) or rewrite the stored expected results. Exits non-zero if any gold SQL fails.
+func runRegenerateResults(args []string) int {
+	flags := flag.NewFlagSet("dataset regenerate", flag.ExitOnError)
+	packsDir := flags.String("packs-dir", DefaultPacksDir, "Directory containing dataset packs")
+	packNames := flags.String("pack", DefaultPack, "Comma separated dataset packs to regenerate results for, or 'all'")
+	checkOnly := flags.Bool("check", false, "Only report stale results and exit non-zero instead of rewriting them")
+	flags.Parse(args)
+
+	packs, err := findDatasetPacks(*packsDir, *packNames)
+	if err != nil {
+		log.Fatalf("Failed to find dataset packs: %v", err)
+	}
+
+	exitCode := ExitOk
+	for _, pack := range packs {
+		fmt.Printf("\n=== Pack: %s\n", pack.Name)
+		if !regeneratePackResults(pack, *checkOnly) {
+			exitCode = ExitFailure
+		}
+	}
+	return exitCode
+}
+
+// Returns false if gold SQL failed, or if results are stale and we're only checking
+func regeneratePackResults(pack *DatasetPack, checkOnly bool) bool {
+	groundTruthFile := pack.Path(pack.GroundTruth)
+	groundTruth, err := loadGroundTruth(groundTruthFile)
+	if err != nil {
+		log.Fatalf("Failed to load ground truth: %v", err)
+	}
+	db, err := pack.OpenDb()
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	failed, changed := 0, 0
+	checks := checkGroundTruthResults(db, groundTruth)
+	for i, check := range checks {
+		switch {
+		case check.Err != nil:
+			failed++
+			fmt.Printf("%sFAILED%s %s: %v\n", boldRed, reset, check.ID, check.Err)
+		case check.Changed():
+			changed++
+			fmt.Printf("%sSTALE%s  %s\n- Stored Result: %s\n- SQL Result:    %s\n", boldRed, reset, check.ID, check.Stored, check.Actual)
+			groundTruth[i].Result = check.Actual
+		default:
+			fmt.Printf("%sOK%s     %s\n", boldGreen, reset, check.ID)
+		}
+	}
+	fmt.Printf("\n%d items: %d ok, %d stale, %d failed\n", len(checks), len(checks)-changed-failed, changed, failed)
+
+	if failed > 0 {
+		fmt.Printf("%sGold SQL no longer runs against %s; fix it before regenerating results%s\n", boldRed, pack.Path(pack.Database), reset)
+		return false
+	}
+	if changed == 0 {
+		return true
+	}
+	if checkOnly {
+		return false
+	}
+	if err := writeGroundTruthResults(groundTruthFile, groundTruth); err != nil {
+		log.Fatalf("Failed to write regenerated results: %v", err)
+	}
+	fmt.Printf("Rewrote %d results in %s\n", changed, groundTruthFile)
+	return true
+}
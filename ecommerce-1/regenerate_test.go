@@ -0,0 +1,67 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckGroundTruthResults(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE Products (id INTEGER PRIMARY KEY, name TEXT, price REAL); INSERT INTO Products (name, price) VALUES ('Product 1', 100), ('Product 2', 200);`)
+	assert.NoError(t, err)
+
+	checks := checkGroundTruthResults(db, []GroundTruthItem{
+		{ID: "count", SQL: "SELECT COUNT(*) FROM Products;", Result: `{"columns":[{"name":"COUNT(*)"}],"rows":[[2]]}`},
+		{ID: "stale", SQL: "SELECT name FROM Products ORDER BY price DESC LIMIT 1;", Result: `{"columns":[{"name":"name","type":"TEXT"}],"rows":[["Product 1"]]}`},
+		{ID: "legacy", SQL: "SELECT COUNT(*) FROM Products;", Result: `[{"COUNT(*)":2}]`},
+		{ID: "broken", SQL: "SELECT nme FROM Products;"},
+		{ID: "broken-alternative", SQL: "SELECT 1;", AlternativeSQL: []string{"SELEC 1;"}},
+	})
+
+	assert.Len(t, checks, 5)
+	assert.NoError(t, checks[0].Err)
+	assert.False(t, checks[0].Changed())
+	assert.True(t, checks[1].Changed())
+	assert.Equal(t, `{"columns":[{"name":"name","type":"TEXT"}],"rows":[["Product 2"]]}`, checks[1].Actual)
+	// results stored the old way are rewritten as result sets
+	assert.True(t, checks[2].Changed())
+	assert.Error(t, checks[3].Err)
+	assert.Error(t, checks[4].Err)
+}
+
+func TestPatchGroundTruthYamlResults(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ground-truth.yaml")
+	content := `# comments survive
+- id: count
+  question: How many products are there?
+  sql: |-
+    SELECT COUNT(*) FROM "Products";
+  result: '[{"COUNT(*)":1}]'
+- id: no-result-yet
+  question: What's the most expensive product?
+  sql: SELECT name FROM Products ORDER BY price DESC LIMIT 1;
+`
+	assert.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+	groundTruth, err := loadGroundTruth(filename)
+	assert.NoError(t, err)
+
+	groundTruth[0].Result = `[{"COUNT(*)":2}]`
+	groundTruth[1].Result = `[{"name":"Product 2"}]`
+	assert.NoError(t, writeGroundTruthResults(filename, groundTruth))
+
+	patched, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Contains(t, string(patched), "# comments survive")
+	reloaded, err := loadGroundTruth(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, groundTruth, reloaded)
+
+	assert.Error(t, writeGroundTruthResults("ground-truth.md", groundTruth))
+}
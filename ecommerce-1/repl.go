@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const DefaultReplHistoryFile = "results/repl-history.jsonl"
+
+// How many earlier turns follow-up questions see
+const MaxReplContextTurns = 5
+
+// One question asked in the REPL, or SQL run in it, and what came of it
+type ReplTurn struct {
+	Time         time.Time `json:"time"`
+	Question     string    `json:"question,omitempty"`
+	FollowUp     bool      `json:"follow_up,omitempty"` // asked with earlier turns as context
+	GeneratedSQL string    `json:"generated_sql,omitempty"`
+	SQL          string    `json:"sql,omitempty"` // what ran, after any editing
+	Edited       bool      `json:"edited,omitempty"`
+	Outcome      string    `json:"outcome,omitempty"`
+	Result       string    `json:"result,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+type ReplSession struct {
+	*Asker
+	HistoryFile string // every turn is appended to it as it happens (optional)
+	History     []ReplTurn
+
+	context        []ReplTurn // the turns a follow-up question refines
+	lastQuestion   string
+	failedAttempts []FailedSqlQueryAttempt // at the last question, for :retry
+	in             *bufio.Scanner
+	out            io.Writer
+}
+
+const replHelp = `Type a question to have SQL generated for it. Before it runs you can run it as is, edit it or skip it.
+Follow-up questions ("only the shipped ones") refine the last query that ran.
+  :sql <query>     run SQL yourself
+  :retry           generate SQL for the last question again, taking its error into account
+  :new             start a new conversation, so the next question isn't a follow-up
+  :history         list the questions asked
+  :export <file>   save the questions that ran as ground truth candidates (.yaml or .jsonl)
+  :quit            leave (as does end of input)
+`
+
+func loadReplHistory(filename string) ([]ReplTurn, error) {
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var history []ReplTurn
+	for i, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var turn ReplTurn
+		if err := json.Unmarshal([]byte(line), &turn); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filename, i+1, err)
+		}
+		history = append(history, turn)
+	}
+	return history, nil
+}
+
+func (session *ReplSession) record(turn ReplTurn) {
+	session.History = append(session.History, turn)
+	if session.HistoryFile == "" {
+		return
+	}
+	line, err := json.Marshal(turn)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(session.HistoryFile), 0755)
+	}
+	if err == nil {
+		var file *os.File
+		if file, err = os.OpenFile(session.HistoryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+			_, err = file.Write(append(line, '\n'))
+			file.Close()
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(session.out, "Failed to save history: %v\n", err)
+	}
+}
+
+// Tells the model what came before so "only the shipped ones" has something to refine
+func (session *ReplSession) contextPrompt() string {
+	if len(session.context) == 0 {
+		return ""
+	}
+	var prompt strings.Builder
+	prompt.WriteString("\nEarlier questions in this conversation and the SQL that answered them. The next question may refine the last of them, in which case answer it by changing that SQL:\n")
+	for _, turn := range session.context {
+		fmt.Fprintf(&prompt, "- Question: %s\n  SQL: %s\n", turn.Question, turn.SQL)
+	}
+	return prompt.String()
+}
+
+func (session *ReplSession) readLine(prompt string) (string, bool) {
+	fmt.Fprint(session.out, prompt)
+	if !session.in.Scan() {
+		return "", false
+	}
+	return strings.TrimSpace(session.in.Text()), true
+}
+
+// Run SQL, show the result as a table and, if it worked, make it what follow-ups refine
+func (session *ReplSession) execute(turn *ReplTurn, sqlQuery string) {
+	turn.SQL = sqlQuery
+	jsonRows, outcome, err := runLimitedQuery(session.Db, sqlQuery, session.Limits)
+	turn.Outcome = outcome
+	if err != nil {
+		turn.Error = stripNewlines(err.Error())
+		fmt.Fprintf(session.out, "Error: %s\n", turn.Error)
+		return
+	}
+	turn.Result = jsonRows
+	result, err := parseResultSet(jsonRows)
+	if err != nil {
+		turn.Error = err.Error()
+		fmt.Fprintf(session.out, "Error: %s\n", turn.Error)
+		return
+	}
+	fmt.Fprint(session.out, result.Markdown())
+	if outcome == QueryOutcomeTruncated {
+		fmt.Fprintf(session.out, "(first %d rows)\n", len(result.Rows))
+	} else {
+		fmt.Fprintf(session.out, "(%d rows)\n", len(result.Rows))
+	}
+
+	session.context = append(session.context, *turn)
+	if len(session.context) > MaxReplContextTurns {
+		session.context = session.context[len(session.context)-MaxReplContextTurns:]
+	}
+}
+
+func (session *ReplSession) ask(question string) {
+	turn := ReplTurn{Time: time.Now(), Question: question, FollowUp: len(session.context) > 0}
+	generated, err := session.Generate(context.Background(), question, session.contextPrompt(), session.failedAttempts)
+	if err != nil {
+		turn.Error = err.Error()
+		fmt.Fprintf(session.out, "Error generating SQL: %v\n", err)
+		session.record(turn)
+		return
+	}
+	turn.GeneratedSQL = generated.SQL
+	sqlQuery := generated.Runnable()
+	fmt.Fprintf(session.out, "SQL: %s\n", sqlQuery)
+
+	answer, ok := session.readLine("Run it? [Y/n/e to edit] ")
+	switch strings.ToLower(answer) {
+	case "", "y", "yes":
+	case "e", "edit":
+		edited, _ := session.readLine("SQL> ")
+		if edited != "" && edited != sqlQuery {
+			sqlQuery = edited
+			turn.Edited = true
+		}
+	default:
+		ok = false
+	}
+	if !ok {
+		fmt.Fprintln(session.out, "Not run")
+		session.record(turn)
+		return
+	}
+
+	session.execute(&turn, sqlQuery)
+	if turn.Error != "" && !turn.Edited {
+		session.failedAttempts = append(session.failedAttempts, FailedSqlQueryAttempt{SqlQuery: turn.SQL, ErrorMessage: turn.Error})
+		fmt.Fprintln(session.out, "Use :retry to generate SQL again taking the error into account")
+	}
+	session.record(turn)
+}
+
+// Successful turns as ground truth, for someone to check, tidy and add to a pack.
+// Follow-ups are tagged as such as they likely need rewording to make sense on their own.
+func replGroundTruthCandidates(history []ReplTurn) []GroundTruthItem {
+	var candidates []GroundTruthItem
+	seenIds := make(map[string]int)
+	for _, turn := range history {
+		if turn.Question == "" || turn.Result == "" || turn.Outcome == QueryOutcomeTruncated {
+			continue
+		}
+		id := slugify(turn.Question)
+		if seenIds[id]++; seenIds[id] > 1 {
+			id = fmt.Sprintf("%s-%d", id, seenIds[id])
+		}
+		tags := []string{"repl"}
+		if turn.FollowUp {
+			tags = append(tags, "follow-up")
+		}
+		candidates = append(candidates, GroundTruthItem{ID: id, Query: turn.Question, SQL: turn.SQL, Result: turn.Result, Tags: tags})
+	}
+	return candidates
+}
+
+// Returns false to quit
+func (session *ReplSession) command(line string) bool {
+	command, argument, _ := strings.Cut(line, " ")
+	argument = strings.TrimSpace(argument)
+	switch command {
+	case ":quit", ":q", ":exit":
+		return false
+	case ":help":
+		fmt.Fprint(session.out, replHelp)
+	case ":new":
+		session.context = nil
+		fmt.Fprintln(session.out, "Started a new conversation")
+	case ":sql":
+		if argument == "" {
+			fmt.Fprintln(session.out, "Usage: :sql <query>")
+			break
+		}
+		turn := ReplTurn{Time: time.Now()}
+		session.execute(&turn, argument)
+		session.record(turn)
+	case ":retry":
+		if session.lastQuestion == "" || len(session.failedAttempts) == 0 {
+			fmt.Fprintln(session.out, "Nothing to retry")
+			break
+		}
+		session.ask(session.lastQuestion)
+	case ":history":
+		for i, turn := range session.History {
+			status := "ok"
+			if turn.Error != "" {
+				status = "error"
+			} else if turn.SQL == "" {
+				status = "not run"
+			}
+			text := turn.Question
+			if text == "" {
+				text = turn.SQL
+			}
+			fmt.Fprintf(session.out, "%3d %-8s %s\n", i+1, status, text)
+		}
+	case ":export":
+		candidates := replGroundTruthCandidates(session.History)
+		if argument == "" || len(candidates) == 0 {
+			fmt.Fprintln(session.out, "Usage: :export <file.yaml|file.jsonl>, once a question has run")
+			break
+		}
+		if err := saveGroundTruth(argument, candidates); err != nil {
+			fmt.Fprintf(session.out, "Failed to export: %v\n", err)
+			break
+		}
+		fmt.Fprintf(session.out, "Exported %d ground truth candidates to %s\n", len(candidates), argument)
+	default:
+		fmt.Fprintf(session.out, "Unknown command %s, see :help\n", command)
+	}
+	return true
+}
+
+func (session *ReplSession) Run(in io.Reader, out io.Writer) error {
+	session.in = bufio.NewScanner(in)
+	session.out = out
+	fmt.Fprintln(out, "Ask a question, or :help")
+	for {
+		line, ok := session.readLine("> ")
+		if !ok {
+			fmt.Fprintln(out)
+			return session.in.Err()
+		}
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, ":"):
+			if !session.command(line) {
+				return nil
+			}
+		default:
+			session.lastQuestion = line
+			session.failedAttempts = nil
+			session.ask(line)
+		}
+	}
+}
+
+// repl: ask questions interactively, refining them with follow-ups
+func runRepl(args []string) int {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	options := addAskFlags(flags)
+	historyFile := flags.String("history", DefaultReplHistoryFile, "File questions and their SQL are saved to, and loaded from on start")
+	flags.Parse(args)
+	if !options.valid() {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	history, err := loadReplHistory(*historyFile)
+	if err != nil {
+		log.Fatalf("Failed to load history: %v", err)
+	}
+	asker := options.open()
+	defer asker.Db.Close()
+	session := &ReplSession{Asker: asker, HistoryFile: *historyFile, History: history}
+	if err := session.Run(os.Stdin, os.Stdout); err != nil {
+		log.Fatalf("Failed to read input: %v", err)
+	}
+	return ExitOk
+}
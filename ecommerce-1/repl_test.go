@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Answers with the next of its responses, keeping the prompts it was given
+type scriptedModel struct {
+	responses []string
+	prompts   []string
+	seeds     []int // each call was made with
+}
+
+func (model *scriptedModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var prompt strings.Builder
+	for _, message := range messages {
+		for _, part := range message.Parts {
+			if text, ok := part.(llms.TextContent); ok {
+				prompt.WriteString(text.Text)
+			}
+		}
+	}
+	model.prompts = append(model.prompts, prompt.String())
+	var callOptions llms.CallOptions
+	for _, option := range options {
+		option(&callOptions)
+	}
+	model.seeds = append(model.seeds, callOptions.Seed)
+	response := ""
+	if len(model.responses) > 0 {
+		response, model.responses = model.responses[0], model.responses[1:]
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: response}}}, nil
+}
+
+func (model *scriptedModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, model, prompt, options...)
+}
+
+func TestReplSession(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE Orders (id INTEGER PRIMARY KEY, shipping_status TEXT);
+INSERT INTO Orders (shipping_status) VALUES ('pending'), ('shipped'), ('shipped');`)
+	assert.NoError(t, err)
+
+	model := &scriptedModel{responses: []string{
+		"SELECT COUNT(*) AS orders FROM Orders",
+		"SELECT COUNT(*) AS orders FROM Order WHERE shipping_status = 'shipped'",
+		"SELECT COUNT(*) AS orders FROM Orders WHERE shipping_status = 'shipped'",
+		"SELECT id FROM Orders",
+	}}
+	dir := t.TempDir()
+	maxTokens := 200
+	asker := &Asker{Db: db, Model: model, Schema: "CREATE TABLE Orders (id INTEGER PRIMARY KEY, shipping_status TEXT);", Dialect: DialectSQLite,
+		MaxTokens: &maxTokens, Seed: NoSeed, Limits: QueryLimits{MaxRows: 10}}
+	session := &ReplSession{Asker: asker, HistoryFile: filepath.Join(dir, "history.jsonl")}
+	input := strings.Join([]string{
+		"How many orders are there?", "",
+		"only the shipped ones", "y",
+		":retry", "",
+		"Which orders are there?", "e", "SELECT id FROM Orders WHERE id > 1",
+		":sql SELECT 1 AS one",
+		":bogus",
+		":export " + filepath.Join(dir, "candidates.yaml"),
+		":quit",
+	}, "\n")
+	var out bytes.Buffer
+	assert.NoError(t, session.Run(strings.NewReader(input), &out))
+
+	// follow-ups see the earlier questions and their SQL, the retry sees the error too
+	assert.Len(t, model.prompts, 4)
+	assert.NotContains(t, model.prompts[0], "Earlier questions")
+	assert.Contains(t, model.prompts[1], "- Question: How many orders are there?\n  SQL: SELECT COUNT(*) AS orders FROM Orders\n")
+	assert.Contains(t, model.prompts[2], `near "Order": syntax error`)
+	assert.Contains(t, out.String(), "| orders |\n| --- |\n| 2 |\n(1 rows)\n")
+	assert.Contains(t, out.String(), "Unknown command :bogus")
+	assert.Contains(t, out.String(), "Exported 3 ground truth candidates")
+
+	assert.Len(t, session.History, 5)
+	assert.NotEmpty(t, session.History[1].Error)
+	edited := session.History[3]
+	assert.True(t, edited.Edited)
+	assert.Equal(t, "SELECT id FROM Orders", edited.GeneratedSQL)
+	assert.Equal(t, "SELECT id FROM Orders WHERE id > 1", edited.SQL)
+
+	// the history's saved as it goes, and loads back
+	history, err := loadReplHistory(session.HistoryFile)
+	assert.NoError(t, err)
+	assert.Equal(t, len(session.History), len(history))
+	assert.Equal(t, edited.SQL, history[3].SQL)
+
+	// only questions that ran make candidates, follow-ups tagged as such and repeats given their own IDs
+	candidates, err := loadGroundTruth(filepath.Join(dir, "candidates.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"how-many-orders-are-there", "only-the-shipped-ones", "which-orders-are-there"}, []string{candidates[0].ID, candidates[1].ID, candidates[2].ID})
+	assert.Equal(t, []string{"repl", "follow-up"}, candidates[1].Tags)
+	assert.Equal(t, `{"columns":[{"name":"id","type":"INTEGER"}],"rows":[[2],[3]]}`, candidates[2].Result)
+
+	again := replGroundTruthCandidates(append(history, history[0]))
+	assert.Equal(t, "how-many-orders-are-there-2", again[len(again)-1].ID)
+}
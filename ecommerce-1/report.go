@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Formats saved runs can be reported in
+const (
+	ReportFormatText     = "text"
+	ReportFormatMarkdown = "markdown"
+	ReportFormatJson     = "json"
+)
+
+// How a question went for a model, in a word or two
+func questionVerdict(question *QuestionRecord) string {
+	switch {
+	case question.Correct:
+		return "correct"
+	case question.Executed:
+		return "wrong"
+	case question.Outcome != "":
+		return question.Outcome
+	default:
+		return "no SQL"
+	}
+}
+
+func modelDialectIssues(model *ModelRunRecord) string {
+	counts := model.DialectIssueCounts()
+	issues := make([]string, 0, len(counts))
+	for _, construct := range sortedKeys(counts) {
+		issues = append(issues, fmt.Sprintf("%s %d", construct, counts[construct]))
+	}
+	return strings.Join(issues, ", ")
+}
+
+func printRunHeader(w io.Writer, record *RunRecord, heading string) {
+	fmt.Fprintf(w, "%sRun %s (%s), seed %d, evaluator %s", heading, record.StartedAt.Format("2006-01-02 15:04:05"), record.FinishedAt.Sub(record.StartedAt).Round(time.Second), record.Seed, record.Evaluator)
+	if record.Dialect != "" {
+		fmt.Fprintf(w, ", dialect %s", record.Dialect)
+	}
+	if record.SchemaLinking != "" {
+		fmt.Fprintf(w, ", schema linking %s", record.SchemaLinking)
+	}
+	if record.ValueHints {
+		fmt.Fprint(w, ", value hints")
+	}
+	if record.Glossary != "" {
+		fmt.Fprintf(w, ", glossary %s", record.Glossary)
+	}
+	fmt.Fprintln(w)
+}
+
+func printRunReportText(w io.Writer, record *RunRecord, questions bool) {
+	printRunHeader(w, record, "")
+	printRunSummary(w, record)
+	if !questions {
+		return
+	}
+	for _, pack := range record.Packs {
+		for _, model := range pack.Models {
+			fmt.Fprintf(w, "\n--- %s: %s\n", pack.Pack, model.Label())
+			for _, question := range model.Questions {
+				fmt.Fprintf(w, "%-40s %s\n", question.ID, questionVerdict(question))
+			}
+		}
+	}
+}
+
+func printRunReportMarkdown(w io.Writer, record *RunRecord, questions bool) {
+	printRunHeader(w, record, "# ")
+	for _, pack := range record.Packs {
+		if pack.Metric != "" {
+			fmt.Fprintf(w, "\n## Pack: %s (%s)\n\n", pack.Pack, pack.Metric)
+		} else {
+			fmt.Fprintf(w, "\n## Pack: %s\n\n", pack.Pack)
+		}
+		fmt.Fprintln(w, "| Model | Correct | Accuracy | Timed out | Truncated | Plan cost (gold) | Tokens | Cost (per correct) | Evaluator tokens (cost) | Schema recall | Dialect issues |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- |")
+		for _, model := range pack.Models {
+			accuracy := "-"
+			if len(model.Questions) > 0 {
+				accuracy = fmt.Sprintf("%.0f%%", 100*float64(model.CorrectCount())/float64(len(model.Questions)))
+			}
+			planCost := "-"
+			if predicted, gold, count := model.PlanCost(); count > 0 {
+				planCost = fmt.Sprintf("%d (%d)", predicted, gold)
+			}
+			tokens := "-"
+			if usage := model.Tokens(); usage.Total() > 0 {
+				tokens = formatTokens(usage.Total())
+				if usage.Estimated {
+					tokens = "~" + tokens
+				}
+			}
+			cost := "-"
+			if total, perCorrect, priced := model.Cost(); priced {
+				cost = formatCost(total)
+				if model.CorrectCount() > 0 {
+					cost += fmt.Sprintf(" (%s)", formatCost(perCorrect))
+				}
+			}
+			evaluator := "-"
+			if usage := model.EvaluatorTokens(); usage.Total() > 0 {
+				evaluator = formatTokens(usage.Total())
+				if usage.Estimated {
+					evaluator = "~" + evaluator
+				}
+				if cost, priced := model.EvaluatorCost(); priced {
+					evaluator += fmt.Sprintf(" (%s)", formatCost(cost))
+				}
+			}
+			schemaRecall := "-"
+			if recall, count := model.SchemaLinkRecall(); count > 0 {
+				schemaRecall = fmt.Sprintf("%.0f%%", 100*recall)
+			}
+			fmt.Fprintf(w, "| %s | %d/%d | %s | %d | %d | %s | %s | %s | %s | %s | %s |\n", markdownCell(model.Label()),
+				model.CorrectCount(), len(model.Questions), accuracy, model.OutcomeCount(QueryOutcomeTimeout), model.OutcomeCount(QueryOutcomeTruncated),
+				planCost, tokens, cost, evaluator, schemaRecall, modelDialectIssues(model))
+		}
+		printAccuracySlicesMarkdown(w, pack)
+		if !questions || len(pack.Models) == 0 {
+			continue
+		}
+
+		// one row per question, one column per model
+		header := []string{"Question"}
+		for _, model := range pack.Models {
+			column := model.Model
+			if model.Glossary {
+				column += " (glossary)"
+			}
+			header = append(header, markdownCell(column))
+		}
+		fmt.Fprintf(w, "\n| %s |\n|%s\n", strings.Join(header, " | "), strings.Repeat(" --- |", len(header)))
+		for i, question := range pack.Models[0].Questions {
+			row := []string{markdownCell(question.ID)}
+			for _, model := range pack.Models {
+				verdict := "-"
+				if i < len(model.Questions) {
+					verdict = questionVerdict(model.Questions[i])
+				}
+				row = append(row, verdict)
+			}
+			fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+		}
+	}
+}
+
+// Accuracy by difficulty and by tag, for packs whose ground truth has them
+func printAccuracySlicesMarkdown(w io.Writer, pack *PackRunRecord) {
+	sliced := false
+	for _, model := range pack.Models {
+		if len(model.DifficultyAccuracy()) > 0 || len(model.TagAccuracy()) > 0 {
+			sliced = true
+		}
+	}
+	if !sliced {
+		return
+	}
+	fmt.Fprintln(w, "\n| Model | By difficulty | By tag |\n| --- | --- | --- |")
+	for _, model := range pack.Models {
+		fmt.Fprintf(w, "| %s | %s | %s |\n", markdownCell(model.Label()), formatAccuracySlices(model.DifficultyAccuracy()), formatAccuracySlices(model.TagAccuracy()))
+	}
+}
+
+func printRunReport(w io.Writer, record *RunRecord, format string, questions bool) error {
+	switch format {
+	case ReportFormatText:
+		printRunReportText(w, record, questions)
+	case ReportFormatMarkdown:
+		printRunReportMarkdown(w, record, questions)
+	case ReportFormatJson:
+		content, err := json.MarshalIndent(record, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(content))
+	default:
+		return fmt.Errorf("unknown report format '%s'", format)
+	}
+	return nil
+}
+
+// report: render saved benchmark runs
+func runReport(args []string) int {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	resultsDir := flags.String("results-dir", DefaultResultsDir, "Directory the run results are saved in")
+	format := flags.String("format", ReportFormatText, "Report format: text, markdown or json")
+	questions := flags.Bool("questions", false, "Also show how every model did on every question")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: report [flags] [run files]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *format != ReportFormatText && *format != ReportFormatMarkdown && *format != ReportFormatJson {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	runFiles := flags.Args()
+	if len(runFiles) == 0 {
+		latest, err := latestRunRecordFile(*resultsDir)
+		if err != nil {
+			log.Fatalf("Failed to find a run to report: %v", err)
+		}
+		runFiles = []string{latest}
+	}
+	for i, runFile := range runFiles {
+		record, err := loadRunRecord(runFile)
+		if err != nil {
+			log.Fatalf("Failed to load run: %v", err)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := printRunReport(os.Stdout, record, *format, *questions); err != nil {
+			log.Fatalf("Failed to report run: %v", err)
+		}
+	}
+	return ExitOk
+}
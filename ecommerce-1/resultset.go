@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The result of a query exactly as SQLite returned it: columns in order (duplicate names and
+// all), their declared types, and values that are nil (NULL), int64, float64, string or []byte (BLOB).
+type ResultSet struct {
+	Columns []ResultColumn  `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+type ResultColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"` // as declared in the schema, empty for expressions like COUNT(*)
+}
+
+// Blobs are encoded in JSON as {"base64": "..."} so they can't be mistaken for text
+type resultBlob struct {
+	Base64 string `json:"base64"`
+}
+
+func (result *ResultSet) ColumnNames() []string {
+	names := make([]string, len(result.Columns))
+	for i, column := range result.Columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// go-sqlite3 parses columns declared as dates and times; put them back as SQLite has them
+func normaliseResultValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Time:
+		if v.Location() == time.UTC && v.Equal(v.Truncate(24*time.Hour)) {
+			return v.Format("2006-01-02")
+		}
+		if v.Location() == time.UTC {
+			return v.Format("2006-01-02 15:04:05.999999999")
+		}
+		return v.Format("2006-01-02 15:04:05.999999999-07:00")
+	case []byte:
+		// Scan reuses its buffers
+		return append([]byte(nil), v...)
+	case int:
+		return int64(v)
+	}
+	return value
+}
+
+// Read rows into a result set, stopping once it has maxRows rows or its JSON would be over
+// maxBytes, and say whether it did. Zero means no limit.
+func readResultSet(rows *sql.Rows, maxRows int, maxBytes int) (*ResultSet, bool, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, false, err
+	}
+	result := &ResultSet{Columns: make([]ResultColumn, len(columnTypes)), Rows: [][]interface{}{}}
+	for i, columnType := range columnTypes {
+		result.Columns[i] = ResultColumn{Name: columnType.Name(), Type: columnType.DatabaseTypeName()}
+	}
+	header, err := json.Marshal(result.Columns)
+	if err != nil {
+		return nil, false, err
+	}
+	size := len(`{"columns":,"rows":[]}`) + len(header)
+
+	values := make([]interface{}, len(columnTypes))
+	scanArgs := make([]interface{}, len(values))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	for rows.Next() {
+		if maxRows > 0 && len(result.Rows) == maxRows {
+			return result, true, nil
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			return nil, false, err
+		}
+		row := make([]interface{}, len(values))
+		for i, value := range values {
+			row[i] = normaliseResultValue(value)
+		}
+		if maxBytes > 0 {
+			encoded, err := encodeResultRow(row)
+			if err != nil {
+				return nil, false, err
+			}
+			rowSize := len(encoded)
+			if len(result.Rows) > 0 {
+				rowSize++ // the comma between rows
+			}
+			if size+rowSize > maxBytes {
+				return result, true, nil
+			}
+			size += rowSize
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	return result, false, nil
+}
+
+func encodeResultValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return resultBlob{Base64: base64.StdEncoding.EncodeToString(v)}
+	case float64:
+		// JSON has no infinity, which SQLite can produce from e.g. 1e999
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	}
+	return value
+}
+
+func encodeResultRow(row []interface{}) ([]byte, error) {
+	encoded := make([]interface{}, len(row))
+	for i, value := range row {
+		encoded[i] = encodeResultValue(value)
+	}
+	return json.Marshal(encoded)
+}
+
+func (result *ResultSet) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	columns, err := json.Marshal(result.Columns)
+	if err != nil {
+		return nil, err
+	}
+	buffer.WriteString(`{"columns":`)
+	buffer.Write(columns)
+	buffer.WriteString(`,"rows":[`)
+	for i, row := range result.Rows {
+		if i > 0 {
+			buffer.WriteString(",")
+		}
+		encoded, err := encodeResultRow(row)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(encoded)
+	}
+	buffer.WriteString("]}")
+	return buffer.Bytes(), nil
+}
+
+// The result as compact JSON, which is how results are stored in ground truth and run records
+func (result *ResultSet) JSON() string {
+	encoded, err := result.MarshalJSON()
+	if err != nil {
+		// only possible with values that didn't come from a query
+		return fmt.Sprintf(`{"error":%q}`, err.Error())
+	}
+	return string(encoded)
+}
+
+// CSV with a header row. CSV can't tell NULL from an empty string so NULL is left empty.
+func (result *ResultSet) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(result.ColumnNames()); err != nil {
+		return err
+	}
+	for _, row := range result.Rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			if value != nil {
+				record[i] = formatResultValue(value)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (result *ResultSet) CSV() string {
+	var buffer bytes.Buffer
+	result.WriteCSV(&buffer)
+	return buffer.String()
+}
+
+// Text that can go in a Markdown table cell without breaking the table
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "<br>"), "\n", "<br>")
+}
+
+// A Markdown table, which parseMarkdownTables can read back (as text)
+func (result *ResultSet) Markdown() string {
+	var table strings.Builder
+	names := make([]string, len(result.Columns))
+	delimiters := make([]string, len(result.Columns))
+	for i, column := range result.Columns {
+		names[i] = markdownCell(column.Name)
+		delimiters[i] = "---"
+	}
+	fmt.Fprintf(&table, "| %s |\n| %s |\n", strings.Join(names, " | "), strings.Join(delimiters, " | "))
+	for _, row := range result.Rows {
+		cells := make([]string, len(row))
+		for i, value := range row {
+			cells[i] = markdownCell(formatResultValue(value))
+		}
+		fmt.Fprintf(&table, "| %s |\n", strings.Join(cells, " | "))
+	}
+	return table.String()
+}
+
+// Formats a result set can be written in
+const (
+	ResultFormatJson     = "json"
+	ResultFormatCsv      = "csv"
+	ResultFormatMarkdown = "markdown"
+)
+
+func validResultFormat(format string) bool {
+	return format == ResultFormatJson || format == ResultFormatCsv || format == ResultFormatMarkdown
+}
+
+func (result *ResultSet) Write(w io.Writer, format string) error {
+	var err error
+	switch format {
+	case ResultFormatJson:
+		_, err = fmt.Fprintln(w, result.JSON())
+	case ResultFormatCsv:
+		err = result.WriteCSV(w)
+	case ResultFormatMarkdown:
+		_, err = io.WriteString(w, result.Markdown())
+	default:
+		err = fmt.Errorf("unknown result format '%s'", format)
+	}
+	return err
+}
+
+// A value as text for people: NULL spelt out, blobs as base64 and numbers as SQLite prints them
+func formatResultValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return v
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Parse a result from JSON. As well as the result set format this reads the array of objects
+// format results used to be stored in, keeping the columns in the order they were written.
+func parseResultSet(encoded string) (*ResultSet, error) {
+	trimmed := strings.TrimSpace(encoded)
+	switch {
+	case strings.HasPrefix(trimmed, "{"):
+		return parseResultSetJson(trimmed)
+	case strings.HasPrefix(trimmed, "["):
+		return parseLegacyResultJson(trimmed)
+	default:
+		return nil, fmt.Errorf("not a JSON result: %s", truncate(trimmed, 40))
+	}
+}
+
+func decodeResultValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case map[string]interface{}:
+		encoded, ok := v["base64"].(string)
+		if !ok || len(v) != 1 {
+			return nil, fmt.Errorf("unexpected object value %v", v)
+		}
+		return base64.StdEncoding.DecodeString(encoded)
+	case []interface{}:
+		return nil, fmt.Errorf("unexpected array value %v", v)
+	}
+	return value, nil
+}
+
+func parseResultSetJson(encoded string) (*ResultSet, error) {
+	var raw struct {
+		Columns []ResultColumn  `json:"columns"`
+		Rows    [][]interface{} `json:"rows"`
+	}
+	decoder := json.NewDecoder(strings.NewReader(encoded))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	result := &ResultSet{Columns: raw.Columns, Rows: make([][]interface{}, len(raw.Rows))}
+	for i, row := range raw.Rows {
+		if len(row) != len(raw.Columns) {
+			return nil, fmt.Errorf("row %d has %d values for %d columns", i+1, len(row), len(raw.Columns))
+		}
+		result.Rows[i] = make([]interface{}, len(row))
+		for j, value := range row {
+			decoded, err := decodeResultValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %v", i+1, err)
+			}
+			result.Rows[i][j] = decoded
+		}
+	}
+	return result, nil
+}
+
+// [{"name":"a","price":1}, ...]: read key by key as decoding into maps would lose the column order
+func parseLegacyResultJson(encoded string) (*ResultSet, error) {
+	decoder := json.NewDecoder(strings.NewReader(encoded))
+	decoder.UseNumber()
+	expect := func(want json.Delim) error {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if token != want {
+			return fmt.Errorf("expected %v but found %v", want, token)
+		}
+		return nil
+	}
+
+	result := &ResultSet{Rows: [][]interface{}{}}
+	columnIndex := make(map[string]int)
+	if err := expect('['); err != nil {
+		return nil, err
+	}
+	for decoder.More() {
+		if err := expect('{'); err != nil {
+			return nil, err
+		}
+		row := make([]interface{}, len(result.Columns))
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			name := token.(string)
+			var value interface{}
+			if err := decoder.Decode(&value); err != nil {
+				return nil, err
+			}
+			decoded, err := decodeResultValue(value)
+			if err != nil {
+				return nil, err
+			}
+			index, ok := columnIndex[name]
+			if !ok {
+				// a column earlier rows didn't have, so they're NULL for it
+				index = len(result.Columns)
+				columnIndex[name] = index
+				result.Columns = append(result.Columns, ResultColumn{Name: name})
+				for i := range result.Rows {
+					result.Rows[i] = append(result.Rows[i], nil)
+				}
+				row = append(row, nil)
+			}
+			row[index] = decoded
+		}
+		if err := expect('}'); err != nil {
+			return nil, err
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if err := expect(']'); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Each row as a string that's equal for equal rows: its column names and values, sorted so
+// the order of the columns doesn't matter but their names do
+func (result *ResultSet) canonicalRows() []string {
+	canonicalRows := make([]string, len(result.Rows))
+	for i, row := range result.Rows {
+		cells := make([]string, len(row))
+		for j, value := range row {
+			encoded, _ := json.Marshal(encodeResultValue(value))
+			name, _ := json.Marshal(result.Columns[j].Name)
+			cells[j] = string(name) + ":" + string(encoded)
+		}
+		sort.Strings(cells)
+		canonicalRows[i] = strings.Join(cells, ",")
+	}
+	return canonicalRows
+}
+
+// The column a name means: the one called that ignoring case, otherwise the only one with
+// the name in it (count for COUNT(*)), otherwise the only column there is
+func (result *ResultSet) columnIndex(name string) (int, error) {
+	contains := -1
+	for i, column := range result.Columns {
+		if strings.EqualFold(column.Name, name) {
+			return i, nil
+		}
+		if strings.Contains(strings.ToLower(column.Name), strings.ToLower(name)) {
+			if contains >= 0 {
+				return -1, fmt.Errorf("'%s' could be any of %v", name, result.ColumnNames())
+			}
+			contains = i
+		}
+	}
+	if contains >= 0 {
+		return contains, nil
+	}
+	if len(result.Columns) == 1 {
+		return 0, nil
+	}
+	return -1, fmt.Errorf("no column '%s' in %v", name, result.ColumnNames())
+}
+
+// Just the named columns, in the order they're named
+func (result *ResultSet) project(names []string) (*ResultSet, error) {
+	indexes := make([]int, len(names))
+	projected := &ResultSet{Columns: make([]ResultColumn, len(names)), Rows: make([][]interface{}, len(result.Rows))}
+	for i, name := range names {
+		index, err := result.columnIndex(name)
+		if err != nil {
+			return nil, err
+		}
+		indexes[i] = index
+		projected.Columns[i] = result.Columns[index]
+	}
+	for i, row := range result.Rows {
+		projected.Rows[i] = make([]interface{}, len(indexes))
+		for j, index := range indexes {
+			projected.Rows[i][j] = row[index]
+		}
+	}
+	return projected, nil
+}
+
+// Like canonicalRows but with the values alone, so what the columns are called doesn't matter
+func (result *ResultSet) canonicalValueRows() []string {
+	canonicalRows := make([]string, len(result.Rows))
+	for i, row := range result.Rows {
+		cells := make([]string, len(row))
+		for j, value := range row {
+			encoded, _ := json.Marshal(encodeResultValue(value))
+			cells[j] = string(encoded)
+		}
+		sort.Strings(cells)
+		canonicalRows[i] = strings.Join(cells, ",")
+	}
+	return canonicalRows
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func queryTestResultSet(t *testing.T, db *sql.DB, query string, maxRows int, maxBytes int) (*ResultSet, bool) {
+	rows, err := db.Query(query)
+	assert.NoError(t, err)
+	defer rows.Close()
+	result, truncated, err := readResultSet(rows, maxRows, maxBytes)
+	assert.NoError(t, err)
+	return result, truncated
+}
+
+func TestReadResultSet(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE Customers (id INTEGER PRIMARY KEY, name TEXT, joined DATE, photo BLOB);
+CREATE TABLE Orders (id INTEGER PRIMARY KEY, customer_id INTEGER, name TEXT);
+INSERT INTO Customers VALUES (1, 'Ann', '2024-03-01', x'00ff10'), (2, NULL, NULL, NULL);
+INSERT INTO Orders VALUES (10, 1, 'First order');`)
+	assert.NoError(t, err)
+
+	// two columns called name, in the order they were selected, with their types and a blob
+	result, truncated := queryTestResultSet(t, db, `SELECT o.name, c.name, c.id, c.joined, c.photo, 1.5 AS ratio FROM Orders o JOIN Customers c ON o.customer_id = c.id`, 0, 0)
+	assert.False(t, truncated)
+	assert.Equal(t, []ResultColumn{{"name", "TEXT"}, {"name", "TEXT"}, {"id", "INTEGER"}, {"joined", "DATE"}, {"photo", "BLOB"}, {"ratio", ""}}, result.Columns)
+	assert.Equal(t, [][]interface{}{{"First order", "Ann", int64(1), "2024-03-01", []byte{0, 255, 16}, 1.5}}, result.Rows)
+	assert.Equal(t, `{"columns":[{"name":"name","type":"TEXT"},{"name":"name","type":"TEXT"},{"name":"id","type":"INTEGER"},{"name":"joined","type":"DATE"},{"name":"photo","type":"BLOB"},{"name":"ratio"}],"rows":[["First order","Ann",1,"2024-03-01",{"base64":"AP8Q"},1.5]]}`, result.JSON())
+
+	// and it reads back exactly
+	parsed, err := parseResultSet(result.JSON())
+	assert.NoError(t, err)
+	assert.Equal(t, result, parsed)
+
+	result, _ = queryTestResultSet(t, db, `SELECT id, name, joined, photo FROM Customers ORDER BY id`, 0, 0)
+	assert.Equal(t, []interface{}{int64(2), nil, nil, nil}, result.Rows[1])
+	assert.Equal(t, "id,name,joined,photo\n1,Ann,2024-03-01,AP8Q\n2,,,\n", result.CSV())
+	assert.Equal(t, "| id | name | joined | photo |\n| --- | --- | --- | --- |\n| 1 | Ann | 2024-03-01 | AP8Q |\n| 2 | NULL | NULL | NULL |\n", result.Markdown())
+
+	// no rows is still a result with columns
+	result, _ = queryTestResultSet(t, db, `SELECT id FROM Customers WHERE id > 5`, 0, 0)
+	assert.Equal(t, `{"columns":[{"name":"id","type":"INTEGER"}],"rows":[]}`, result.JSON())
+}
+
+func TestReadResultSetLimits(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	query := `WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n WHERE x < 5) SELECT x FROM n`
+
+	result, truncated := queryTestResultSet(t, db, query, 2, 0)
+	assert.True(t, truncated)
+	assert.Equal(t, `{"columns":[{"name":"x"}],"rows":[[1],[2]]}`, result.JSON())
+
+	result, truncated = queryTestResultSet(t, db, query, 0, 47)
+	assert.True(t, truncated)
+	assert.LessOrEqual(t, len(result.JSON()), 47)
+	assert.Equal(t, `{"columns":[{"name":"x"}],"rows":[[1],[2],[3]]}`, result.JSON())
+
+	// exactly the limit isn't truncated
+	_, truncated = queryTestResultSet(t, db, query, 5, 0)
+	assert.False(t, truncated)
+}
+
+func TestParseLegacyResult(t *testing.T) {
+	result, err := parseResultSet(`[{"name":"Product 7","profit":14700},{"profit":1.5,"name":"Product 1","rank":2}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"name", "profit", "rank"}, result.ColumnNames())
+	assert.Equal(t, [][]interface{}{{"Product 7", int64(14700), nil}, {"Product 1", 1.5, int64(2)}}, result.Rows)
+
+	_, err = parseResultSet(`not json`)
+	assert.Error(t, err)
+	_, err = parseResultSet(`[1, 2]`)
+	assert.Error(t, err)
+	_, err = parseResultSet(`{"columns":[{"name":"a"}],"rows":[[1, 2]]}`)
+	assert.Error(t, err)
+}
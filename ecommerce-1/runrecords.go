@@ -0,0 +1,457 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const DefaultResultsDir = "results"
+
+// Everything that happened in one run of the benchmark, saved as JSON so runs can be compared later
+type RunRecord struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Seed       int       `json:"seed"`
+	MaxTokens  int       `json:"max_tokens"`
+	Dialect    string    `json:"dialect,omitempty"`
+	// how each question's tables were picked from the schema, and whether values were hinted at
+	SchemaLinking string           `json:"schema_linking,omitempty"`
+	ValueHints    bool             `json:"value_hints,omitempty"`
+	Glossary      string           `json:"glossary,omitempty"` // on, off or compare
+	Evaluator     string           `json:"evaluator"`
+	Packs         []*PackRunRecord `json:"packs"`
+}
+
+type PackRunRecord struct {
+	Pack   string `json:"pack"`
+	Metric string `json:"metric,omitempty"`
+	// of the pack's database when the run started; every model runs against a copy of it
+	DatabaseSha256 string            `json:"database_sha256"`
+	Models         []*ModelRunRecord `json:"models"`
+}
+
+type ModelRunRecord struct {
+	Name  string      `json:"name"`
+	Model string      `json:"model"`
+	Price *ModelPrice `json:"price,omitempty"` // at the time of the run, if known
+	// of the evaluator that judged the model's SQL, if known
+	EvaluatorPrice *ModelPrice `json:"evaluator_price,omitempty"`
+	// whether the pack's glossary was used; comparing runs each model with and without it
+	Glossary bool `json:"glossary,omitempty"`
+	// of the copy of the database the model's SQL ran against, before it ran any
+	DatabaseSha256 string            `json:"database_sha256"`
+	Questions      []*QuestionRecord `json:"questions"`
+}
+
+type QuestionRecord struct {
+	ID             string                 `json:"id"`
+	Question       string                 `json:"question"`
+	GoldSQL        string                 `json:"gold_sql"`
+	PredictedSQL   string                 `json:"predicted_sql,omitempty"`
+	ExecutedSQL    string                 `json:"executed_sql,omitempty"` // what actually ran, if translating the dialect changed it
+	Attempts       int                    `json:"attempts"`
+	Executed       bool                   `json:"executed"`          // whether a predicted query ran without error
+	Outcome        string                 `json:"outcome,omitempty"` // of running the last predicted query: ok, error, timeout or truncated
+	Comparison     SqlQueryEvaluationType `json:"comparison,omitempty"`
+	Correct        bool                   `json:"correct"`
+	MatchedVariant string                 `json:"matched_variant,omitempty"`
+	Result         string                 `json:"result,omitempty"`
+	Error          string                 `json:"error,omitempty"`
+	// how SQLite would run the predicted query, once it has run, and the gold query, to compare efficiency
+	PredictedPlan *QueryPlan `json:"predicted_plan,omitempty"`
+	GoldPlan      *QueryPlan `json:"gold_plan,omitempty"`
+	// constructs from other dialects in any predicted query, and the ones translated for SQLite in the last
+	DialectIssues []string `json:"dialect_issues,omitempty"`
+	Translated    []string `json:"translated,omitempty"`
+	// how long the model took to start answering, on the first attempt, and to write every attempt
+	TimeToFirstToken time.Duration `json:"time_to_first_token_ns,omitempty"`
+	GenerationTime   time.Duration `json:"generation_time_ns,omitempty"`
+	StoppedEarly     int           `json:"stopped_early,omitempty"` // attempts cut off at the end of the statement
+	// tokens generating the SQL used over every attempt, and asking the model which tables it needs
+	// when it's asked, and what they cost if the model's price is known
+	PromptTokens     int     `json:"prompt_tokens,omitempty"`
+	CompletionTokens int     `json:"completion_tokens,omitempty"`
+	TokensEstimated  bool    `json:"tokens_estimated,omitempty"` // some weren't reported by the provider
+	Cost             float64 `json:"cost,omitempty"`
+	// the tables the generator was given, when the schema was linked, and the ones the gold SQL uses
+	LinkedTables []string `json:"linked_tables,omitempty"`
+	GoldTables   []string `json:"gold_tables,omitempty"` // of the gold SQL or alternative the link covered best
+	// what the model was told about the values the question refers to
+	ValueHints []string `json:"value_hints,omitempty"`
+	// the glossary terms the question used, which the model was given definitions of
+	GlossaryTerms []string `json:"glossary_terms,omitempty"`
+	// tokens the evaluator used judging the predicted SQL, counted apart from the model's own,
+	// and what they cost at the evaluator's price
+	EvaluatorPromptTokens     int     `json:"evaluator_prompt_tokens,omitempty"`
+	EvaluatorCompletionTokens int     `json:"evaluator_completion_tokens,omitempty"`
+	EvaluatorTokensEstimated  bool    `json:"evaluator_tokens_estimated,omitempty"`
+	EvaluatorCost             float64 `json:"evaluator_cost,omitempty"`
+	// from the ground truth, to slice accuracy by
+	Tags       []string `json:"tags,omitempty"`
+	Difficulty string   `json:"difficulty,omitempty"`
+}
+
+func (question *QuestionRecord) addGenerationStats(stats *GenerationStats, price *ModelPrice) {
+	if stats == nil {
+		return
+	}
+	if question.GenerationTime == 0 {
+		question.TimeToFirstToken = stats.TimeToFirstToken
+	}
+	question.GenerationTime += stats.Total
+	if stats.StoppedEarly {
+		question.StoppedEarly++
+	}
+	question.addUsage(stats.Usage, price)
+}
+
+func (question *QuestionRecord) addEvaluatorUsage(stats *GenerationStats, price *ModelPrice) {
+	if stats == nil {
+		return
+	}
+	question.EvaluatorPromptTokens += stats.Usage.PromptTokens
+	question.EvaluatorCompletionTokens += stats.Usage.CompletionTokens
+	question.EvaluatorTokensEstimated = question.EvaluatorTokensEstimated || stats.Usage.Estimated
+	if price != nil {
+		question.EvaluatorCost += price.Cost(stats.Usage)
+	}
+}
+
+// Count tokens the question used without the time they took, for calls other than generating the SQL
+func (question *QuestionRecord) addUsage(usage TokenUsage, price *ModelPrice) {
+	question.PromptTokens += usage.PromptTokens
+	question.CompletionTokens += usage.CompletionTokens
+	question.TokensEstimated = question.TokensEstimated || usage.Estimated
+	if price != nil {
+		question.Cost += price.Cost(usage)
+	}
+}
+
+// The fraction of the tables the gold SQL uses that schema linking gave the generator, if it was linked
+func (question *QuestionRecord) SchemaLinkRecall() (recall float64, linked bool) {
+	if len(question.LinkedTables) == 0 {
+		return 0, false
+	}
+	return schemaLinkRecall(question.GoldTables, question.LinkedTables), true
+}
+
+// e.g. "Ollama/OpenAI : llama3 (glossary)"
+func (model *ModelRunRecord) Label() string {
+	label := model.Name + ServiceModelSeperator + model.Model
+	if model.Glossary {
+		label += " (glossary)"
+	}
+	return label
+}
+
+// The same model's run without the glossary, when it was run both ways
+func (pack *PackRunRecord) WithoutGlossary(model *ModelRunRecord) *ModelRunRecord {
+	if !model.Glossary {
+		return nil
+	}
+	for _, other := range pack.Models {
+		if !other.Glossary && other.Name == model.Name && other.Model == model.Model {
+			return other
+		}
+	}
+	return nil
+}
+
+// How many questions' last predicted query ended with the given outcome
+func (model *ModelRunRecord) OutcomeCount(outcome string) int {
+	count := 0
+	for _, question := range model.Questions {
+		if question.Outcome == outcome {
+			count++
+		}
+	}
+	return count
+}
+
+func (model *ModelRunRecord) CorrectCount() int {
+	correct := 0
+	for _, question := range model.Questions {
+		if question.Correct {
+			correct++
+		}
+	}
+	return correct
+}
+
+// How many of the questions with a label, e.g. a tag, were answered correctly
+type AccuracySlice struct {
+	Label     string
+	Correct   int
+	Questions int
+}
+
+// Accuracy for each label any question has, in the given order or else sorted
+func (model *ModelRunRecord) accuracyBy(labels func(question *QuestionRecord) []string, order []string) []AccuracySlice {
+	slices := make(map[string]*AccuracySlice)
+	for _, question := range model.Questions {
+		for _, label := range labels(question) {
+			slice, ok := slices[label]
+			if !ok {
+				slice = &AccuracySlice{Label: label}
+				slices[label] = slice
+			}
+			slice.Questions++
+			if question.Correct {
+				slice.Correct++
+			}
+		}
+	}
+	if order == nil {
+		order = sortedKeys(slices)
+	}
+	var accuracy []AccuracySlice
+	for _, label := range order {
+		if slice, ok := slices[label]; ok {
+			accuracy = append(accuracy, *slice)
+		}
+	}
+	return accuracy
+}
+
+func (model *ModelRunRecord) TagAccuracy() []AccuracySlice {
+	return model.accuracyBy(func(question *QuestionRecord) []string { return question.Tags }, nil)
+}
+
+// Easiest first; questions without a difficulty are left out
+func (model *ModelRunRecord) DifficultyAccuracy() []AccuracySlice {
+	return model.accuracyBy(func(question *QuestionRecord) []string {
+		if question.Difficulty == "" {
+			return nil
+		}
+		return []string{question.Difficulty}
+	}, []string{DifficultyEasy, DifficultyMedium, DifficultyHard})
+}
+
+// e.g. "easy 3/4, medium 1/2"
+func formatAccuracySlices(slices []AccuracySlice) string {
+	formatted := make([]string, len(slices))
+	for i, slice := range slices {
+		formatted[i] = fmt.Sprintf("%s %d/%d", slice.Label, slice.Correct, slice.Questions)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// How many questions' predicted queries used each construct the requested dialect doesn't have
+func (model *ModelRunRecord) DialectIssueCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, question := range model.Questions {
+		for _, construct := range question.DialectIssues {
+			counts[construct]++
+		}
+	}
+	return counts
+}
+
+// Total query plan cost of the model's queries and of the gold queries, over the questions both have a plan for
+func (model *ModelRunRecord) PlanCost() (predicted int, gold int, questions int) {
+	for _, question := range model.Questions {
+		if question.PredictedPlan != nil && question.GoldPlan != nil {
+			predicted += question.PredictedPlan.Cost
+			gold += question.GoldPlan.Cost
+			questions++
+		}
+	}
+	return predicted, gold, questions
+}
+
+// Mean time to first token and to generate each question's SQL, over the questions timed.
+// Runs from before they were timed have none.
+func (model *ModelRunRecord) Latency() (timeToFirstToken time.Duration, generation time.Duration, questions int) {
+	for _, question := range model.Questions {
+		if question.GenerationTime > 0 {
+			timeToFirstToken += question.TimeToFirstToken
+			generation += question.GenerationTime
+			questions++
+		}
+	}
+	if questions == 0 {
+		return 0, 0, 0
+	}
+	return timeToFirstToken / time.Duration(questions), generation / time.Duration(questions), questions
+}
+
+// Mean schema linking recall over the questions that were linked
+func (model *ModelRunRecord) SchemaLinkRecall() (recall float64, questions int) {
+	for _, question := range model.Questions {
+		if questionRecall, linked := question.SchemaLinkRecall(); linked {
+			recall += questionRecall
+			questions++
+		}
+	}
+	if questions == 0 {
+		return 0, 0
+	}
+	return recall / float64(questions), questions
+}
+
+// Tokens the model used over every question, and whether any were estimated
+func (model *ModelRunRecord) Tokens() TokenUsage {
+	var usage TokenUsage
+	for _, question := range model.Questions {
+		usage.Add(TokenUsage{PromptTokens: question.PromptTokens, CompletionTokens: question.CompletionTokens, Estimated: question.TokensEstimated})
+	}
+	return usage
+}
+
+// What the model cost over every question, and per correct answer (0 if none were), if its price is known
+func (model *ModelRunRecord) Cost() (cost float64, perCorrect float64, priced bool) {
+	if model.Price == nil {
+		return 0, 0, false
+	}
+	for _, question := range model.Questions {
+		cost += question.Cost
+	}
+	if correct := model.CorrectCount(); correct > 0 {
+		perCorrect = cost / float64(correct)
+	}
+	return cost, perCorrect, true
+}
+
+// Tokens the evaluator used judging the model's SQL
+func (model *ModelRunRecord) EvaluatorTokens() TokenUsage {
+	var usage TokenUsage
+	for _, question := range model.Questions {
+		usage.Add(TokenUsage{PromptTokens: question.EvaluatorPromptTokens, CompletionTokens: question.EvaluatorCompletionTokens, Estimated: question.EvaluatorTokensEstimated})
+	}
+	return usage
+}
+
+// What judging the model's SQL cost, if the evaluator's price is known
+func (model *ModelRunRecord) EvaluatorCost() (cost float64, priced bool) {
+	if model.EvaluatorPrice == nil {
+		return 0, false
+	}
+	for _, question := range model.Questions {
+		cost += question.EvaluatorCost
+	}
+	return cost, true
+}
+
+// Tokens, and cost where it's known, e.g. "12.3k tokens (10.1k prompt), $0.00370, $0.00123 per correct answer"
+func modelSpend(model *ModelRunRecord) string {
+	usage := model.Tokens()
+	if usage.Total() == 0 {
+		return ""
+	}
+	spend := fmt.Sprintf("%s tokens (%s prompt)", formatTokens(usage.Total()), formatTokens(usage.PromptTokens))
+	if usage.Estimated {
+		spend = "~" + spend
+	}
+	if cost, perCorrect, priced := model.Cost(); priced {
+		spend += ", " + formatCost(cost)
+		if model.CorrectCount() > 0 {
+			spend += fmt.Sprintf(", %s per correct answer", formatCost(perCorrect))
+		}
+	}
+	return spend
+}
+
+// What judging the model's SQL took, e.g. "evaluator 2.4k tokens, $0.00036"
+func evaluatorSpend(model *ModelRunRecord) string {
+	usage := model.EvaluatorTokens()
+	if usage.Total() == 0 {
+		return ""
+	}
+	tokens := formatTokens(usage.Total())
+	if usage.Estimated {
+		tokens = "~" + tokens
+	}
+	spend := fmt.Sprintf("evaluator %s tokens", tokens)
+	if cost, priced := model.EvaluatorCost(); priced {
+		spend += ", " + formatCost(cost)
+	}
+	return spend
+}
+
+func saveRunRecord(resultsDir string, record *RunRecord) (string, error) {
+	if err := os.MkdirAll(resultsDir, 0755); err != nil {
+		return "", err
+	}
+	filename := filepath.Join(resultsDir, fmt.Sprintf("run-%s.json", record.StartedAt.Format("20060102-150405")))
+	content, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return filename, os.WriteFile(filename, content, 0644)
+}
+
+func loadRunRecord(filename string) (*RunRecord, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var record RunRecord
+	if err := json.Unmarshal(content, &record); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return &record, nil
+}
+
+// The most recent run saved in a results directory. Runs are named by when they started so
+// that's the last by name.
+func latestRunRecordFile(resultsDir string) (string, error) {
+	runs, err := filepath.Glob(filepath.Join(resultsDir, "run-*.json"))
+	if err != nil {
+		return "", err
+	}
+	if len(runs) == 0 {
+		return "", fmt.Errorf("no runs saved in %s", resultsDir)
+	}
+	sort.Strings(runs)
+	return runs[len(runs)-1], nil
+}
+
+func printRunSummary(w io.Writer, record *RunRecord) {
+	for _, pack := range record.Packs {
+		if pack.Metric != "" {
+			fmt.Fprintf(w, "\n=== Pack: %s (%s)\n", pack.Pack, pack.Metric)
+		} else {
+			fmt.Fprintf(w, "\n=== Pack: %s\n", pack.Pack)
+		}
+		for _, model := range pack.Models {
+			fmt.Fprintf(w, "%-40s %d/%d correct", model.Label(), model.CorrectCount(), len(model.Questions))
+			if timeouts, truncated := model.OutcomeCount(QueryOutcomeTimeout), model.OutcomeCount(QueryOutcomeTruncated); timeouts > 0 || truncated > 0 {
+				fmt.Fprintf(w, " (%d timed out, %d truncated)", timeouts, truncated)
+			}
+			if predicted, gold, questions := model.PlanCost(); questions > 0 {
+				fmt.Fprintf(w, ", plan cost %d vs gold %d over %d", predicted, gold, questions)
+			}
+			if timeToFirstToken, generation, questions := model.Latency(); questions > 0 {
+				fmt.Fprintf(w, ", first token after %s, SQL in %s on average", timeToFirstToken.Round(time.Millisecond), generation.Round(time.Millisecond))
+			}
+			if recall, questions := model.SchemaLinkRecall(); questions > 0 {
+				fmt.Fprintf(w, ", schema linking recall %.0f%% over %d", 100*recall, questions)
+			}
+			fmt.Fprintln(w)
+			if spend := modelSpend(model); spend != "" {
+				fmt.Fprintf(w, "%-40s %s\n", "", spend)
+			}
+			if spend := evaluatorSpend(model); spend != "" {
+				fmt.Fprintf(w, "%-40s %s\n", "", spend)
+			}
+			if without := pack.WithoutGlossary(model); without != nil {
+				fmt.Fprintf(w, "%-40s %s\n", "", glossaryEffect(model, without))
+			}
+			if issues := modelDialectIssues(model); issues != "" {
+				fmt.Fprintf(w, "%-40s dialect issues: %s\n", "", issues)
+			}
+			if difficulties := model.DifficultyAccuracy(); len(difficulties) > 0 {
+				fmt.Fprintf(w, "%-40s by difficulty: %s\n", "", formatAccuracySlices(difficulties))
+			}
+			if tags := model.TagAccuracy(); len(tags) > 0 {
+				fmt.Fprintf(w, "%-40s by tag: %s\n", "", formatAccuracySlices(tags))
+			}
+		}
+	}
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// How the tables a question needs are picked from the schema
+const (
+	SchemaLinkingOff     = "off"     // the whole schema, always
+	SchemaLinkingLexical = "lexical" // by the question's words matching table and column names and values
+	SchemaLinkingModel   = "model"   // lexically, plus whatever tables the model says it needs
+)
+
+const DefaultSchemaLinking = SchemaLinkingLexical
+
+// Schemas this small are given whole, there being little to gain from linking them
+const SchemaLinkingMinTables = 4
+
+// Distinct text values sampled from each column for matching against questions
+const SchemaLinkingSampleValues = 20
+
+func validSchemaLinking(mode string) bool {
+	return mode == SchemaLinkingOff || mode == SchemaLinkingLexical || mode == SchemaLinkingModel
+}
+
+// A table as schema linking sees it
+type SchemaTable struct {
+	Name        string
+	Columns     []string
+	References  []string            // tables its foreign keys reference
+	Values      map[string][]string // sampled text values by column
+	TextColumns []TextColumn        // which value hints are indexed from
+}
+
+// A text column's values, read once for both schema linking and value hints
+type TextColumn struct {
+	Name     string
+	Distinct int      // distinct values of any type
+	Values   []string // up to ValueIndexMaxDistinct distinct text values short enough to be named in a question
+}
+
+// Picks the parts of a schema relevant to each question, so the generator isn't given (and
+// confused by) tables it doesn't need
+type SchemaLinker struct {
+	Mode   string
+	Schema string // as shown to the model, whole
+	Tables []SchemaTable
+}
+
+// The tables linked to a question, and the schema of just them
+type SchemaLink struct {
+	Tables []string // most relevant first, or none if the schema wasn't linked
+	Schema string
+	Stats  *GenerationStats // of asking the model, in SchemaLinkingModel mode
+}
+
+// A table's columns, and the values of the ones holding text
+func readTableColumns(db *sql.DB, table string) ([]string, []TextColumn, error) {
+	rows, err := db.Query(`SELECT name, type FROM pragma_table_info(?) ORDER BY cid`, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	var columns []string
+	var textColumns []TextColumn
+	for rows.Next() {
+		var column, columnType string
+		if err := rows.Scan(&column, &columnType); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		columns = append(columns, column)
+		if columnType == "" || strings.Contains(strings.ToUpper(columnType), "CHAR") || strings.Contains(strings.ToUpper(columnType), "TEXT") {
+			textColumns = append(textColumns, TextColumn{Name: column})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	for i := range textColumns {
+		column := &textColumns[i]
+		if err := db.QueryRow(fmt.Sprintf(`SELECT COUNT(DISTINCT %s) FROM %s`, quoteSqlIdentifier(column.Name), quoteSqlIdentifier(table))).Scan(&column.Distinct); err != nil {
+			return nil, nil, err
+		}
+		if column.Values, err = sampleColumnValues(db, table, column.Name, ValueIndexMaxDistinct); err != nil {
+			return nil, nil, err
+		}
+	}
+	return columns, textColumns, nil
+}
+
+// Read the tables, their columns, foreign keys and some of their values from a database
+func loadSchemaTables(db *sql.DB) ([]SchemaTable, error) {
+	names, err := listTables(context.Background(), db)
+	if err != nil {
+		return nil, err
+	}
+	var tables []SchemaTable
+	for _, name := range names {
+		table := SchemaTable{Name: name, Values: make(map[string][]string)}
+		if table.Columns, table.TextColumns, err = readTableColumns(db, name); err != nil {
+			return nil, err
+		}
+
+		rows, err := db.Query(`SELECT DISTINCT "table" FROM pragma_foreign_key_list(?)`, name)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var referenced string
+			if err := rows.Scan(&referenced); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			table.References = append(table.References, referenced)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		// values too short to tell apart from ordinary words aren't matched
+		for _, column := range table.TextColumns {
+			var values []string
+			for _, value := range column.Values {
+				if len(value) >= 3 && len(values) < SchemaLinkingSampleValues {
+					values = append(values, value)
+				}
+			}
+			table.Values[column.Name] = values
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+func quoteSqlIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Up to limit of a column's distinct text values, leaving out any too long to be named in a question
+func sampleColumnValues(db *sql.DB, table string, column string, limit int) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf(`SELECT DISTINCT %[1]s FROM %[2]s WHERE typeof(%[1]s) = 'text' AND length(%[1]s) BETWEEN 1 AND 50 LIMIT ?`,
+		quoteSqlIdentifier(column), quoteSqlIdentifier(table)), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// tables are from loadSchemaTables, and only needed if the schema's linked
+func newSchemaLinker(tables []SchemaTable, schema string, mode string) *SchemaLinker {
+	linker := &SchemaLinker{Mode: mode, Schema: schema}
+	if mode != SchemaLinkingOff {
+		linker.Tables = tables
+	}
+	return linker
+}
+
+// Lower case words, with plurals made singular so "orders" matches Orders and "categories" Category
+func linkingWords(text string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		words = append(words, singular(strings.ToLower(word)))
+	}
+	return words
+}
+
+func singular(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ies"):
+		return strings.TrimSuffix(word, "ies") + "y"
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us"):
+		return strings.TrimSuffix(word, "s")
+	}
+	return word
+}
+
+// The words of an identifier, split at underscores and changes of case: OrderProducts and
+// order_products are both order and product
+func identifierWords(name string) []string {
+	var split strings.Builder
+	previous := ' '
+	for _, r := range name {
+		if unicode.IsUpper(r) && unicode.IsLower(previous) {
+			split.WriteRune(' ')
+		}
+		split.WriteRune(r)
+		previous = r
+	}
+	return linkingWords(split.String())
+}
+
+// Words too common in names to say anything about which table a question's about
+var linkingStopWords = map[string]bool{"id": true, "name": true, "the": true, "of": true, "a": true}
+
+// How relevant a table is to a question and why
+type rankedTable struct {
+	Name    string
+	Score   int
+	Matches []string // e.g. "table name", "column status", "value Orders.status 'shipped'"
+}
+
+// Rank tables by how much of the question names them: their names score 3 whole or 1 a word,
+// their columns' names 1 each and their values 2 each. Tables the question doesn't mention at all
+// are left out.
+func rankSchemaTables(tables []SchemaTable, question string) []rankedTable {
+	questionWords := make(map[string]bool)
+	for _, word := range linkingWords(question) {
+		questionWords[word] = true
+	}
+	matchesAll := func(words []string) bool {
+		matched := false
+		for _, word := range words {
+			if linkingStopWords[word] {
+				continue
+			}
+			if !questionWords[word] {
+				return false
+			}
+			matched = true
+		}
+		return matched
+	}
+	// values are matched as whole words of the question, e.g. 'Product 7' but not 'Product 70'
+	normalisedQuestion := " " + strings.Join(linkingWords(question), " ") + " "
+
+	var ranked []rankedTable
+	for _, table := range tables {
+		rank := rankedTable{Name: table.Name}
+		if tableWords := identifierWords(table.Name); matchesAll(tableWords) {
+			rank.Score += 3
+			rank.Matches = append(rank.Matches, "table name")
+		} else {
+			for _, word := range tableWords {
+				if !linkingStopWords[word] && questionWords[word] {
+					rank.Score++
+					rank.Matches = append(rank.Matches, "table name word "+word)
+				}
+			}
+		}
+		for _, column := range table.Columns {
+			if matchesAll(identifierWords(column)) {
+				rank.Score++
+				rank.Matches = append(rank.Matches, "column "+column)
+			}
+			for _, value := range table.Values[column] {
+				if words := linkingWords(value); len(words) > 0 && strings.Contains(normalisedQuestion, " "+strings.Join(words, " ")+" ") {
+					rank.Score += 2
+					rank.Matches = append(rank.Matches, fmt.Sprintf("value %s.%s '%s'", table.Name, column, value))
+				}
+			}
+		}
+		if rank.Score > 0 {
+			ranked = append(ranked, rank)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+	return ranked
+}
+
+// Add the tables needed to join those selected: any they reference, like an order's customer,
+// and any referencing two or more of them, like the table between orders and products
+func expandSchemaLink(tables []SchemaTable, selected []string) []string {
+	isSelected := make(map[string]bool)
+	for _, name := range selected {
+		isSelected[strings.ToLower(name)] = true
+	}
+	expanded := append([]string{}, selected...)
+	add := func(name string) {
+		if !isSelected[strings.ToLower(name)] {
+			isSelected[strings.ToLower(name)] = true
+			expanded = append(expanded, name)
+		}
+	}
+	for _, table := range tables {
+		if !isSelected[strings.ToLower(table.Name)] {
+			continue
+		}
+		for _, referenced := range table.References {
+			for _, other := range tables {
+				if strings.EqualFold(other.Name, referenced) {
+					add(other.Name)
+				}
+			}
+		}
+	}
+	for _, table := range tables {
+		links := 0
+		for _, referenced := range table.References {
+			if isSelected[strings.ToLower(referenced)] {
+				links++
+			}
+		}
+		if links >= 2 {
+			add(table.Name)
+		}
+	}
+	return expanded
+}
+
+const SchemaLinkingPrompt = `
+	List the tables below that are needed to write a SQL query answering the question.
+	Respond with only the table names, one per line, and nothing else.\n`
+
+// Ask the model which tables a question needs, from their names and columns
+func linkSchemaWithModel(ctx context.Context, llm llms.Model, tables []SchemaTable, question string, maxTokens int, seed int) ([]string, *GenerationStats, error) {
+	var prompt strings.Builder
+	prompt.WriteString(SchemaLinkingPrompt)
+	for _, table := range tables {
+		fmt.Fprintf(&prompt, "%s(%s)\n", table.Name, strings.Join(table.Columns, ", "))
+	}
+	fmt.Fprintf(&prompt, "\nQuestion: %s\n", question)
+	options := []llms.CallOption{llms.WithMaxTokens(maxTokens), llms.WithTemperature(0.0)}
+	if seed != NoSeed {
+		options = append(options, llms.WithSeed(seed))
+	}
+	response, stats, err := generateStreaming(ctx, llm, prompt.String(), Streaming{}, nil, options...)
+	fmt.Printf("- Schema linking generation execution time: %s\n", stats)
+	if err != nil {
+		return nil, stats, err
+	}
+	var named []string
+	for _, table := range tables {
+		for _, token := range tokeniseSql(response) {
+			if strings.EqualFold(unquoteSqlIdentifier(token), table.Name) {
+				named = append(named, table.Name)
+				break
+			}
+		}
+	}
+	return named, stats, nil
+}
+
+// Link a question to the tables it needs. Small schemas, or questions that don't mention any
+// table, get the whole schema. llm is only used in SchemaLinkingModel mode, and what it used is
+// in the link's Stats.
+func (linker *SchemaLinker) Link(ctx context.Context, llm llms.Model, question string, maxTokens int, seed int) (*SchemaLink, error) {
+	if linker.Mode == SchemaLinkingOff || len(linker.Tables) <= SchemaLinkingMinTables {
+		return &SchemaLink{Schema: linker.Schema}, nil
+	}
+	var selected []string
+	var stats *GenerationStats
+	for _, rank := range rankSchemaTables(linker.Tables, question) {
+		fmt.Printf("- Schema linking: %s scored %d for %s\n", rank.Name, rank.Score, strings.Join(rank.Matches, ", "))
+		selected = append(selected, rank.Name)
+	}
+	if linker.Mode == SchemaLinkingModel {
+		var named []string
+		var err error
+		named, stats, err = linkSchemaWithModel(ctx, llm, linker.Tables, question, maxTokens, seed)
+		if err != nil {
+			return &SchemaLink{Stats: stats}, err
+		}
+		fmt.Printf("- Schema linking: model named %s\n", strings.Join(named, ", "))
+		for _, name := range named {
+			if !containsFold(selected, name) {
+				selected = append(selected, name)
+			}
+		}
+	}
+	if len(selected) == 0 {
+		// no tables, as nothing was linked, so it doesn't count towards recall
+		fmt.Printf("- Schema linking: no tables matched, using them all\n")
+		return &SchemaLink{Schema: linker.Schema, Stats: stats}, nil
+	}
+	link := &SchemaLink{Tables: expandSchemaLink(linker.Tables, selected), Stats: stats}
+	link.Schema = schemaOfTables(linker.Schema, link.Tables)
+	fmt.Printf("- Schema linking: %d of %d tables: %s\n", len(link.Tables), len(linker.Tables), strings.Join(link.Tables, ", "))
+	return link, nil
+}
+
+func containsFold(names []string, name string) bool {
+	for _, other := range names {
+		if strings.EqualFold(other, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func unquoteSqlIdentifier(token sqlToken) string {
+	if token.Kind != sqlQuotedIdentifier || len(token.Text) < 2 {
+		return token.Text
+	}
+	unquoted := token.Text[1 : len(token.Text)-1]
+	if token.Text[0] == '"' {
+		unquoted = strings.ReplaceAll(unquoted, `""`, `"`)
+	}
+	return unquoted
+}
+
+// The table a CREATE TABLE, VIEW, INDEX or TRIGGER statement is about, or "" for any other statement
+func schemaStatementTable(statement string) string {
+	tokens := tokeniseSql(statement)
+	i := nextSqlToken(tokens, -1)
+	if i >= len(tokens) || !tokens[i].is("CREATE") {
+		return ""
+	}
+	for ; i < len(tokens); i = nextSqlToken(tokens, i) {
+		switch {
+		case tokens[i].is("TABLE") || tokens[i].is("VIEW"):
+			i = nextSqlToken(tokens, i)
+			if i < len(tokens) && tokens[i].is("IF") {
+				i = nextSqlToken(tokens, nextSqlToken(tokens, nextSqlToken(tokens, i)))
+			}
+		case tokens[i].is("ON"):
+			i = nextSqlToken(tokens, i)
+		case tokens[i].Kind == sqlPunct:
+			return ""
+		default:
+			continue
+		}
+		// schema.table is just table
+		if next := nextSqlToken(tokens, i); next < len(tokens) && tokens[next].Text == "." {
+			i = nextSqlToken(tokens, next)
+		}
+		if i < len(tokens) {
+			return unquoteSqlIdentifier(tokens[i])
+		}
+		return ""
+	}
+	return ""
+}
+
+// A schema with only the statements about the tables given
+func schemaOfTables(schema string, tables []string) string {
+	var statements []string
+	for _, statement := range splitSqlStatements(schema) {
+		if table := schemaStatementTable(statement.Sql); table == "" || containsFold(tables, table) {
+			statements = append(statements, statement.Sql)
+		}
+	}
+	return strings.Join(statements, "\n") + "\n"
+}
+
+// The tables a query refers to, going by the words in it that are table names
+func sqlTablesReferenced(sqlQuery string, tables []SchemaTable) []string {
+	var referenced []string
+	for _, token := range tokeniseSql(sqlQuery) {
+		if token.Kind != sqlWord && token.Kind != sqlQuotedIdentifier {
+			continue
+		}
+		name := unquoteSqlIdentifier(token)
+		for _, table := range tables {
+			if strings.EqualFold(table.Name, name) && !containsFold(referenced, table.Name) {
+				referenced = append(referenced, table.Name)
+			}
+		}
+	}
+	return referenced
+}
+
+// The tables of whichever gold SQL, the main one or an alternative, the link covers best, as a
+// correct answer only needs the tables of one of them
+func bestGoldTables(goldSql []string, tables []SchemaTable, linked []string) []string {
+	var best []string
+	bestRecall := -1.0
+	for _, sql := range goldSql {
+		gold := sqlTablesReferenced(sql, tables)
+		if recall := schemaLinkRecall(gold, linked); recall > bestRecall {
+			best, bestRecall = gold, recall
+		}
+	}
+	return best
+}
+
+// The fraction of the tables the gold SQL uses that were linked
+func schemaLinkRecall(gold []string, linked []string) float64 {
+	if len(gold) == 0 {
+		return 1
+	}
+	found := 0
+	for _, table := range gold {
+		if containsFold(linked, table) {
+			found++
+		}
+	}
+	return float64(found) / float64(len(gold))
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const schemaLinkTestSchema = `CREATE TABLE Customers (id INTEGER PRIMARY KEY, name TEXT NOT NULL, email TEXT);
+CREATE TABLE Orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES Customers(id), shipping_status TEXT);
+CREATE INDEX idx_orders_customer ON Orders(customer_id);
+CREATE TABLE Products (id INTEGER PRIMARY KEY, name TEXT NOT NULL, price REAL);
+CREATE TABLE Order_Products (order_id INTEGER REFERENCES Orders(id), product_id INTEGER REFERENCES Products(id), quantity INTEGER);
+CREATE TABLE Suppliers (id INTEGER PRIMARY KEY, company TEXT);
+CREATE TABLE "Product Categories" (id INTEGER PRIMARY KEY, title TEXT);
+`
+
+func openSchemaLinkTestDb(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(schemaLinkTestSchema + `
+INSERT INTO Customers (name, email) VALUES ('Ada Lovelace', 'ada@example.com');
+INSERT INTO Orders (customer_id, shipping_status) VALUES (1, 'pending'), (1, 'shipped');
+INSERT INTO Products (name, price) VALUES ('Product 7', 9.99), ('Product 70', 1.5);
+INSERT INTO Suppliers (company) VALUES ('Acme');`)
+	assert.NoError(t, err)
+	return db
+}
+
+func TestRankSchemaTables(t *testing.T) {
+	db := openSchemaLinkTestDb(t)
+	defer db.Close()
+	tables, err := loadSchemaTables(db)
+	assert.NoError(t, err)
+	assert.Len(t, tables, 6)
+	var orders SchemaTable
+	for _, table := range tables {
+		if table.Name == "Orders" {
+			orders = table
+		}
+	}
+	assert.Equal(t, []string{"id", "customer_id", "shipping_status"}, orders.Columns)
+	assert.Equal(t, []string{"Customers"}, orders.References)
+	assert.Equal(t, []string{"pending", "shipped"}, orders.Values["shipping_status"])
+	// which value hints are indexed from, short values and all
+	assert.Equal(t, []TextColumn{{Name: "shipping_status", Distinct: 2, Values: []string{"pending", "shipped"}}}, orders.TextColumns)
+
+	ranked := rankSchemaTables(tables, "How many orders have shipped?")
+	assert.Equal(t, "Orders", ranked[0].Name)
+	assert.Equal(t, 5, ranked[0].Score)
+	assert.Equal(t, []string{"table name", "value Orders.shipping_status 'shipped'"}, ranked[0].Matches)
+	assert.Len(t, ranked, 2) // and Order_Products, for the word order
+
+	// values match whole words, and plurals and names split at underscores and spaces match too
+	ranked = rankSchemaTables(tables, "What does Product 7 cost in each of the product categories?")
+	names := []string{}
+	for _, rank := range ranked {
+		names = append(names, rank.Name)
+	}
+	assert.Equal(t, []string{"Products", "Product Categories", "Order_Products"}, names)
+	assert.Equal(t, []string{"table name", "value Products.name 'Product 7'"}, ranked[0].Matches)
+
+	assert.Empty(t, rankSchemaTables(tables, "What's the weather like?"))
+}
+
+func TestExpandSchemaLink(t *testing.T) {
+	tables := []SchemaTable{
+		{Name: "Customers"},
+		{Name: "Orders", References: []string{"Customers"}},
+		{Name: "Products"},
+		{Name: "Order_Products", References: []string{"Orders", "Products"}},
+		{Name: "Suppliers"},
+	}
+	// what's referenced, and what joins two of them
+	assert.Equal(t, []string{"Orders", "Customers"}, expandSchemaLink(tables, []string{"Orders"}))
+	assert.Equal(t, []string{"Products", "Orders", "Customers", "Order_Products"}, expandSchemaLink(tables, []string{"Products", "Orders"}))
+	assert.Equal(t, []string{"Products"}, expandSchemaLink(tables, []string{"Products"}))
+}
+
+func TestSchemaLinkerLink(t *testing.T) {
+	db := openSchemaLinkTestDb(t)
+	defer db.Close()
+	tables, err := loadSchemaTables(db)
+	assert.NoError(t, err)
+	linker := newSchemaLinker(tables, schemaLinkTestSchema, SchemaLinkingLexical)
+
+	link, err := linker.Link(context.Background(), nil, "How many orders have shipped?", 100, NoSeed)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Orders", "Order_Products", "Products", "Customers"}, link.Tables)
+	assert.Equal(t, `CREATE TABLE Customers (id INTEGER PRIMARY KEY, name TEXT NOT NULL, email TEXT);
+CREATE TABLE Orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES Customers(id), shipping_status TEXT);
+CREATE INDEX idx_orders_customer ON Orders(customer_id);
+CREATE TABLE Products (id INTEGER PRIMARY KEY, name TEXT NOT NULL, price REAL);
+CREATE TABLE Order_Products (order_id INTEGER REFERENCES Orders(id), product_id INTEGER REFERENCES Products(id), quantity INTEGER);
+`, link.Schema)
+
+	// nothing matched, so nothing's left out, and nothing counts as linked
+	link, err = linker.Link(context.Background(), nil, "What's the weather like?", 100, NoSeed)
+	assert.NoError(t, err)
+	assert.Empty(t, link.Tables)
+	assert.Equal(t, schemaLinkTestSchema, link.Schema)
+
+	// the model can add tables the question's words didn't find
+	model := &scriptedModel{responses: []string{"Suppliers\nNot a table"}}
+	linker.Mode = SchemaLinkingModel
+	link, err = linker.Link(context.Background(), model, "Who supplies us?", 100, 42)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Suppliers"}, link.Tables)
+	assert.Contains(t, model.prompts[0], "Suppliers(id, company)\n")
+	assert.Equal(t, []int{42}, model.seeds)
+	// and what it used counts towards the question's tokens
+	assert.NotNil(t, link.Stats)
+	assert.Greater(t, link.Stats.Usage.PromptTokens, 0)
+	record := &QuestionRecord{}
+	record.addUsage(link.Stats.Usage, &ModelPrice{InputPerMillion: 1_000_000})
+	assert.Equal(t, link.Stats.Usage.PromptTokens, record.PromptTokens)
+	assert.Equal(t, float64(link.Stats.Usage.PromptTokens), record.Cost)
+	assert.Zero(t, record.GenerationTime)
+
+	// small schemas and linking turned off aren't linked
+	linker.Mode = SchemaLinkingOff
+	link, err = linker.Link(context.Background(), nil, "How many orders have shipped?", 100, NoSeed)
+	assert.NoError(t, err)
+	assert.Empty(t, link.Tables)
+	linker = &SchemaLinker{Mode: SchemaLinkingLexical, Schema: schemaLinkTestSchema, Tables: linker.Tables[:4]}
+	link, err = linker.Link(context.Background(), nil, "How many orders have shipped?", 100, NoSeed)
+	assert.NoError(t, err)
+	assert.Empty(t, link.Tables)
+	assert.Equal(t, schemaLinkTestSchema, link.Schema)
+}
+
+func TestSchemaStatementTable(t *testing.T) {
+	assert.Equal(t, "Orders", schemaStatementTable("CREATE TABLE IF NOT EXISTS main.Orders (id INTEGER)"))
+	assert.Equal(t, "Product Categories", schemaStatementTable(`create table "Product Categories" (id INTEGER)`))
+	assert.Equal(t, "Orders", schemaStatementTable("CREATE UNIQUE INDEX idx ON Orders(id)"))
+	assert.Equal(t, "Orders", schemaStatementTable("CREATE TRIGGER t AFTER INSERT ON Orders BEGIN SELECT 1; END"))
+	assert.Equal(t, "", schemaStatementTable("INSERT INTO Orders VALUES (1)"))
+}
+
+func TestSchemaLinkRecall(t *testing.T) {
+	tables := []SchemaTable{{Name: "Orders"}, {Name: "Products"}, {Name: "Order_Products"}, {Name: "Customers"}}
+	gold := sqlTablesReferenced(`SELECT p."name", SUM(op."quantity") FROM "Order_Products" op JOIN products p ON op.product_id = p.id`, tables)
+	assert.Equal(t, []string{"Order_Products", "Products"}, gold)
+	assert.Equal(t, 0.5, schemaLinkRecall(gold, []string{"Products", "Orders"}))
+	assert.Equal(t, 1.0, schemaLinkRecall(gold, []string{"products", "order_products"}))
+	assert.Equal(t, 1.0, schemaLinkRecall(nil, []string{"Orders"}))
+	// an alternative that needs fewer tables is just as correct
+	alternative := `SELECT SUM(quantity) FROM Order_Products`
+	assert.Equal(t, []string{"Order_Products"}, bestGoldTables([]string{`SELECT p.name FROM Order_Products op JOIN Products p ON op.product_id = p.id`, alternative}, tables, []string{"Order_Products"}))
+	assert.Equal(t, gold, bestGoldTables([]string{`SELECT p.name FROM Order_Products op JOIN Products p ON op.product_id = p.id`, alternative}, tables, []string{"Order_Products", "Products"}))
+
+	model := &ModelRunRecord{Questions: []*QuestionRecord{
+		{LinkedTables: []string{"Products"}, GoldTables: gold},
+		{LinkedTables: []string{"Products", "Order_Products"}, GoldTables: gold},
+		{},
+	}}
+	recall, questions := model.SchemaLinkRecall()
+	assert.Equal(t, 0.75, recall)
+	assert.Equal(t, 2, questions)
+}
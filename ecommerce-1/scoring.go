@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Which of a ground truth item's acceptable answers a prediction matched, if any
+type GroundTruthMatch struct {
+	Correct bool
+	Variant string // "sql", "alternative_sql[n]", "expected_columns" or "acceptable_results[n]"
+}
+
+func normaliseSqlForComparison(sqlQuery string) string {
+	return strings.TrimSuffix(standardizeSpaces(sqlQuery), ";")
+}
+
+// Decode a JSON result (in either format) into its rows as strings that can be compared,
+// with the column order within a row normalised
+func canonicalResultRows(result string) ([]string, error) {
+	resultSet, err := parseResultSet(result)
+	if err != nil {
+		return nil, err
+	}
+	return resultSet.canonicalRows(), nil
+}
+
+// Results match if they contain the same rows; unless the question is order sensitive the
+// rows can come back in any order.
+func resultsMatch(expected, actual string, orderSensitive bool) bool {
+	if expected == actual {
+		return true
+	}
+	expectedRows, err := canonicalResultRows(expected)
+	if err != nil {
+		return false
+	}
+	actualRows, err := canonicalResultRows(actual)
+	if err != nil {
+		return false
+	}
+	if !orderSensitive {
+		sort.Strings(expectedRows)
+		sort.Strings(actualRows)
+	}
+	return reflect.DeepEqual(expectedRows, actualRows)
+}
+
+// Whether the predicted result is the gold result's expected columns, whatever it calls them:
+// it has to have just that many columns and the same values in each row
+func expectedColumnsMatch(goldResult, predictedResult string, expectedColumns []string, orderSensitive bool) bool {
+	gold, err := parseResultSet(goldResult)
+	if err != nil {
+		return false
+	}
+	gold, err = gold.project(expectedColumns)
+	if err != nil {
+		return false
+	}
+	predicted, err := parseResultSet(predictedResult)
+	if err != nil || len(predicted.Columns) != len(expectedColumns) {
+		return false
+	}
+	goldRows, predictedRows := gold.canonicalValueRows(), predicted.canonicalValueRows()
+	if !orderSensitive {
+		sort.Strings(goldRows)
+		sort.Strings(predictedRows)
+	}
+	return reflect.DeepEqual(goldRows, predictedRows)
+}
+
+// Score a prediction against every acceptable answer for a question: the gold SQL and its
+// alternatives (textually, then by result) and any additional acceptable results.
+// Alternative SQL doesn't have a stored result so it's executed against db to get one, as is
+// the gold SQL when its result hasn't been stored yet.
+// With expected columns a result with just those columns of the gold result matches too.
+func scorePrediction(db *sql.DB, item GroundTruthItem, predictedSqlQuery string, predictedResult string) GroundTruthMatch {
+	goldSqlQueries := append([]string{item.SQL}, item.AlternativeSQL...)
+	for i, goldSqlQuery := range goldSqlQueries {
+		if normaliseSqlForComparison(goldSqlQuery) == normaliseSqlForComparison(predictedSqlQuery) {
+			return GroundTruthMatch{Correct: true, Variant: sqlVariantName(i)}
+		}
+	}
+
+	goldResult := item.Result
+	if goldResult == "" {
+		var err error
+		if goldResult, err = executeGroundTruthSql(db, item.SQL); err != nil {
+			fmt.Printf("- Gold SQL failed, and has no stored result (see dataset regenerate): %v\n", err)
+		}
+	}
+	if goldResult != "" && resultsMatch(goldResult, predictedResult, item.OrderSensitive) {
+		return GroundTruthMatch{Correct: true, Variant: sqlVariantName(0)}
+	}
+	if goldResult != "" && len(item.ExpectedColumns) > 0 && expectedColumnsMatch(goldResult, predictedResult, item.ExpectedColumns, item.OrderSensitive) {
+		return GroundTruthMatch{Correct: true, Variant: "expected_columns"}
+	}
+	for i, alternativeSql := range item.AlternativeSQL {
+		alternativeResult, err := executeGroundTruthSql(db, alternativeSql)
+		if err != nil {
+			fmt.Printf("- Alternative gold SQL %d failed: %v\n", i+1, err)
+			continue
+		}
+		if resultsMatch(alternativeResult, predictedResult, item.OrderSensitive) {
+			return GroundTruthMatch{Correct: true, Variant: sqlVariantName(i + 1)}
+		}
+	}
+	for i, acceptableResult := range item.AcceptableResults {
+		if resultsMatch(acceptableResult, predictedResult, item.OrderSensitive) {
+			return GroundTruthMatch{Correct: true, Variant: fmt.Sprintf("acceptable_results[%d]", i)}
+		}
+	}
+	return GroundTruthMatch{Correct: false}
+}
+
+// 0 is the primary gold SQL, anything after that is an alternative
+func sqlVariantName(index int) string {
+	if index == 0 {
+		return "sql"
+	}
+	return fmt.Sprintf("alternative_sql[%d]", index-1)
+}
+
+// Metrics a dataset pack can be scored with. The default matches against every acceptable
+// answer in the ground truth; the others reproduce the official execution accuracy (EX) of
+// the benchmarks packs are imported from, so numbers are comparable with published ones.
+const (
+	MetricSpiderExecutionAccuracy = "spider-execution-accuracy"
+	MetricBirdExecutionAccuracy   = "bird-execution-accuracy"
+)
+
+func validMetric(metric string) bool {
+	return metric == "" || metric == MetricSpiderExecutionAccuracy || metric == MetricBirdExecutionAccuracy
+}
+
+// Score a prediction with whichever metric its pack uses. Execution accuracy runs the predicted
+// SQL again, within limits.
+func scorePredictionWithMetric(db *sql.DB, metric string, item GroundTruthItem, predictedSqlQuery string, predictedResult string, limits QueryLimits) GroundTruthMatch {
+	switch metric {
+	case MetricSpiderExecutionAccuracy, MetricBirdExecutionAccuracy:
+		correct, err := executionAccuracyMatch(db, metric, item.SQL, predictedSqlQuery, limits)
+		if err != nil {
+			fmt.Printf("- Execution accuracy failed: %v\n", err)
+		}
+		if correct {
+			return GroundTruthMatch{Correct: true, Variant: sqlVariantName(0)}
+		}
+		return GroundTruthMatch{Correct: false}
+	default:
+		return scorePrediction(db, item, predictedSqlQuery, predictedResult)
+	}
+}
+
+// Run a query and return its rows as values in column order. Each value is tagged with its
+// kind so 1 and '1' differ, but integral floats are treated as integers as Python does.
+// Going over the row limit is an error as a partial result can't be compared.
+func queryResultValues(db *sql.DB, sqlQuery string, limits QueryLimits) ([][]string, error) {
+	ctx, cancel := queryContext(context.Background(), limits)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, stripNewlines(sqlQuery))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result, truncated, err := readResultSet(rows, limits.MaxRows, 0)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w after %s", ErrQueryTimeout, limits.Timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if truncated {
+		return nil, fmt.Errorf("more than %d rows", limits.MaxRows)
+	}
+
+	values := make([][]string, len(result.Rows))
+	for i, resultRow := range result.Rows {
+		row := make([]string, len(resultRow))
+		for j, value := range resultRow {
+			switch v := value.(type) {
+			case nil:
+				row[j] = "null"
+			case []byte:
+				row[j] = "s:" + string(v)
+			case string:
+				row[j] = "s:" + v
+			case int64:
+				row[j] = fmt.Sprintf("n:%d", v)
+			case float64:
+				if v == float64(int64(v)) {
+					row[j] = fmt.Sprintf("n:%d", int64(v))
+				} else {
+					row[j] = fmt.Sprintf("n:%v", v)
+				}
+			default:
+				row[j] = fmt.Sprintf("%T:%v", v, v)
+			}
+		}
+		values[i] = row
+	}
+	return values, nil
+}
+
+// Execute the gold and predicted SQL and compare their results the way the benchmark's own
+// evaluation script does. Column names never matter, only values. Only the predicted SQL is limited.
+func executionAccuracyMatch(db *sql.DB, metric string, goldSqlQuery string, predictedSqlQuery string, limits QueryLimits) (bool, error) {
+	gold, err := queryResultValues(db, goldSqlQuery, QueryLimits{})
+	if err != nil {
+		return false, fmt.Errorf("gold SQL: %v", err)
+	}
+	predicted, err := queryResultValues(db, predictedSqlQuery, limits)
+	if err != nil {
+		return false, err
+	}
+	if metric == MetricBirdExecutionAccuracy {
+		return birdResultsMatch(gold, predicted), nil
+	}
+	return spiderResultsMatch(gold, predicted, orderingKeyword.MatchString(goldSqlQuery)), nil
+}
+
+// BIRD compares the sets of result rows: order and duplicates don't matter but column order does
+func birdResultsMatch(gold, predicted [][]string) bool {
+	rowSet := func(rows [][]string) map[string]bool {
+		set := make(map[string]bool)
+		for _, row := range rows {
+			set[strings.Join(row, "\x00")] = true
+		}
+		return set
+	}
+	return reflect.DeepEqual(rowSet(gold), rowSet(predicted))
+}
+
+// Spider compares results as multisets of rows, in order only if the gold SQL has an ORDER BY,
+// and accepts the predicted columns in any order as long as some permutation matches.
+func spiderResultsMatch(gold, predicted [][]string, orderMatters bool) bool {
+	if len(gold) != len(predicted) {
+		return false
+	}
+	if len(gold) == 0 {
+		return true
+	}
+	width := len(gold[0])
+	if len(predicted[0]) != width {
+		return false
+	}
+
+	// a column can only map onto a gold column holding the same values
+	columnValues := func(rows [][]string, column int) string {
+		values := make([]string, len(rows))
+		for i, row := range rows {
+			values[i] = row[column]
+		}
+		sort.Strings(values)
+		return strings.Join(values, "\x00")
+	}
+	goldColumns := make([]string, width)
+	predictedColumns := make([]string, width)
+	for i := 0; i < width; i++ {
+		goldColumns[i] = columnValues(gold, i)
+		predictedColumns[i] = columnValues(predicted, i)
+	}
+
+	rowKeys := func(rows [][]string, permutation []int) []string {
+		keys := make([]string, len(rows))
+		for i, row := range rows {
+			permuted := make([]string, width)
+			for j, column := range permutation {
+				permuted[j] = row[column]
+			}
+			keys[i] = strings.Join(permuted, "\x00")
+		}
+		if !orderMatters {
+			sort.Strings(keys)
+		}
+		return keys
+	}
+	identity := make([]int, width)
+	for i := range identity {
+		identity[i] = i
+	}
+	goldKeys := rowKeys(gold, identity)
+
+	// permutation[j] is the predicted column standing in for gold column j
+	permutation := make([]int, width)
+	used := make([]bool, width)
+	var search func(column int) bool
+	search = func(column int) bool {
+		if column == width {
+			return reflect.DeepEqual(goldKeys, rowKeys(predicted, permutation))
+		}
+		for candidate := 0; candidate < width; candidate++ {
+			if used[candidate] || predictedColumns[candidate] != goldColumns[column] {
+				continue
+			}
+			used[candidate] = true
+			permutation[column] = candidate
+			if search(column + 1) {
+				return true
+			}
+			used[candidate] = false
+		}
+		return false
+	}
+	return search(0)
+}
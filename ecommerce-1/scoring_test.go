@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultsMatch(t *testing.T) {
+	assert.True(t, resultsMatch(`[{"COUNT(*)":10}]`, `[{"COUNT(*)":10}]`, false))
+	assert.True(t, resultsMatch(`[{"profit":8100,"name":"Product 7"}]`, `[{"name":"Product 7","profit":8100}]`, false))
+	assert.True(t, resultsMatch(`[{"name":"a"},{"name":"b"}]`, `[{"name":"b"},{"name":"a"}]`, false))
+	assert.False(t, resultsMatch(`[{"name":"a"},{"name":"b"}]`, `[{"name":"b"},{"name":"a"}]`, true))
+	assert.False(t, resultsMatch(`[{"name":"a"}]`, `[{"name":"a"},{"name":"a"}]`, false))
+	assert.False(t, resultsMatch(`[{"COUNT(*)":10}]`, `not json`, false))
+}
+
+func TestScorePrediction(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE Products (id INTEGER PRIMARY KEY, name TEXT, price REAL); INSERT INTO Products (name, price) VALUES ('Product 1', 100), ('Product 2', 200);`)
+	assert.NoError(t, err)
+
+	item := GroundTruthItem{
+		SQL:               `SELECT * FROM Products ORDER BY price DESC LIMIT 1;`,
+		AlternativeSQL:    []string{`SELECT name FROM Products ORDER BY price DESC LIMIT 1;`},
+		Result:            `[{"id":2,"name":"Product 2","price":200}]`,
+		AcceptableResults: []string{`[{"price":200}]`},
+	}
+
+	match := scorePrediction(db, item, "SELECT *  FROM Products ORDER BY price DESC LIMIT 1", "")
+	assert.Equal(t, GroundTruthMatch{Correct: true, Variant: "sql"}, match)
+
+	match = scorePrediction(db, item, "SELECT id, name, price FROM Products WHERE id = 2", `[{"id":2,"name":"Product 2","price":200}]`)
+	assert.Equal(t, GroundTruthMatch{Correct: true, Variant: "sql"}, match)
+
+	match = scorePrediction(db, item, "SELECT name FROM Products WHERE price > 150", `[{"name":"Product 2"}]`)
+	assert.Equal(t, GroundTruthMatch{Correct: true, Variant: "alternative_sql[0]"}, match)
+
+	match = scorePrediction(db, item, "SELECT MAX(price) AS price FROM Products", `[{"price":200}]`)
+	assert.Equal(t, GroundTruthMatch{Correct: true, Variant: "acceptable_results[0]"}, match)
+
+	match = scorePrediction(db, item, "SELECT name FROM Products ORDER BY price LIMIT 1", `[{"name":"Product 1"}]`)
+	assert.False(t, match.Correct)
+
+	item.ExpectedColumns = []string{"name"}
+	match = scorePrediction(db, item, "SELECT name AS product FROM Products WHERE id = 2", `[{"product":"Product 2"}]`)
+	assert.Equal(t, GroundTruthMatch{Correct: true, Variant: "expected_columns"}, match)
+
+	// without a stored result the gold SQL is run for one
+	item.Result = ""
+	match = scorePrediction(db, item, "SELECT * FROM Products WHERE id = 2", `{"columns":[{"name":"id","type":"INTEGER"},{"name":"name","type":"TEXT"},{"name":"price","type":"REAL"}],"rows":[[2,"Product 2",200]]}`)
+	assert.Equal(t, GroundTruthMatch{Correct: true, Variant: "sql"}, match)
+	match = scorePrediction(db, item, "SELECT name AS product FROM Products WHERE id = 2", `[{"product":"Product 2"}]`)
+	assert.Equal(t, GroundTruthMatch{Correct: true, Variant: "expected_columns"}, match)
+}
+
+func TestExpectedColumnsMatch(t *testing.T) {
+	gold := `{"columns":[{"name":"id"},{"name":"name"},{"name":"price"}],"rows":[[1,"Product 1",100],[2,"Product 2",200]]}`
+	assert.True(t, expectedColumnsMatch(gold, `[{"product":"Product 2"},{"product":"Product 1"}]`, []string{"name"}, false))
+	assert.True(t, expectedColumnsMatch(gold, `[{"p":100,"n":"Product 1"},{"p":200,"n":"Product 2"}]`, []string{"name", "price"}, true))
+	assert.False(t, expectedColumnsMatch(gold, `[{"product":"Product 2"},{"product":"Product 1"}]`, []string{"name"}, true))
+	assert.False(t, expectedColumnsMatch(gold, `[{"product":"Product 1"}]`, []string{"name"}, false))
+	assert.False(t, expectedColumnsMatch(gold, `[{"id":1,"product":"Product 1"},{"id":2,"product":"Product 2"}]`, []string{"name"}, false))
+	assert.False(t, expectedColumnsMatch(gold, `[{"product":"Product 1"}]`, []string{"colour"}, false))
+
+	assert.True(t, expectedColumnsMatch(`{"columns":[{"name":"COUNT(*)"}],"rows":[[12]]}`, `[{"n":12}]`, []string{"count"}, false))
+}
+
+func TestSpiderResultsMatch(t *testing.T) {
+	gold := [][]string{{"s:a", "n:1"}, {"s:b", "n:2"}}
+	assert.True(t, spiderResultsMatch(gold, [][]string{{"s:b", "n:2"}, {"s:a", "n:1"}}, false))
+	assert.False(t, spiderResultsMatch(gold, [][]string{{"s:b", "n:2"}, {"s:a", "n:1"}}, true))
+	// columns can come back in any order
+	assert.True(t, spiderResultsMatch(gold, [][]string{{"n:1", "s:a"}, {"n:2", "s:b"}}, true))
+	// but each row has to stay together
+	assert.False(t, spiderResultsMatch([][]string{{"n:1", "n:2"}, {"n:3", "n:4"}}, [][]string{{"n:1", "n:4"}, {"n:3", "n:2"}}, false))
+	// duplicates count
+	assert.False(t, spiderResultsMatch([][]string{{"s:a"}, {"s:a"}}, [][]string{{"s:a"}}, false))
+	assert.False(t, spiderResultsMatch(gold, [][]string{{"s:a"}, {"s:b"}}, false))
+	assert.True(t, spiderResultsMatch(nil, nil, false))
+}
+
+func TestBirdResultsMatch(t *testing.T) {
+	assert.True(t, birdResultsMatch([][]string{{"s:a"}, {"s:a"}, {"s:b"}}, [][]string{{"s:b"}, {"s:a"}}))
+	assert.False(t, birdResultsMatch([][]string{{"s:a", "n:1"}}, [][]string{{"n:1", "s:a"}}))
+}
+
+func TestExecutionAccuracyMatch(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE Products (id INTEGER PRIMARY KEY, name TEXT, price REAL); INSERT INTO Products (name, price) VALUES ('Product 1', 100), ('Product 2', 200);`)
+	assert.NoError(t, err)
+
+	// column names don't matter and 200.0 is 200
+	correct, err := executionAccuracyMatch(db, MetricSpiderExecutionAccuracy, `SELECT max(price) FROM Products`, `SELECT 200 AS most_expensive`, QueryLimits{})
+	assert.NoError(t, err)
+	assert.True(t, correct)
+
+	correct, err = executionAccuracyMatch(db, MetricSpiderExecutionAccuracy, `SELECT name FROM Products ORDER BY price DESC`, `SELECT name FROM Products ORDER BY price`, QueryLimits{})
+	assert.NoError(t, err)
+	assert.False(t, correct)
+	correct, err = executionAccuracyMatch(db, MetricBirdExecutionAccuracy, `SELECT name FROM Products ORDER BY price DESC`, `SELECT name FROM Products ORDER BY price`, QueryLimits{})
+	assert.NoError(t, err)
+	assert.True(t, correct)
+
+	_, err = executionAccuracyMatch(db, MetricSpiderExecutionAccuracy, `SELECT name FROM Products`, `SELECT nope FROM Products`, QueryLimits{})
+	assert.Error(t, err)
+
+	item := GroundTruthItem{SQL: `SELECT name FROM Products WHERE price > 150`, Result: `[{"name":"Product 2"}]`}
+	assert.True(t, scorePredictionWithMetric(db, MetricSpiderExecutionAccuracy, item, `SELECT name AS product FROM Products WHERE id = 2`, `[{"product":"Product 2"}]`, QueryLimits{}).Correct)
+	// the default metric cares about column names
+	assert.False(t, scorePredictionWithMetric(db, "", item, `SELECT name AS product FROM Products WHERE id = 2`, `[{"product":"Product 2"}]`, QueryLimits{}).Correct)
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Column types a seed spec can generate
+const (
+	SeedSequence  = "sequence"  // start, start+step, ...
+	SeedInt       = "int"       // min..max with a distribution
+	SeedFloat     = "float"     // min..max with a distribution, rounded to decimals
+	SeedChoice    = "choice"    // one of values, optionally weighted
+	SeedPattern   = "pattern"   // text with {n} replaced by the row number and {part} by a random entry of parts[part]
+	SeedDate      = "date"      // between from and to
+	SeedDatetime  = "datetime"  // between from and to
+	SeedReference = "reference" // a value of an already generated column, i.e. a foreign key
+)
+
+// Distributions numeric columns can be drawn from
+const (
+	DistributionUniform   = "uniform"
+	DistributionNormal    = "normal"    // mean and stddev
+	DistributionLognormal = "lognormal" // mean and stddev of the log, for long tails like prices
+	DistributionZipf      = "zipf"      // ints only, skew > 1: min is most common then it tails off
+)
+
+const seedInsertBatchSize = 500
+
+var seedPatternPlaceholder = regexp.MustCompile(`\{\w+\}`)
+
+// A declarative description of a database's sample data. Everything is drawn from random
+// sources derived from Seed so the same spec always produces the same data.
+type SeedSpec struct {
+	Seed   int64           `yaml:"seed"`
+	Tables []SeedTableSpec `yaml:"tables"` // generated in order, so referenced tables come first
+}
+
+type SeedTableSpec struct {
+	Table   string           `yaml:"table"`
+	Rows    int              `yaml:"rows"`
+	Unique  []string         `yaml:"unique,omitempty"` // columns whose combination can't repeat, e.g. a composite primary key
+	Columns []SeedColumnSpec `yaml:"columns"`          // columns left out get their default, e.g. AUTOINCREMENT ids
+}
+
+type SeedColumnSpec struct {
+	Name     string  `yaml:"name"`
+	Type     string  `yaml:"type"`
+	NullRate float64 `yaml:"null_rate,omitempty"` // fraction of rows left NULL
+
+	Start int `yaml:"start,omitempty"` // sequence, default 1
+	Step  int `yaml:"step,omitempty"`  // sequence, default 1
+
+	Distribution string   `yaml:"distribution,omitempty"` // int and float, default uniform
+	Min          *float64 `yaml:"min,omitempty"`
+	Max          *float64 `yaml:"max,omitempty"`
+	Mean         float64  `yaml:"mean,omitempty"`
+	StdDev       float64  `yaml:"stddev,omitempty"`
+	Decimals     int      `yaml:"decimals,omitempty"`
+	Skew         float64  `yaml:"skew,omitempty"` // zipf ints and references: > 1, the higher the more skewed
+
+	Values  []interface{} `yaml:"values,omitempty"` // choice
+	Weights []float64     `yaml:"weights,omitempty"`
+
+	Pattern string              `yaml:"pattern,omitempty"`
+	Parts   map[string][]string `yaml:"parts,omitempty"`
+
+	From   string `yaml:"from,omitempty"`   // date and datetime, as YYYY-MM-DD or YYYY-MM-DD HH:MM:SS
+	To     string `yaml:"to,omitempty"`     // inclusive
+	Format string `yaml:"format,omitempty"` // Go time layout, defaults to the same as from and to
+
+	References string `yaml:"references,omitempty"` // reference: Table.column
+}
+
+// The generated rows of every table, by table name, in the spec's column order
+type SeedData map[string][][]interface{}
+
+func loadSeedSpec(filename string) (*SeedSpec, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var spec SeedSpec
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return &spec, nil
+}
+
+// Each column gets its own random source so adding a column or table doesn't change the others
+func seedColumnRand(seed int64, table string, column string) *rand.Rand {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%d/%s/%s", seed, table, column)
+	return rand.New(rand.NewSource(int64(hash.Sum64())))
+}
+
+const (
+	seedDateLayout     = "2006-01-02"
+	seedDatetimeLayout = "2006-01-02 15:04:05"
+)
+
+func parseSeedTime(value string) (time.Time, string, error) {
+	for _, layout := range []string{seedDatetimeLayout, seedDateLayout} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, layout, nil
+		}
+	}
+	return time.Time{}, "", fmt.Errorf("'%s' isn't a date (YYYY-MM-DD) or datetime (YYYY-MM-DD HH:MM:SS)", value)
+}
+
+// Generates the values of one column, one row at a time
+type seedColumnGenerator struct {
+	spec       SeedColumnSpec
+	rng        *rand.Rand
+	zipf       *rand.Zipf
+	from, to   time.Time
+	format     string
+	references []interface{}
+}
+
+func newSeedColumnGenerator(seed int64, table string, column SeedColumnSpec, data SeedData, spec *SeedSpec) (*seedColumnGenerator, error) {
+	generator := &seedColumnGenerator{spec: column, rng: seedColumnRand(seed, table, column.Name)}
+	fail := func(format string, args ...interface{}) (*seedColumnGenerator, error) {
+		return nil, fmt.Errorf("%s.%s: %s", table, column.Name, fmt.Sprintf(format, args...))
+	}
+	if column.Name == "" {
+		return fail("name is required")
+	}
+	if column.NullRate < 0 || column.NullRate > 1 {
+		return fail("null_rate has to be between 0 and 1")
+	}
+
+	switch column.Type {
+	case SeedSequence:
+		if column.NullRate > 0 {
+			return fail("sequences can't be NULL")
+		}
+	case SeedInt, SeedFloat:
+		if column.Min == nil || column.Max == nil || *column.Min > *column.Max {
+			return fail("min and max are required and min can't be more than max")
+		}
+		switch column.Distribution {
+		case "", DistributionUniform, DistributionNormal, DistributionLognormal:
+		case DistributionZipf:
+			if column.Type != SeedInt {
+				return fail("zipf is only for ints")
+			}
+			if column.Skew <= 1 {
+				return fail("zipf needs a skew greater than 1")
+			}
+			generator.zipf = rand.NewZipf(generator.rng, column.Skew, 1, uint64(*column.Max-*column.Min))
+		default:
+			return fail("unknown distribution '%s'", column.Distribution)
+		}
+	case SeedChoice:
+		if len(column.Values) == 0 {
+			return fail("values are required")
+		}
+		if len(column.Weights) > 0 && len(column.Weights) != len(column.Values) {
+			return fail("there has to be a weight for every value")
+		}
+	case SeedPattern:
+		if column.Pattern == "" {
+			return fail("pattern is required")
+		}
+		for name, part := range column.Parts {
+			if len(part) == 0 {
+				return fail("part '%s' is empty", name)
+			}
+		}
+	case SeedDate, SeedDatetime:
+		var err error
+		var layout string
+		if generator.from, layout, err = parseSeedTime(column.From); err != nil {
+			return fail("from: %v", err)
+		}
+		if generator.to, _, err = parseSeedTime(column.To); err != nil {
+			return fail("to: %v", err)
+		}
+		if generator.to.Before(generator.from) {
+			return fail("to is before from")
+		}
+		generator.format = column.Format
+		if generator.format == "" {
+			generator.format = seedDateLayout
+			if column.Type == SeedDatetime || layout == seedDatetimeLayout {
+				generator.format = seedDatetimeLayout
+			}
+		}
+	case SeedReference:
+		referencedTable, referencedColumn, found := strings.Cut(column.References, ".")
+		if !found {
+			return fail("references has to be Table.column")
+		}
+		rows, ok := data[referencedTable]
+		if !ok {
+			return fail("references %s which hasn't been generated yet", referencedTable)
+		}
+		index := -1
+		for _, tableSpec := range spec.Tables {
+			if tableSpec.Table == referencedTable {
+				for i, c := range tableSpec.Columns {
+					if c.Name == referencedColumn {
+						index = i
+					}
+				}
+			}
+		}
+		if index < 0 {
+			return fail("references %s which isn't a generated column", column.References)
+		}
+		for _, row := range rows {
+			if row[index] != nil {
+				generator.references = append(generator.references, row[index])
+			}
+		}
+		if len(generator.references) == 0 {
+			return fail("%s has no values to reference", column.References)
+		}
+		if column.Skew != 0 {
+			if column.Skew <= 1 {
+				return fail("skew has to be greater than 1")
+			}
+			// shuffle first so the popular rows aren't simply the first ones
+			generator.rng.Shuffle(len(generator.references), func(i, j int) {
+				generator.references[i], generator.references[j] = generator.references[j], generator.references[i]
+			})
+			generator.zipf = rand.NewZipf(generator.rng, column.Skew, 1, uint64(len(generator.references)-1))
+		}
+	default:
+		return fail("unknown type '%s'", column.Type)
+	}
+	return generator, nil
+}
+
+func (generator *seedColumnGenerator) number() float64 {
+	column := generator.spec
+	min, max := *column.Min, *column.Max
+	var value float64
+	switch column.Distribution {
+	case DistributionNormal:
+		value = column.Mean + column.StdDev*generator.rng.NormFloat64()
+	case DistributionLognormal:
+		value = math.Exp(column.Mean + column.StdDev*generator.rng.NormFloat64())
+	case DistributionZipf:
+		return min + float64(generator.zipf.Uint64())
+	default:
+		if column.Type == SeedInt {
+			return min + float64(generator.rng.Int63n(int64(max-min)+1))
+		}
+		value = min + generator.rng.Float64()*(max-min)
+	}
+	return math.Max(min, math.Min(max, value))
+}
+
+func (generator *seedColumnGenerator) next(row int) interface{} {
+	column := generator.spec
+	if column.Type == SeedSequence {
+		start, step := column.Start, column.Step
+		if start == 0 {
+			start = 1
+		}
+		if step == 0 {
+			step = 1
+		}
+		return int64(start + row*step)
+	}
+	if column.NullRate > 0 && generator.rng.Float64() < column.NullRate {
+		return nil
+	}
+
+	switch column.Type {
+	case SeedInt:
+		return int64(math.Round(generator.number()))
+	case SeedFloat:
+		scale := math.Pow(10, float64(column.Decimals))
+		return math.Round(generator.number()*scale) / scale
+	case SeedChoice:
+		if len(column.Weights) == 0 {
+			return column.Values[generator.rng.Intn(len(column.Values))]
+		}
+		total := 0.0
+		for _, weight := range column.Weights {
+			total += weight
+		}
+		target := generator.rng.Float64() * total
+		for i, weight := range column.Weights {
+			if target < weight {
+				return column.Values[i]
+			}
+			target -= weight
+		}
+		return column.Values[len(column.Values)-1]
+	case SeedPattern:
+		// placeholders are filled left to right so the draws are always in the same order
+		return seedPatternPlaceholder.ReplaceAllStringFunc(column.Pattern, func(placeholder string) string {
+			name := placeholder[1 : len(placeholder)-1]
+			if name == "n" {
+				return strconv.Itoa(row + 1)
+			}
+			part, ok := column.Parts[name]
+			if !ok {
+				return placeholder
+			}
+			return part[generator.rng.Intn(len(part))]
+		})
+	case SeedDate, SeedDatetime:
+		span := generator.to.Sub(generator.from)
+		offset := time.Duration(generator.rng.Int63n(int64(span) + 1))
+		if column.Type == SeedDate {
+			offset = offset.Truncate(24 * time.Hour)
+		} else {
+			offset = offset.Truncate(time.Second)
+		}
+		return generator.from.Add(offset).Format(generator.format)
+	case SeedReference:
+		if generator.zipf != nil {
+			return generator.references[generator.zipf.Uint64()]
+		}
+		return generator.references[generator.rng.Intn(len(generator.references))]
+	}
+	return nil
+}
+
+// Generate every table's rows, in spec order so references can see the tables before them
+func generateSeedData(spec *SeedSpec) (SeedData, error) {
+	data := make(SeedData)
+	for _, table := range spec.Tables {
+		if table.Table == "" || table.Rows < 0 || len(table.Columns) == 0 {
+			return nil, fmt.Errorf("table '%s': table, rows and columns are required", table.Table)
+		}
+		if _, ok := data[table.Table]; ok {
+			return nil, fmt.Errorf("table %s is specified twice", table.Table)
+		}
+
+		generators := make([]*seedColumnGenerator, len(table.Columns))
+		columnIndex := make(map[string]int)
+		for i, column := range table.Columns {
+			generator, err := newSeedColumnGenerator(spec.Seed, table.Table, column, data, spec)
+			if err != nil {
+				return nil, err
+			}
+			generators[i] = generator
+			columnIndex[column.Name] = i
+		}
+		var uniqueIndexes []int
+		for _, name := range table.Unique {
+			index, ok := columnIndex[name]
+			if !ok {
+				return nil, fmt.Errorf("table %s: unique column %s isn't generated", table.Table, name)
+			}
+			uniqueIndexes = append(uniqueIndexes, index)
+		}
+
+		seen := make(map[string]bool)
+		rows := make([][]interface{}, 0, table.Rows)
+		for i := 0; i < table.Rows; i++ {
+			// keep drawing until the unique columns make a combination we haven't had yet
+			const maxAttempts = 100
+			var row []interface{}
+			for attempt := 0; ; attempt++ {
+				row = make([]interface{}, len(generators))
+				for j, generator := range generators {
+					row[j] = generator.next(i)
+				}
+				if len(uniqueIndexes) == 0 {
+					break
+				}
+				key := make([]string, len(uniqueIndexes))
+				for k, index := range uniqueIndexes {
+					key[k] = fmt.Sprint(row[index])
+				}
+				if !seen[strings.Join(key, "\x00")] {
+					seen[strings.Join(key, "\x00")] = true
+					break
+				}
+				if attempt == maxAttempts {
+					return nil, fmt.Errorf("table %s: couldn't generate %d rows with unique %s", table.Table, table.Rows, strings.Join(table.Unique, ", "))
+				}
+			}
+			rows = append(rows, row)
+		}
+		data[table.Table] = rows
+	}
+	return data, nil
+}
+
+func sqlLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Turn a seed spec into INSERT statements, which is how packs take their sample data
+func generateSeedSql(spec *SeedSpec) (string, error) {
+	data, err := generateSeedData(spec)
+	if err != nil {
+		return "", err
+	}
+	var seedSql strings.Builder
+	fmt.Fprintf(&seedSql, "-- Generated from a seed spec with seed %d\n", spec.Seed)
+	for _, table := range spec.Tables {
+		columns := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			columns[i] = column.Name
+		}
+		rows := data[table.Table]
+		for start := 0; start < len(rows); start += seedInsertBatchSize {
+			end := min(start+seedInsertBatchSize, len(rows))
+			fmt.Fprintf(&seedSql, "\nINSERT INTO %s (%s) VALUES\n", table.Table, strings.Join(columns, ", "))
+			for i, row := range rows[start:end] {
+				values := make([]string, len(row))
+				for j, value := range row {
+					values[j] = sqlLiteral(value)
+				}
+				separator := ","
+				if start+i == end-1 {
+					separator = ";"
+				}
+				fmt.Fprintf(&seedSql, "    (%s)%s\n", strings.Join(values, ", "), separator)
+			}
+		}
+	}
+	return seedSql.String(), nil
+}
+
+// dataset generate: print the SQL a seed spec generates, e.g. to look at the data or try another seed
+func runGenerateData(args []string) int {
+	flags := flag.NewFlagSet("dataset generate", flag.ExitOnError)
+	specFile := flags.String("spec", "", "Seed spec to generate data from, e.g. packs/ecommerce-large/seed.yaml")
+	seed := flags.Int64("seed", 0, "Use this seed instead of the one in the spec")
+	outFile := flags.String("out", "", "File to write the SQL to (default stdout)")
+	flags.Parse(args)
+
+	if *specFile == "" {
+		flags.Usage()
+		return ExitUsage
+	}
+	spec, err := loadSeedSpec(*specFile)
+	if err != nil {
+		log.Fatalf("Failed to load seed spec: %v", err)
+	}
+	if *seed != 0 {
+		spec.Seed = *seed
+	}
+	seedSql, err := generateSeedSql(spec)
+	if err != nil {
+		log.Fatalf("Failed to generate data: %v", err)
+	}
+	if *outFile == "" {
+		fmt.Print(seedSql)
+		return ExitOk
+	}
+	if err := os.WriteFile(*outFile, []byte(seedSql), 0644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *outFile, err)
+	}
+	return ExitOk
+}
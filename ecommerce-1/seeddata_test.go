@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSeedSpec = `
+seed: 7
+tables:
+  - table: Customers
+    rows: 50
+    columns:
+      - name: id
+        type: sequence
+      - name: name
+        type: pattern
+        pattern: "{first} {last} #{n}"
+        parts:
+          first: [Ann, Bo]
+          last: [Lee, O'Neil]
+      - name: joined
+        type: date
+        from: 2023-01-01
+        to: 2023-12-31
+      - name: tier
+        type: choice
+        values: [gold, silver]
+        weights: [1, 3]
+        null_rate: 0.5
+  - table: Orders
+    rows: 200
+    unique: [customer_id, day]
+    columns:
+      - name: customer_id
+        type: reference
+        references: Customers.id
+        skew: 1.5
+      - name: day
+        type: int
+        min: 1
+        max: 31
+      - name: total
+        type: float
+        distribution: lognormal
+        mean: 3
+        stddev: 1
+        min: 1
+        max: 1000
+        decimals: 2
+`
+
+func loadTestSeedSpec(t *testing.T, content string) *SeedSpec {
+	filename := filepath.Join(t.TempDir(), "seed.yaml")
+	assert.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+	spec, err := loadSeedSpec(filename)
+	assert.NoError(t, err)
+	return spec
+}
+
+func TestGenerateSeedData(t *testing.T) {
+	spec := loadTestSeedSpec(t, testSeedSpec)
+	data, err := generateSeedData(spec)
+	assert.NoError(t, err)
+	assert.Len(t, data["Customers"], 50)
+	assert.Len(t, data["Orders"], 200)
+
+	nulls := 0
+	for i, customer := range data["Customers"] {
+		assert.Equal(t, int64(i+1), customer[0])
+		assert.Regexp(t, `^(Ann|Bo) (Lee|O'Neil) #\d+$`, customer[1])
+		assert.Regexp(t, `^2023-\d\d-\d\d$`, customer[2])
+		if customer[3] == nil {
+			nulls++
+		}
+	}
+	assert.InDelta(t, 25, nulls, 10)
+
+	seen := make(map[[2]int64]bool)
+	orders := make(map[int64]int)
+	for _, order := range data["Orders"] {
+		key := [2]int64{order[0].(int64), order[1].(int64)}
+		assert.False(t, seen[key], "duplicate %v", key)
+		seen[key] = true
+		orders[order[0].(int64)]++
+		assert.True(t, order[2].(float64) >= 1 && order[2].(float64) <= 1000)
+	}
+	// skewed references leave some customers with lots of orders and others with none
+	assert.Less(t, len(orders), 50)
+
+	// the same spec always generates the same data
+	again, err := generateSeedData(spec)
+	assert.NoError(t, err)
+	assert.Equal(t, data, again)
+	spec.Seed = 8
+	different, err := generateSeedData(spec)
+	assert.NoError(t, err)
+	assert.NotEqual(t, data, different)
+}
+
+func TestGenerateSeedSql(t *testing.T) {
+	seedSql, err := generateSeedSql(loadTestSeedSpec(t, testSeedSpec))
+	assert.NoError(t, err)
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE Customers (id INTEGER PRIMARY KEY, name TEXT, joined TEXT, tier TEXT); CREATE TABLE Orders (customer_id INTEGER, day INTEGER, total REAL);`)
+	assert.NoError(t, err)
+	_, err = db.Exec(seedSql)
+	assert.NoError(t, err)
+	var count int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM Orders`).Scan(&count))
+	assert.Equal(t, 200, count)
+}
+
+func TestSeedSpecErrors(t *testing.T) {
+	for _, spec := range []string{
+		"tables: [{table: T, rows: 1, columns: [{name: a, type: nope}]}]",
+		"tables: [{table: T, rows: 1, columns: [{name: a, type: int, min: 5, max: 1}]}]",
+		"tables: [{table: T, rows: 1, columns: [{name: a, type: reference, references: Later.id}]}]",
+		"tables: [{table: T, rows: 1, columns: [{name: a, type: choice, values: [x, y], weights: [1]}]}]",
+		"tables: [{table: T, rows: 1, columns: [{name: a, type: date, from: yesterday, to: 2024-01-01}]}]",
+		"tables: [{table: T, rows: 1, columns: [{name: a, type: int, min: 1, max: 2, distribution: zipf}]}]",
+		"tables: [{table: T, rows: 3, unique: [a], columns: [{name: a, type: choice, values: [x, y]}]}]",
+	} {
+		_, err := generateSeedData(loadTestSeedSpec(t, spec))
+		assert.Error(t, err, spec)
+	}
+
+	// typos in a spec shouldn't be silently ignored
+	filename := filepath.Join(t.TempDir(), "seed.yaml")
+	assert.NoError(t, os.WriteFile(filename, []byte("tables: [{table: T, rowz: 1}]"), 0644))
+	_, err := loadSeedSpec(filename)
+	assert.Error(t, err)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultServeAddr      = "localhost:8080"
+	DefaultRequestTimeout = 2 * time.Minute
+	MaxRequestBytes       = 1 << 20
+)
+
+//go:embed openapi.yaml
+var openApiDocument []byte
+
+// The text-to-SQL pipeline over HTTP, for services that would otherwise shell out to ask and judge.
+// Everything's JSON, errors included: {"error": "..."}.
+type Server struct {
+	Asker          *Asker
+	Evaluator      *LLMClient
+	RequestTimeout time.Duration // 0 for none
+}
+
+// An error with the HTTP status it should be reported with
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (err *apiError) Error() string {
+	return err.Message
+}
+
+type questionRequest struct {
+	Question string `json:"question"`
+}
+
+type queryResponse struct {
+	*AskAnswer
+	Result    json.RawMessage `json:"result"`
+	Truncated bool            `json:"truncated"`
+}
+
+type compareRequest struct {
+	GoldSQL      string `json:"gold_sql"`
+	CandidateSQL string `json:"candidate_sql"`
+}
+
+type compareResponse struct {
+	Verdict SqlQueryEvaluationType `json:"verdict"`
+	Match   bool                   `json:"match"`
+}
+
+type schemaResponse struct {
+	Dialect string `json:"dialect"`
+	Schema  string `json:"schema"`
+}
+
+func writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("! Error writing response: %v", err)
+	}
+}
+
+func writeApiError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway // the model failed us
+	var requestErr *apiError
+	switch {
+	case errors.As(err, &requestErr):
+		status = requestErr.Status
+	case errors.Is(err, context.DeadlineExceeded):
+		status, err = http.StatusGatewayTimeout, errors.New("request timed out")
+	case errors.Is(err, ErrNoValidSql):
+		status = http.StatusUnprocessableEntity
+	}
+	writeJson(w, status, map[string]string{"error": err.Error()})
+}
+
+func decodeRequest(w http.ResponseWriter, r *http.Request, request any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxRequestBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		return &apiError{http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err)}
+	}
+	return nil
+}
+
+// Wrap an endpoint so it only answers method, gives up after RequestTimeout and responds in JSON
+func (server *Server) endpoint(method string, handle func(ctx context.Context, w http.ResponseWriter, r *http.Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeApiError(w, &apiError{http.StatusMethodNotAllowed, fmt.Sprintf("%s only takes %s", r.URL.Path, method)})
+			return
+		}
+		ctx := r.Context()
+		if server.RequestTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, server.RequestTimeout)
+			defer cancel()
+		}
+		start := time.Now()
+		response, err := handle(ctx, w, r)
+		if err != nil {
+			log.Printf("! %s %s failed after %s: %v", r.Method, r.URL.Path, time.Since(start), err)
+			writeApiError(w, err)
+			return
+		}
+		writeJson(w, http.StatusOK, response)
+	}
+}
+
+func (server *Server) question(w http.ResponseWriter, r *http.Request) (string, error) {
+	var request questionRequest
+	if err := decodeRequest(w, r, &request); err != nil {
+		return "", err
+	}
+	question := strings.TrimSpace(request.Question)
+	if question == "" {
+		return "", &apiError{http.StatusBadRequest, "question is required"}
+	}
+	return question, nil
+}
+
+// POST /v1/generate: question → SQL, checked that SQLite can compile it but not run
+func (server *Server) handleGenerate(ctx context.Context, w http.ResponseWriter, r *http.Request) (any, error) {
+	question, err := server.question(w, r)
+	if err != nil {
+		return nil, err
+	}
+	return server.Asker.Answer(ctx, question, false)
+}
+
+// POST /v1/query: question → SQL and the rows it returns
+func (server *Server) handleQuery(ctx context.Context, w http.ResponseWriter, r *http.Request) (any, error) {
+	question, err := server.question(w, r)
+	if err != nil {
+		return nil, err
+	}
+	answer, err := server.Asker.Answer(ctx, question, true)
+	if err != nil {
+		return nil, err
+	}
+	return &queryResponse{AskAnswer: answer, Result: json.RawMessage(answer.Result), Truncated: answer.Outcome == QueryOutcomeTruncated}, nil
+}
+
+// POST /v1/compare: gold and candidate SQL → the evaluator's verdict
+func (server *Server) handleCompare(ctx context.Context, w http.ResponseWriter, r *http.Request) (any, error) {
+	var request compareRequest
+	if err := decodeRequest(w, r, &request); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(request.GoldSQL) == "" || strings.TrimSpace(request.CandidateSQL) == "" {
+		return nil, &apiError{http.StatusBadRequest, "gold_sql and candidate_sql are required"}
+	}
+	verdict, _, err := compareSqlQueriesWithSystemPrompt(ctx, SqlComparisonApiSystemPrompt, request.GoldSQL, request.CandidateSQL, server.Evaluator, server.Asker.MaxTokens, server.Asker.Seed, Streaming{EarlyStop: server.Asker.Streaming.EarlyStop})
+	if err != nil {
+		return nil, err
+	}
+	return &compareResponse{Verdict: verdict, Match: verdict == ExactMatch || verdict == FunctionalMatch}, nil
+}
+
+// GET /v1/schema: the schema questions are answered against, as the model sees it
+func (server *Server) handleSchema(ctx context.Context, w http.ResponseWriter, r *http.Request) (any, error) {
+	return &schemaResponse{Dialect: server.Asker.Dialect, Schema: server.Asker.Schema}, nil
+}
+
+func (server *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/v1/generate", server.endpoint(http.MethodPost, server.handleGenerate))
+	mux.Handle("/v1/query", server.endpoint(http.MethodPost, server.handleQuery))
+	mux.Handle("/v1/compare", server.endpoint(http.MethodPost, server.handleCompare))
+	mux.Handle("/v1/schema", server.endpoint(http.MethodGet, server.handleSchema))
+	mux.HandleFunc("/v1/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(openApiDocument)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeApiError(w, &apiError{http.StatusNotFound, fmt.Sprintf("no such endpoint %s, see /v1/openapi.yaml", r.URL.Path)})
+	})
+	return mux
+}
+
+// serve: the pipeline as an HTTP API (see openapi.yaml)
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	options := addAskFlags(flags)
+	addr := flags.String("addr", DefaultServeAddr, "Address to listen on")
+	evaluator := flags.String("evaluator", DefaultEvaluator, "Evaluator /v1/compare uses as 'name : model'")
+	requestTimeout := flags.Duration("request-timeout", DefaultRequestTimeout, "Longest a request can take, retries included (0 for no limit)")
+	flags.Parse(args)
+	if !options.valid() || !validModelName(*evaluator) || flags.NArg() > 0 {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	asker := options.openReadOnly()
+	defer asker.Db.Close()
+	asker.Streaming.Progress = nil // requests' SQL would be interleaved
+	server := &Server{Asker: asker, Evaluator: lookupLLMClient(*evaluator, initialiseLLMClients(*options.baseURL)), RequestTimeout: *requestTimeout}
+	httpServer := &http.Server{Addr: *addr, Handler: server.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	fmt.Printf("Serving on http://%s (see /v1/openapi.yaml)\n", *addr)
+	if err := httpServer.ListenAndServe(); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+	return ExitOk
+}
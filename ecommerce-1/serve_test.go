@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tmc/langchaingo/llms"
+	"gopkg.in/yaml.v3"
+)
+
+// Never answers, so requests time out
+type hangingModel struct{}
+
+func (hangingModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (model hangingModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, model, prompt, options...)
+}
+
+func postJson(t *testing.T, url string, body string) (int, map[string]any) {
+	response, err := http.Post(url, "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+	var decoded map[string]any
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&decoded))
+	return response.StatusCode, decoded
+}
+
+func TestServer(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE Orders (id INTEGER PRIMARY KEY, shipping_status TEXT);
+INSERT INTO Orders (shipping_status) VALUES ('pending'), ('shipped'), ('shipped');`)
+	assert.NoError(t, err)
+	assert.NoError(t, restrictToReads(db))
+
+	model := &scriptedModel{}
+	evaluator := &scriptedModel{}
+	maxTokens := 200
+	asker := &Asker{Db: db, Model: model, Schema: "CREATE TABLE Orders (id INTEGER PRIMARY KEY, shipping_status TEXT);", Dialect: DialectPostgreSQL,
+		MaxTokens: &maxTokens, Seed: NoSeed, Limits: QueryLimits{MaxRows: 1}, TranslateDialect: true}
+	server := &Server{Asker: asker, Evaluator: &LLMClient{Instance: evaluator}, RequestTimeout: time.Minute}
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	// SQL that doesn't compile is generated again with the error
+	model.responses = []string{"SELECT COUNT(*) FROM Order", "SELECT COUNT(*) AS shipped FROM Orders WHERE shipping_status ILIKE 'SHIPPED'"}
+	status, body := postJson(t, httpServer.URL+"/v1/generate", `{"question": "How many orders have shipped?"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(2), body["attempts"])
+	assert.Equal(t, "SELECT COUNT(*) AS shipped FROM Orders WHERE shipping_status LIKE 'SHIPPED'", body["executed_sql"])
+	assert.Equal(t, []any{"ilike"}, body["translated"])
+	assert.Contains(t, body, "plan")
+	assert.NotContains(t, body, "result")
+
+	model.responses = []string{"SELECT id FROM Orders WHERE shipping_status = 'shipped'"}
+	status, body = postJson(t, httpServer.URL+"/v1/query", `{"question": "Which orders have shipped?"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, map[string]any{"columns": []any{map[string]any{"name": "id", "type": "INTEGER"}}, "rows": []any{[]any{float64(2)}}}, body["result"])
+	assert.Equal(t, true, body["truncated"])
+
+	// the database is read only, so SQL that writes never works, even if it tries to turn that off first
+	for _, write := range []string{"DELETE FROM Orders", "PRAGMA query_only = OFF; DELETE FROM Orders RETURNING id"} {
+		model.responses = []string{write, write, write, write}
+		status, body = postJson(t, httpServer.URL+"/v1/query", `{"question": "Delete the orders"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, status, write)
+		assert.Contains(t, body["error"], "not authorized", write)
+		var count int
+		assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM Orders").Scan(&count))
+		assert.Equal(t, 3, count, write)
+	}
+
+	status, body = postJson(t, httpServer.URL+"/v1/compare", `{"gold_sql": "SELECT 1", "candidate_sql": "SELECT 1"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, map[string]any{"verdict": "Exact", "match": true}, body)
+	evaluator.responses = []string{"None"}
+	status, body = postJson(t, httpServer.URL+"/v1/compare", `{"gold_sql": "SELECT name FROM Customers", "candidate_sql": "SELECT id FROM Customers"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, map[string]any{"verdict": "None", "match": false}, body)
+	assert.Contains(t, evaluator.prompts[0], "Comparison sql query: SELECT id FROM Customers")
+
+	response, err := http.Get(httpServer.URL + "/v1/schema")
+	assert.NoError(t, err)
+	var schema schemaResponse
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&schema))
+	response.Body.Close()
+	assert.Equal(t, schemaResponse{Dialect: DialectPostgreSQL, Schema: asker.Schema}, schema)
+
+	// bad requests
+	for _, testCase := range []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{"/v1/query", `{"question": `, http.StatusBadRequest},
+		{"/v1/query", `{"question": " "}`, http.StatusBadRequest},
+		{"/v1/query", `{"query": "How many orders?"}`, http.StatusBadRequest},
+		{"/v1/compare", `{"gold_sql": "SELECT 1"}`, http.StatusBadRequest},
+		{"/v1/schema", `{}`, http.StatusMethodNotAllowed},
+		{"/v2/query", `{}`, http.StatusNotFound},
+	} {
+		status, body := postJson(t, httpServer.URL+testCase.path, testCase.body)
+		assert.Equal(t, testCase.status, status, testCase.body)
+		assert.NotEmpty(t, body["error"], testCase.body)
+	}
+
+	// requests give up after RequestTimeout
+	asker.Model = hangingModel{}
+	server.RequestTimeout = 10 * time.Millisecond
+	status, body = postJson(t, httpServer.URL+"/v1/generate", `{"question": "How many orders have shipped?"}`)
+	assert.Equal(t, http.StatusGatewayTimeout, status)
+	assert.Equal(t, "request timed out", body["error"])
+}
+
+// The OpenAPI document is valid YAML and describes every endpoint there is
+func TestOpenApiDocument(t *testing.T) {
+	var document struct {
+		Paths map[string]map[string]any `yaml:"paths"`
+	}
+	assert.NoError(t, yaml.Unmarshal(openApiDocument, &document))
+	endpoints := map[string]string{"/v1/generate": "post", "/v1/query": "post", "/v1/compare": "post", "/v1/schema": "get", "/v1/openapi.yaml": "get"}
+	assert.Len(t, document.Paths, len(endpoints))
+	for path, method := range endpoints {
+		assert.Contains(t, document.Paths[path], method, path)
+	}
+
+	httpServer := httptest.NewServer((&Server{}).Handler())
+	defer httpServer.Close()
+	response, err := http.Get(httpServer.URL + "/v1/openapi.yaml")
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	served, err := io.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, openApiDocument, served)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// How much of a benchmark run shares one copy of a pack's database
+const (
+	SnapshotPerModel = "model" // every model starts from an untouched copy
+	SnapshotPerRun   = "run"   // all the models share one copy, so a write by one is seen by the next
+)
+
+func validSnapshotMode(mode string) bool {
+	return mode == SnapshotPerModel || mode == SnapshotPerRun
+}
+
+// Run f with the underlying SQLite connection of one of db's connections
+func withSqliteConn(db *sql.DB, f func(conn *sqlite3.SQLiteConn) error) error {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("not a SQLite connection: %T", driverConn)
+		}
+		return f(sqliteConn)
+	})
+}
+
+// Clone a database into memory with SQLite's backup API so generated SQL can do what it likes
+// without touching the pack's database. The clone lives in a single connection, so rows have
+// to be closed before the next query.
+func snapshotDb(source *sql.DB) (*sql.DB, error) {
+	snapshot, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// every connection to :memory: is a different database, so there can only be one and it can't be recycled
+	snapshot.SetMaxOpenConns(1)
+	snapshot.SetMaxIdleConns(1)
+	snapshot.SetConnMaxLifetime(0)
+	snapshot.SetConnMaxIdleTime(0)
+
+	err = withSqliteConn(snapshot, func(destination *sqlite3.SQLiteConn) error {
+		return withSqliteConn(source, func(sourceConn *sqlite3.SQLiteConn) error {
+			backup, err := destination.Backup("main", sourceConn, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+	if err != nil {
+		snapshot.Close()
+		return nil, fmt.Errorf("snapshotting database: %v", err)
+	}
+	return snapshot, nil
+}
+
+// SHA-256 of a database's contents, so a run record can show exactly which data every model saw.
+// The header's change counters and schema cookie are left out as copying a database bumps them without changing it.
+func dbSha256(db *sql.DB) (string, error) {
+	var checksum string
+	err := withSqliteConn(db, func(conn *sqlite3.SQLiteConn) error {
+		content, err := conn.Serialize("main")
+		if err != nil {
+			return err
+		}
+		// see https://www.sqlite.org/fileformat.html#the_database_header
+		if len(content) >= 100 {
+			clear(content[24:28])  // file change counter
+			clear(content[40:44])  // schema cookie
+			clear(content[92:100]) // version-valid-for number and the SQLite version that wrote it
+		}
+		sum := sha256.Sum256(content)
+		checksum = hex.EncodeToString(sum[:])
+		return nil
+	})
+	return checksum, err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotDb(t *testing.T) {
+	source, err := initialiseDb(filepath.Join(t.TempDir(), "test.db"), testDbDefinition)
+	assert.NoError(t, err)
+	defer source.Close()
+	sourceChecksum, err := dbSha256(source)
+	assert.NoError(t, err)
+
+	first, err := snapshotDb(source)
+	assert.NoError(t, err)
+	defer first.Close()
+	second, err := snapshotDb(source)
+	assert.NoError(t, err)
+	defer second.Close()
+
+	// every snapshot starts out with exactly the source's data
+	for _, snapshot := range []*sql.DB{first, second} {
+		checksum, err := dbSha256(snapshot)
+		assert.NoError(t, err)
+		assert.Equal(t, sourceChecksum, checksum)
+	}
+
+	// and what's done to one snapshot isn't seen anywhere else
+	_, err = first.Exec(`DELETE FROM Customers; DROP INDEX idx_customers_name;`)
+	assert.NoError(t, err)
+	var count int
+	assert.NoError(t, first.QueryRow(`SELECT COUNT(*) FROM Customers`).Scan(&count))
+	assert.Equal(t, 0, count)
+	for _, db := range []*sql.DB{second, source} {
+		assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM Customers`).Scan(&count))
+		assert.Equal(t, 2, count)
+	}
+	changedChecksum, err := dbSha256(first)
+	assert.NoError(t, err)
+	assert.NotEqual(t, sourceChecksum, changedChecksum)
+	checksum, err := dbSha256(source)
+	assert.NoError(t, err)
+	assert.Equal(t, sourceChecksum, checksum)
+}
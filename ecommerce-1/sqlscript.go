@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A named piece of SQL holding any number of statements, e.g. a pack's schema.sql
+type SqlScript struct {
+	Name string
+	Sql  string
+}
+
+// One statement of a script and the line it starts on, for error messages
+type SqlStatement struct {
+	Sql  string
+	Line int
+}
+
+type SqlStatementError struct {
+	Script    string
+	Statement SqlStatement
+	Err       error
+}
+
+func (e SqlStatementError) Error() string {
+	return fmt.Sprintf("%s:%d: %v in '%s'", e.Script, e.Statement.Line, e.Err, summariseSqlStatement(e.Statement.Sql))
+}
+
+// Every statement of a script that failed. Statements after a failure are still run so one
+// pass reports everything that's wrong with a script, not just the first thing.
+type SqlScriptError []SqlStatementError
+
+func (e SqlScriptError) Error() string {
+	messages := make([]string, len(e))
+	for i, statementError := range e {
+		messages[i] = statementError.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// The first line of a statement is enough to find it in the script
+func summariseSqlStatement(statement string) string {
+	firstLine, _, multiline := strings.Cut(statement, "\n")
+	firstLine = strings.TrimSpace(firstLine)
+	if multiline || len(firstLine) > 80 {
+		return strings.TrimSuffix(truncate(firstLine, 80), ";") + " ..."
+	}
+	return firstLine
+}
+
+func truncate(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+	return s[:length]
+}
+
+var transactionControlStatement = regexp.MustCompile(`(?i)^(BEGIN(\s+(DEFERRED|IMMEDIATE|EXCLUSIVE))?(\s+TRANSACTION)?|COMMIT(\s+TRANSACTION)?|END(\s+TRANSACTION)?|ROLLBACK(\s+TRANSACTION)?)\s*;?$`)
+
+// Whether tokens start with CREATE [TEMP | TEMPORARY] TRIGGER
+func isCreateTrigger(tokens []sqlToken) bool {
+	i := nextSqlToken(tokens, -1)
+	if i == len(tokens) || !tokens[i].is("CREATE") {
+		return false
+	}
+	i = nextSqlToken(tokens, i)
+	if i < len(tokens) && (tokens[i].is("TEMP") || tokens[i].is("TEMPORARY")) {
+		i = nextSqlToken(tokens, i)
+	}
+	return i < len(tokens) && tokens[i].is("TRIGGER")
+}
+
+// Split a script into statements on the semicolons that end them, which leaves out semicolons
+// in strings, quoted identifiers and comments, as they're part of those tokens, and the ones
+// inside a trigger's BEGIN ... END, which can have CASE ... END inside it.
+// Comments before a statement stay with it; a script that only has comments has no statements.
+func splitSqlStatements(script string) []SqlStatement {
+	var statements []SqlStatement
+	var current []sqlToken
+	line, startLine := 1, 1
+	hasCode := false // whether current has anything other than whitespace and comments
+	depth := 0       // of BEGIN and CASE not yet ENDed
+
+	finish := func() {
+		if hasCode {
+			statements = append(statements, SqlStatement{Sql: strings.TrimSpace(joinSqlTokens(current)), Line: startLine})
+		}
+		current = nil
+		hasCode = false
+		depth = 0
+	}
+
+	for _, token := range tokeniseSql(script) {
+		newlines := strings.Count(token.Text, "\n")
+		if len(current) == 0 && token.Kind == sqlSpace && strings.TrimSpace(token.Text) == "" {
+			// skip whitespace between statements so line numbers point at the statement
+			line += newlines
+			continue
+		}
+		if len(current) == 0 {
+			startLine = line
+		}
+		current = append(current, token)
+		line += newlines
+		if token.Kind == sqlSpace {
+			continue
+		}
+		hasCode = true
+		switch {
+		case token.is("BEGIN") || token.is("CASE"):
+			depth++
+		case token.is("END"):
+			depth--
+		case token.Text == ";" && (depth <= 0 || !isCreateTrigger(current)):
+			finish()
+		}
+	}
+	finish()
+	return statements
+}
+
+// Scripts exported from tools like DB Browser for SQLite wrap themselves in a transaction,
+// which has to go as we run them inside our own
+func isTransactionControl(statement string) bool {
+	var code []string
+	for _, token := range tokeniseSql(statement) {
+		if token.Kind != sqlSpace {
+			code = append(code, token.Text)
+		}
+	}
+	return transactionControlStatement.MatchString(strings.Join(code, " "))
+}
+
+// Run every statement in a script one at a time so a failure can be pinned to its statement
+// and line. Transaction control statements are skipped.
+func executeSqlScript(execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, script SqlScript) error {
+	var errs SqlScriptError
+	for _, statement := range splitSqlStatements(script.Sql) {
+		if isTransactionControl(statement.Sql) {
+			continue
+		}
+		if _, err := execer.Exec(statement.Sql); err != nil {
+			errs = append(errs, SqlStatementError{Script: script.Name, Statement: statement, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// The statements of a schema as the model should see them: without the transaction wrapper
+func schemaForPrompt(schema string) string {
+	var statements []string
+	for _, statement := range splitSqlStatements(schema) {
+		if !isTransactionControl(statement.Sql) {
+			statements = append(statements, statement.Sql)
+		}
+	}
+	return strings.Join(statements, "\n") + "\n"
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitSqlStatements(t *testing.T) {
+	script := `-- customers
+CREATE TABLE "a;b" (id INTEGER, note TEXT DEFAULT 'x;y');
+
+/* two
+   statements; */ INSERT INTO "a;b" VALUES (1, 'it''s; fine'); INSERT INTO "a;b" VALUES (2, NULL);
+CREATE TRIGGER t AFTER INSERT ON "a;b" BEGIN
+    UPDATE "a;b" SET note = 'z' WHERE id = new.id;
+END;
+-- nothing after this`
+
+	statements := splitSqlStatements(script)
+	assert.Equal(t, []SqlStatement{
+		{Sql: "-- customers\nCREATE TABLE \"a;b\" (id INTEGER, note TEXT DEFAULT 'x;y');", Line: 1},
+		{Sql: "/* two\n   statements; */ INSERT INTO \"a;b\" VALUES (1, 'it''s; fine');", Line: 4},
+		{Sql: "INSERT INTO \"a;b\" VALUES (2, NULL);", Line: 5},
+		{Sql: "CREATE TRIGGER t AFTER INSERT ON \"a;b\" BEGIN\n    UPDATE \"a;b\" SET note = 'z' WHERE id = new.id;\nEND;", Line: 6},
+	}, statements)
+
+	// CASE ... END; inside a trigger, and END at the end of a line in a string, don't end it
+	trigger := `CREATE TEMP TRIGGER grade AFTER UPDATE ON t BEGIN
+    UPDATE t SET grade = CASE WHEN new.score > 50 THEN 'pass' ELSE 'fail' END;
+    INSERT INTO log (note) VALUES ('the END
+');
+END;`
+	assert.Equal(t, []SqlStatement{{Sql: trigger, Line: 2}, {Sql: "SELECT CASE WHEN 1 THEN 2 END;", Line: 7}},
+		splitSqlStatements("\n"+trigger+"\nSELECT CASE WHEN 1 THEN 2 END;"))
+
+	// no trailing semicolon is still a statement
+	assert.Equal(t, []SqlStatement{{Sql: "SELECT 1", Line: 1}}, splitSqlStatements("SELECT 1"))
+	assert.Empty(t, splitSqlStatements("  -- just a comment\n"))
+}
+
+func TestIsTransactionControl(t *testing.T) {
+	for _, statement := range []string{"BEGIN TRANSACTION;", "begin;", "BEGIN IMMEDIATE TRANSACTION;", "COMMIT;", "END TRANSACTION", "-- done\nCOMMIT;"} {
+		assert.True(t, isTransactionControl(statement), statement)
+	}
+	for _, statement := range []string{"CREATE TABLE t (id INTEGER);", "COMMITTED;", "UPDATE t SET x = 1;"} {
+		assert.False(t, isTransactionControl(statement), statement)
+	}
+}
+
+func TestExecuteSqlScript(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// wrapped in a transaction like DB Browser exports, which we skip, with two broken statements
+	err = executeSqlScript(db, SqlScript{Name: "schema.sql", Sql: `BEGIN TRANSACTION;
+CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+INSERT INTO t (name) VALUES ('a');
+INSERT INTO t (name) VALUES (NULL);
+CREATE TABLE u (id INTEGER,
+    FOREIGN KEY(id) REFERENCES t(id),
+);
+COMMIT;`})
+	var scriptErr SqlScriptError
+	assert.ErrorAs(t, err, &scriptErr)
+	assert.Len(t, scriptErr, 2)
+	assert.Equal(t, "schema.sql:4: NOT NULL constraint failed: t.name in 'INSERT INTO t (name) VALUES (NULL);'", scriptErr[0].Error())
+	assert.Equal(t, 5, scriptErr[1].Statement.Line)
+	assert.Contains(t, scriptErr[1].Error(), "in 'CREATE TABLE u (id INTEGER, ...'")
+
+	// the statements that were fine still ran
+	var count int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM t`).Scan(&count))
+	assert.Equal(t, 1, count)
+}
+
+func TestShippedSchemasExecute(t *testing.T) {
+	packs, err := discoverDatasetPacks(DefaultPacksDir)
+	assert.NoError(t, err)
+	for _, pack := range packs {
+		schema, err := os.ReadFile(pack.Path(pack.Schema))
+		assert.NoError(t, err)
+		db, err := sql.Open("sqlite3", ":memory:")
+		assert.NoError(t, err)
+		db.SetMaxOpenConns(1)
+		assert.NoError(t, executeSqlScript(db, SqlScript{Name: filepath.Base(pack.Schema), Sql: string(schema)}), pack.Name)
+		db.Close()
+
+		prompt, err := pack.PromptSchema()
+		assert.NoError(t, err)
+		assert.NotContains(t, prompt, "BEGIN TRANSACTION")
+		assert.Contains(t, prompt, "CREATE TABLE")
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"strings"
+)
+
+type sqlTokenKind int
+
+const (
+	sqlSpace            sqlTokenKind = iota // whitespace and comments
+	sqlWord                                 // keywords and bare identifiers
+	sqlNumber                               // 42, 1.5, 1e3
+	sqlString                               // 'text'
+	sqlQuotedIdentifier                     // "name", `name` or [name]
+	sqlPunct                                // operators, brackets and commas
+)
+
+type sqlToken struct {
+	Kind sqlTokenKind
+	Text string
+}
+
+// Operators SQLite or the dialects we translate from write with two characters
+var sqlTwoCharOperators = []string{"::", "||", "<=", ">=", "<>", "!=", "==", "<<", ">>"}
+
+func isSqlWordByte(c byte, first bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 || !first && (c >= '0' && c <= '9' || c == '$')
+}
+
+// Split SQL into tokens that join back into exactly the SQL they came from, so a translation
+// can rewrite some tokens and leave everything else, comments and all, as it was
+func tokeniseSql(s string) []sqlToken {
+	var tokens []sqlToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		start := i
+		kind := sqlPunct
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\r' || s[i] == '\n') {
+				i++
+			}
+			kind = sqlSpace
+		case strings.HasPrefix(s[i:], "--"):
+			if end := strings.IndexByte(s[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(s)
+			}
+			kind = sqlSpace
+		case strings.HasPrefix(s[i:], "/*"):
+			if end := strings.Index(s[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(s)
+			}
+			kind = sqlSpace
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			i++
+			for i < len(s) {
+				if s[i] == closing {
+					// a doubled quote is a quote inside the string
+					if closing != ']' && i+1 < len(s) && s[i+1] == closing {
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				i++
+			}
+			kind = sqlQuotedIdentifier
+			if c == '\'' {
+				kind = sqlString
+			}
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+				i++
+			}
+			if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+				i++
+				if i < len(s) && (s[i] == '+' || s[i] == '-') {
+					i++
+				}
+				for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+					i++
+				}
+			}
+			kind = sqlNumber
+		case isSqlWordByte(c, true):
+			for i < len(s) && isSqlWordByte(s[i], false) {
+				i++
+			}
+			kind = sqlWord
+		default:
+			i++
+			for _, operator := range sqlTwoCharOperators {
+				if strings.HasPrefix(s[start:], operator) {
+					i = start + len(operator)
+					break
+				}
+			}
+		}
+		tokens = append(tokens, sqlToken{Kind: kind, Text: s[start:i]})
+	}
+	return tokens
+}
+
+func joinSqlTokens(tokens []sqlToken) string {
+	var joined strings.Builder
+	for _, token := range tokens {
+		joined.WriteString(token.Text)
+	}
+	return joined.String()
+}
+
+// Whether a token is the keyword or function name word, in any case
+func (token sqlToken) is(word string) bool {
+	return token.Kind == sqlWord && strings.EqualFold(token.Text, word)
+}
+
+// The index of the next token after i that isn't whitespace or a comment, or len(tokens)
+func nextSqlToken(tokens []sqlToken, i int) int {
+	for i++; i < len(tokens) && tokens[i].Kind == sqlSpace; i++ {
+	}
+	return i
+}
+
+// The index of the previous token before i that isn't whitespace or a comment, or -1
+func previousSqlToken(tokens []sqlToken, i int) int {
+	for i--; i >= 0 && tokens[i].Kind == sqlSpace; i-- {
+	}
+	return i
+}
+
+// The index of the bracket that closes the one at open, or -1 if it's never closed
+func closingSqlBracket(tokens []sqlToken, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		if tokens[i].Kind != sqlPunct {
+			continue
+		}
+		switch tokens[i].Text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// The index of the bracket that opens the one that closes at close, or -1
+func openingSqlBracket(tokens []sqlToken, close int) int {
+	depth := 0
+	for i := close; i >= 0; i-- {
+		if tokens[i].Kind != sqlPunct {
+			continue
+		}
+		switch tokens[i].Text {
+		case ")":
+			depth++
+		case "(":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Whether the token at i is a call of the named function, i.e. the name followed by a bracket
+func isSqlCall(tokens []sqlToken, i int, name string) bool {
+	next := nextSqlToken(tokens, i)
+	return tokens[i].is(name) && next < len(tokens) && tokens[next].Text == "("
+}
+
+// The arguments of a call whose brackets are at open and close, split on the commas between them
+func sqlCallArguments(tokens []sqlToken, open int, close int) [][]sqlToken {
+	var arguments [][]sqlToken
+	start, depth := open+1, 0
+	for i := open + 1; i < close; i++ {
+		switch tokens[i].Text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		case ",":
+			if depth == 0 && tokens[i].Kind == sqlPunct {
+				arguments = append(arguments, tokens[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(arguments, tokens[start:close])
+}
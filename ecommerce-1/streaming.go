@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// How completions are streamed
+type Streaming struct {
+	Progress io.Writer // where partial completions are shown as they arrive (nil for nowhere)
+	// stop generating once the answer is complete, e.g. at the ; ending a SQL statement, rather
+	// than paying for whatever a chatty model says next
+	EarlyStop bool
+}
+
+// How long a completion took to arrive and the tokens it used
+type GenerationStats struct {
+	TimeToFirstToken time.Duration
+	Total            time.Duration
+	StoppedEarly     bool
+	Usage            TokenUsage
+}
+
+func (stats *GenerationStats) String() string {
+	s := fmt.Sprintf("%s (first token after %s)", stats.Total.Round(time.Millisecond), stats.TimeToFirstToken.Round(time.Millisecond))
+	if stats.StoppedEarly {
+		s += ", stopped early"
+	}
+	s += fmt.Sprintf(", %d prompt + %d completion tokens", stats.Usage.PromptTokens, stats.Usage.CompletionTokens)
+	if stats.Usage.Estimated {
+		s += " (estimated)"
+	}
+	return s
+}
+
+// Returned from the streaming function to have the model stop
+var errStopStreaming = errors.New("completion is complete")
+
+// Stream a completion, showing it as it arrives and stopping early once complete says it's done.
+// Models that don't stream just give the whole completion at once, as the first token.
+func generateStreaming(ctx context.Context, llm llms.Model, prompt string, streaming Streaming, complete func(completion string) bool, options ...llms.CallOption) (string, *GenerationStats, error) {
+	var completion strings.Builder
+	stats := &GenerationStats{}
+	start := time.Now()
+	options = append(options, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		if completion.Len() == 0 {
+			stats.TimeToFirstToken = time.Since(start)
+			if streaming.Progress != nil {
+				fmt.Fprint(streaming.Progress, "- Streaming: ")
+			}
+		}
+		completion.Write(chunk)
+		if streaming.Progress != nil {
+			streaming.Progress.Write([]byte(stripNewlines(string(chunk))))
+		}
+		if streaming.EarlyStop && complete != nil && complete(completion.String()) {
+			stats.StoppedEarly = true
+			return errStopStreaming
+		}
+		return nil
+	}))
+
+	// as llms.GenerateFromSinglePrompt, but keeping the generation info for its token counts
+	response, err := llm.GenerateContent(ctx, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, prompt)}, options...)
+	stats.Total = time.Since(start)
+	if streaming.Progress != nil && completion.Len() > 0 {
+		fmt.Fprintln(streaming.Progress)
+	}
+	// providers wrap the error differently, if at all, so go by whether we stopped it
+	if stats.StoppedEarly {
+		// a stopped completion never gets as far as the provider counting it
+		stats.Usage = estimateTokenUsage(prompt, completion.String())
+		return completion.String(), stats, nil
+	}
+	if err != nil {
+		return "", stats, err
+	}
+	if len(response.Choices) == 0 {
+		return "", stats, errors.New("empty response from model")
+	}
+	choice := response.Choices[0]
+	if completion.Len() == 0 {
+		stats.TimeToFirstToken = stats.Total
+	}
+	var counted bool
+	if stats.Usage, counted = tokenUsageFromGenerationInfo(choice.GenerationInfo); !counted {
+		stats.Usage = estimateTokenUsage(prompt, choice.Content)
+	}
+	return choice.Content, stats, nil
+}
+
+// Whether a completion has a whole SQL statement in it: a query ended by a ; that isn't in a
+// string, identifier or comment
+func completeSqlStatement(completion string) bool {
+	sawQuery := false
+	for _, token := range tokeniseSql(completion) {
+		switch {
+		case token.is("SELECT") || token.is("WITH") || token.is("VALUES"):
+			sawQuery = true
+		case token.Kind == sqlPunct && token.Text == ";" && sawQuery:
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a comparison's completion has its verdict: a whole first line that's one of the
+// evaluation types, which anything after it (usually reasoning) can't change
+func completeVerdict(completion string) bool {
+	verdict, _, found := strings.Cut(strings.TrimLeft(completion, " \t\r\n"), "\n")
+	return found && parseSqlQueryEvaluationType(verdict) != InvalidMatch
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Streams its chunks, stopping if told to as the providers do, and counts how many it sent
+type streamingModel struct {
+	chunks []string
+	sent   int
+}
+
+func (model *streamingModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var callOptions llms.CallOptions
+	for _, option := range options {
+		option(&callOptions)
+	}
+	completion := ""
+	for _, chunk := range model.chunks {
+		model.sent++
+		completion += chunk
+		if callOptions.StreamingFunc != nil {
+			if err := callOptions.StreamingFunc(ctx, []byte(chunk)); err != nil {
+				return nil, fmt.Errorf("streaming func returned an error: %w", err)
+			}
+		}
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: completion}}}, nil
+}
+
+func (model *streamingModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, model, prompt, options...)
+}
+
+func TestCompleteSqlStatement(t *testing.T) {
+	assert.False(t, completeSqlStatement(""))
+	assert.False(t, completeSqlStatement("SELECT name FROM Customers"))
+	assert.True(t, completeSqlStatement("SELECT name FROM Customers;"))
+	assert.True(t, completeSqlStatement("WITH t AS (SELECT 1) SELECT * FROM t; -- and"))
+	// not when the ; is quoted, commented or before any query
+	assert.False(t, completeSqlStatement("SELECT 'a;b"))
+	assert.False(t, completeSqlStatement("SELECT \"a;b\" FROM t"))
+	assert.False(t, completeSqlStatement("SELECT 1 -- done;"))
+	assert.False(t, completeSqlStatement("Here you go;"))
+}
+
+func TestCompleteVerdict(t *testing.T) {
+	assert.False(t, completeVerdict("Functional"))
+	assert.True(t, completeVerdict("Functional\n"))
+	assert.True(t, completeVerdict("\n\"None\".\nThe comparison"))
+	assert.False(t, completeVerdict("The queries\n"))
+}
+
+func TestGenerateStreaming(t *testing.T) {
+	chatty := []string{"SELECT ", "COUNT(*) ", "FROM Orders", ";", "\nThis counts ", "the orders."}
+	model := &streamingModel{chunks: chatty}
+	var progress bytes.Buffer
+	completion, stats, err := generateStreaming(context.Background(), model, "How many orders?", Streaming{Progress: &progress, EarlyStop: true}, completeSqlStatement)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT COUNT(*) FROM Orders;", completion)
+	assert.Equal(t, 4, model.sent)
+	assert.True(t, stats.StoppedEarly)
+	assert.LessOrEqual(t, stats.TimeToFirstToken, stats.Total)
+	assert.Equal(t, "- Streaming: SELECT COUNT(*) FROM Orders;\n", progress.String())
+
+	// without stopping early the whole completion arrives
+	model = &streamingModel{chunks: chatty}
+	completion, stats, err = generateStreaming(context.Background(), model, "How many orders?", Streaming{}, completeSqlStatement)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT COUNT(*) FROM Orders;\nThis counts the orders.", completion)
+	assert.Equal(t, len(chatty), model.sent)
+	assert.False(t, stats.StoppedEarly)
+
+	// models that don't stream give it all at once
+	completion, stats, err = generateStreaming(context.Background(), &scriptedModel{responses: []string{"SELECT 1"}}, "One?", Streaming{EarlyStop: true}, completeSqlStatement)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT 1", completion)
+	assert.Equal(t, stats.Total, stats.TimeToFirstToken)
+}
+
+func TestQuestionRecordGenerationStats(t *testing.T) {
+	first := &QuestionRecord{}
+	first.addGenerationStats(&GenerationStats{TimeToFirstToken: 100 * time.Millisecond, Total: time.Second, StoppedEarly: true}, nil)
+	first.addGenerationStats(&GenerationStats{TimeToFirstToken: 300 * time.Millisecond, Total: time.Second}, nil)
+	first.addGenerationStats(nil, nil)
+	assert.Equal(t, &QuestionRecord{TimeToFirstToken: 100 * time.Millisecond, GenerationTime: 2 * time.Second, StoppedEarly: 1}, first)
+
+	second := &QuestionRecord{}
+	second.addGenerationStats(&GenerationStats{TimeToFirstToken: 300 * time.Millisecond, Total: time.Second}, nil)
+	model := &ModelRunRecord{Questions: []*QuestionRecord{first, second, {}}}
+	timeToFirstToken, generation, questions := model.Latency()
+	assert.Equal(t, 200*time.Millisecond, timeToFirstToken)
+	assert.Equal(t, 1500*time.Millisecond, generation)
+	assert.Equal(t, 2, questions)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// What a model charges, in US dollars per million tokens
+type ModelPrice struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
+}
+
+// Models run locally don't charge by the token
+var LocalModelPrice = &ModelPrice{}
+
+func (price *ModelPrice) Cost(usage TokenUsage) float64 {
+	return (float64(usage.PromptTokens)*price.InputPerMillion + float64(usage.CompletionTokens)*price.OutputPerMillion) / 1_000_000
+}
+
+// Tokens a completion used, as the provider reported them or, when it didn't, estimated
+type TokenUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+	Estimated        bool
+}
+
+func (usage TokenUsage) Total() int {
+	return usage.PromptTokens + usage.CompletionTokens
+}
+
+func (usage *TokenUsage) Add(other TokenUsage) {
+	usage.PromptTokens += other.PromptTokens
+	usage.CompletionTokens += other.CompletionTokens
+	usage.Estimated = usage.Estimated || other.Estimated
+}
+
+func generationInfoInt(info map[string]any, key string) int {
+	switch value := info[key].(type) {
+	case int:
+		return value
+	case int32:
+		return int(value)
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	}
+	return 0
+}
+
+// Token counts from a completion's generation info: OpenAI and Ollama report PromptTokens and
+// CompletionTokens, Anthropic InputTokens and OutputTokens. Not every provider reports them, and
+// OpenAI's don't when streaming, so ok is false unless there's a count.
+func tokenUsageFromGenerationInfo(info map[string]any) (usage TokenUsage, ok bool) {
+	usage.PromptTokens = generationInfoInt(info, "PromptTokens") + generationInfoInt(info, "InputTokens")
+	usage.CompletionTokens = generationInfoInt(info, "CompletionTokens") + generationInfoInt(info, "OutputTokens")
+	return usage, usage.CompletionTokens > 0
+}
+
+// A rough count of the tokens in some text, for when the provider doesn't say. BPE tokenisers
+// mostly give short words a token each and split longer ones every 4 or so characters, while
+// punctuation is a token a character. Tokenisers differ by model anyway so this is only ever
+// going to be close.
+func estimateTokens(text string) int {
+	tokens := 0
+	wordLength := 0
+	endWord := func() {
+		if wordLength > 7 {
+			tokens += (wordLength + 3) / 4
+		} else if wordLength > 0 {
+			tokens++
+		}
+		wordLength = 0
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			wordLength++
+		case unicode.IsSpace(r):
+			endWord()
+		default:
+			endWord()
+			tokens++
+		}
+	}
+	endWord()
+	return tokens
+}
+
+func estimateTokenUsage(prompt string, completion string) TokenUsage {
+	return TokenUsage{PromptTokens: estimateTokens(prompt), CompletionTokens: estimateTokens(completion), Estimated: true}
+}
+
+// e.g. 12.3k
+func formatTokens(tokens int) string {
+	if tokens < 1000 {
+		return fmt.Sprint(tokens)
+	}
+	return fmt.Sprintf("%.1fk", float64(tokens)/1000)
+}
+
+// Dollars, with enough places to tell apart the fractions of a cent a question costs
+func formatCost(cost float64) string {
+	if cost == 0 {
+		return "$0"
+	}
+	if cost < 0.01 {
+		return fmt.Sprintf("$%.5f", cost)
+	}
+	return fmt.Sprintf("$%.2f", cost)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenUsageFromGenerationInfo(t *testing.T) {
+	usage, ok := tokenUsageFromGenerationInfo(map[string]any{"PromptTokens": 120, "CompletionTokens": 15, "TotalTokens": 135})
+	assert.True(t, ok)
+	assert.Equal(t, TokenUsage{PromptTokens: 120, CompletionTokens: 15}, usage)
+	usage, ok = tokenUsageFromGenerationInfo(map[string]any{"InputTokens": 120, "OutputTokens": 15})
+	assert.True(t, ok)
+	assert.Equal(t, 135, usage.Total())
+	// OpenAI when streaming, and providers that don't say
+	_, ok = tokenUsageFromGenerationInfo(map[string]any{"PromptTokens": 0, "CompletionTokens": 0})
+	assert.False(t, ok)
+	_, ok = tokenUsageFromGenerationInfo(nil)
+	assert.False(t, ok)
+}
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, estimateTokens(""))
+	// SELECT, COUNT, (, *, ), FROM, Orders, ;
+	assert.Equal(t, 8, estimateTokens("SELECT COUNT(*) FROM Orders;"))
+	// longer words are split every 4 characters
+	assert.Equal(t, 4, estimateTokens("shipping_status"))
+}
+
+func TestModelPriceCost(t *testing.T) {
+	price := &ModelPrice{InputPerMillion: 0.25, OutputPerMillion: 1.25}
+	assert.InDelta(t, 0.0003125, price.Cost(TokenUsage{PromptTokens: 1000, CompletionTokens: 50}), 1e-12)
+	assert.Equal(t, 0.0, LocalModelPrice.Cost(TokenUsage{PromptTokens: 1000, CompletionTokens: 50}))
+	assert.Equal(t, "$0.00031", formatCost(0.0003125))
+	assert.Equal(t, "$1.50", formatCost(1.5))
+	assert.Equal(t, "12.3k", formatTokens(12345))
+}
+
+func TestEvaluatorUsageKeptApart(t *testing.T) {
+	question := &QuestionRecord{}
+	question.addGenerationStats(&GenerationStats{Usage: TokenUsage{PromptTokens: 1000, CompletionTokens: 50}}, &ModelPrice{InputPerMillion: 2, OutputPerMillion: 4})
+	question.addEvaluatorUsage(&GenerationStats{Usage: TokenUsage{PromptTokens: 400, CompletionTokens: 2, Estimated: true}}, &ModelPrice{InputPerMillion: 1, OutputPerMillion: 1})
+	question.addEvaluatorUsage(nil, nil)
+	assert.Equal(t, 1000, question.PromptTokens)
+	assert.False(t, question.TokensEstimated)
+	assert.InDelta(t, 0.0022, question.Cost, 1e-9)
+
+	model := &ModelRunRecord{Questions: []*QuestionRecord{question}}
+	assert.Equal(t, TokenUsage{PromptTokens: 400, CompletionTokens: 2, Estimated: true}, model.EvaluatorTokens())
+	_, priced := model.EvaluatorCost()
+	assert.False(t, priced)
+	model.EvaluatorPrice = &ModelPrice{InputPerMillion: 1, OutputPerMillion: 1}
+	cost, priced := model.EvaluatorCost()
+	assert.True(t, priced)
+	assert.InDelta(t, 0.000402, cost, 1e-9)
+	assert.Equal(t, "evaluator ~402 tokens, $0.00040", evaluatorSpend(model))
+}
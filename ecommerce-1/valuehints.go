@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Text columns with at most this many distinct values have them all indexed
+const ValueIndexMaxDistinct = 50
+
+// Columns with at most this many values, or a CHECK listing them, have them all listed when the
+// question mentions the column or one of its values, so the model can see which is meant
+const ValueHintsMaxListed = 10
+
+// The values of a column, as hints know them
+type indexedColumn struct {
+	Table       string
+	Column      string
+	Values      []string
+	Enumeration bool // the values are all the column can hold, from a CHECK constraint
+}
+
+func (column *indexedColumn) Name() string {
+	return column.Table + "." + column.Column
+}
+
+func (column *indexedColumn) listed() bool {
+	return column.Enumeration || len(column.Values) <= ValueHintsMaxListed
+}
+
+// The distinct values of a database's low cardinality text columns and the values CHECK
+// constraints allow, so literals in a question can be matched to what's actually stored:
+// "Shipped" to 'shipped', "product 7" to 'Product 7'
+type ValueIndex struct {
+	Columns []*indexedColumn
+}
+
+// Index the values of a database's tables, from loadSchemaTables, and the enumerations in its
+// schema's CHECK constraints
+func buildValueIndex(tables []SchemaTable, schema string) *ValueIndex {
+	index := &ValueIndex{Columns: checkEnumerations(schema)}
+	for _, table := range tables {
+		for _, column := range table.TextColumns {
+			if index.column(table.Name, column.Name) != nil {
+				continue // its CHECK already says what it can hold
+			}
+			if column.Distinct == 0 || column.Distinct > ValueIndexMaxDistinct {
+				continue
+			}
+			values := append([]string(nil), column.Values...)
+			sort.Strings(values)
+			index.Columns = append(index.Columns, &indexedColumn{Table: table.Name, Column: column.Name, Values: values})
+		}
+	}
+	return index
+}
+
+func (index *ValueIndex) column(table string, column string) *indexedColumn {
+	for _, indexed := range index.Columns {
+		if strings.EqualFold(indexed.Table, table) && strings.EqualFold(indexed.Column, column) {
+			return indexed
+		}
+	}
+	return nil
+}
+
+// The values CHECK (column IN (...)) constraints allow, by column
+func checkEnumerations(schema string) []*indexedColumn {
+	var enumerations []*indexedColumn
+	for _, statement := range splitSqlStatements(schema) {
+		table := schemaStatementTable(statement.Sql)
+		tokens := tokeniseSql(statement.Sql)
+		for i := range tokens {
+			if table == "" || !isSqlCall(tokens, i, "CHECK") {
+				continue
+			}
+			open := nextSqlToken(tokens, i)
+			close := closingSqlBracket(tokens, open)
+			column := nextSqlToken(tokens, open)
+			in := nextSqlToken(tokens, column)
+			if close == -1 || in >= close || !tokens[in].is("IN") {
+				continue
+			}
+			listOpen := nextSqlToken(tokens, in)
+			listClose := closingSqlBracket(tokens, listOpen)
+			if listOpen >= close || tokens[listOpen].Text != "(" || listClose == -1 {
+				continue
+			}
+			enumeration := &indexedColumn{Table: table, Column: unquoteSqlIdentifier(tokens[column]), Enumeration: true}
+			for _, argument := range sqlCallArguments(tokens, listOpen, listClose) {
+				for _, token := range argument {
+					if token.Kind == sqlString {
+						enumeration.Values = append(enumeration.Values, strings.ReplaceAll(token.Text[1:len(token.Text)-1], "''", "'"))
+					}
+				}
+			}
+			if len(enumeration.Values) > 0 {
+				enumerations = append(enumerations, enumeration)
+			}
+		}
+	}
+	return enumerations
+}
+
+// Lower case words of letters and digits, for matching values however they're written
+func valueWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
+
+// The number of single character edits that turn a into b
+func editDistance(a string, b string) int {
+	ar, br := []rune(a), []rune(b)
+	previous := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current := make([]int, len(br)+1)
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			substitution := previous[j-1]
+			if ar[i-1] != br[j-1] {
+				substitution++
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, substitution)
+		}
+		previous = current
+	}
+	return previous[len(br)]
+}
+
+// Whether some run of the question's words is the value, allowing a typo or two in longer values
+// as long as they start the same. Numbers have to match exactly, Product 7 not being Product 8,
+// and values that are only numbers aren't matched at all, as questions are full of numbers that
+// aren't them.
+func questionMentionsValue(questionWords []string, value string) bool {
+	words := valueWords(value)
+	if len(words) == 0 || strings.IndexFunc(value, unicode.IsLetter) == -1 {
+		return false
+	}
+	joined := strings.Join(words, " ")
+	allowed := 0
+	switch {
+	case strings.IndexFunc(joined, unicode.IsDigit) != -1:
+	case len(joined) >= 10:
+		allowed = 2
+	case len(joined) >= 5:
+		allowed = 1
+	}
+	for i := 0; i+len(words) <= len(questionWords); i++ {
+		candidate := strings.Join(questionWords[i:i+len(words)], " ")
+		if candidate == joined || allowed > 0 && candidate[0] == joined[0] && editDistance(candidate, joined) <= allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Hints about the values a question refers to, in the tables given (all of them if none are),
+// e.g. Products.name contains 'Product 7' or Orders.status is one of 'pending', 'shipped'
+func (index *ValueIndex) Hints(question string, tables []string) []string {
+	if index == nil {
+		return nil
+	}
+	questionWords := valueWords(question)
+	mentioned := make(map[string]bool)
+	for _, word := range linkingWords(question) {
+		mentioned[word] = true
+	}
+	var hints []string
+	for _, column := range index.Columns {
+		if len(tables) > 0 && !containsFold(tables, column.Table) {
+			continue
+		}
+		var matched []string
+		for _, value := range column.Values {
+			if questionMentionsValue(questionWords, value) {
+				matched = append(matched, value)
+			}
+		}
+		columnMentioned := false
+		for _, word := range identifierWords(column.Column) {
+			if linkingStopWords[word] {
+				continue
+			}
+			if !mentioned[word] {
+				columnMentioned = false
+				break
+			}
+			columnMentioned = true
+		}
+		switch {
+		case column.listed() && (len(matched) > 0 || columnMentioned):
+			hints = append(hints, fmt.Sprintf("%s is one of %s", column.Name(), quotedSqlValues(column.Values)))
+		case len(matched) > 0:
+			hints = append(hints, fmt.Sprintf("%s contains %s", column.Name(), quotedSqlValues(matched)))
+		}
+	}
+	for _, hint := range hints {
+		fmt.Printf("- Value hint: %s\n", hint)
+	}
+	return hints
+}
+
+func quotedSqlValues(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Value hints as they're given to the generator
+func valueHintsPrompt(hints []string) string {
+	if len(hints) == 0 {
+		return ""
+	}
+	return "\nValues in the database the question may refer to, to be written exactly as they are here:\n- " + strings.Join(hints, "\n- ") + "\n"
+}
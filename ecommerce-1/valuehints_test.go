@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const valueHintsTestSchema = `CREATE TABLE Products (id INTEGER PRIMARY KEY, name TEXT NOT NULL, price REAL);
+CREATE TABLE Orders (
+    id INTEGER PRIMARY KEY,
+    shipping_status TEXT CHECK (shipping_status IN ('pending', 'shipped', 'delivered')),
+    country TEXT,
+    notes TEXT
+);
+`
+
+func TestCheckEnumerations(t *testing.T) {
+	enumerations := checkEnumerations(valueHintsTestSchema + `CREATE TABLE "Projects" (status TEXT, CONSTRAINT known CHECK ("status" IN ('it''s on', 'off')));`)
+	assert.Equal(t, []*indexedColumn{
+		{Table: "Orders", Column: "shipping_status", Values: []string{"pending", "shipped", "delivered"}, Enumeration: true},
+		{Table: "Projects", Column: "status", Values: []string{"it's on", "off"}, Enumeration: true},
+	}, enumerations)
+	assert.Empty(t, checkEnumerations("CREATE TABLE t (n INTEGER CHECK (n > 0));"))
+}
+
+func TestQuestionMentionsValue(t *testing.T) {
+	words := valueWords("How many Product 7s were shiped to the UK?")
+	assert.True(t, questionMentionsValue(words, "shipped")) // a typo
+	assert.True(t, questionMentionsValue(words, "uk"))
+	assert.False(t, questionMentionsValue(words, "Product 7")) // 7s isn't 7
+	assert.True(t, questionMentionsValue(valueWords("How much did product 7 sell?"), "Product 7"))
+	assert.False(t, questionMentionsValue(valueWords("How much did product 8 sell?"), "Product 7"))
+	assert.False(t, questionMentionsValue(valueWords("Orders over 100"), "100"))
+	// typos have to start the same
+	assert.False(t, questionMentionsValue(valueWords("What's the spending?"), "pending"))
+	assert.Equal(t, 2, editDistance("delivered", "delivred!"))
+}
+
+func TestValueIndexHints(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(valueHintsTestSchema + `
+INSERT INTO Products (name, price) VALUES ('Product 7', 9.99), ('Product 70', 1.5);
+INSERT INTO Orders (shipping_status, country, notes) VALUES ('pending', 'UK', 'Leave at the door'), ('shipped', 'France', NULL), ('shipped', 'UK', NULL);`)
+	assert.NoError(t, err)
+	tables, err := loadSchemaTables(db)
+	assert.NoError(t, err)
+	index := buildValueIndex(tables, valueHintsTestSchema)
+	assert.Len(t, index.Columns, 4)
+	assert.Equal(t, []string{"France", "UK"}, index.column("orders", "country").Values)
+
+	assert.Equal(t, []string{
+		"Orders.shipping_status is one of 'pending', 'shipped', 'delivered'",
+		"Products.name is one of 'Product 7', 'Product 70'",
+	}, index.Hints("How many Product 7 orders have Shipped?", nil))
+	// columns the question names are listed even without a value
+	assert.Equal(t, []string{"Orders.country is one of 'France', 'UK'"}, index.Hints("Orders by country", nil))
+	// and only the tables given are hinted at
+	assert.Empty(t, index.Hints("How many Product 7 orders have Shipped?", []string{"Customers"}))
+	assert.Empty(t, index.Hints("How many customers are there?", nil))
+
+	// too many to list, so just the ones the question mentions
+	products := &indexedColumn{Table: "Products", Column: "name"}
+	for _, name := range []string{"Product 1", "Product 2", "Product 3", "Product 4", "Product 5", "Product 6", "Product 7", "Product 8", "Product 9", "Product 10", "Product 11"} {
+		products.Values = append(products.Values, name)
+	}
+	assert.Equal(t, []string{"Products.name contains 'Product 7'"}, (&ValueIndex{Columns: []*indexedColumn{products}}).Hints("Who bought product 7?", nil))
+
+	var none *ValueIndex
+	assert.Empty(t, none.Hints("How many orders have shipped?", nil))
+	assert.Equal(t, "", valueHintsPrompt(nil))
+	assert.Equal(t, "\nValues in the database the question may refer to, to be written exactly as they are here:\n- Orders.country is one of 'France', 'UK'\n",
+		valueHintsPrompt([]string{"Orders.country is one of 'France', 'UK'"}))
+}